@@ -0,0 +1,139 @@
+package main
+
+import (
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+	"sync"
+)
+
+// . AppVolume is the volume and mute an application was last given from the mixer
+type AppVolume struct {
+	Volume float32
+	Muted  bool
+	Locked bool // also undo changes made outside SoundShift, not only restore new sessions
+}
+
+// . appVolumesMu guards settings.AppVolumes. It is written on the Fyne goroutine and read
+// from the mixer monitor and the session event thread.
+var appVolumesMu sync.Mutex
+
+// . seenSessionIDs holds the sessions of the last snapshot, so publishSessions can tell
+// which sessions are new. Only touched on monitorMixer's thread.
+var seenSessionIDs = make(map[string]bool)
+
+// . appVolumeKey returns the AppVolumes key of an executable, or "" for sessions that
+// cannot be remembered (system sounds and sessions without an executable)
+func appVolumeKey(s policyConfig.AudioSession) string {
+	if s.IsSystem {
+		return ""
+	}
+	return strings.ToLower(s.ExePath)
+}
+
+// . rememberedAppVolume returns the remembered volume of a session's application
+func rememberedAppVolume(s policyConfig.AudioSession) (AppVolume, bool) {
+	key := appVolumeKey(s)
+	if key == "" {
+		return AppVolume{}, false
+	}
+	appVolumesMu.Lock()
+	defer appVolumesMu.Unlock()
+	v, ok := settings.AppVolumes[key]
+	return v, ok
+}
+
+// . rememberAppVolume records the volume and mute a mixer row was set to, keeping the
+// application's lock, and saves the settings shortly after. Must be called on the Fyne
+// goroutine.
+func rememberAppVolume(exePath string, volume float32, muted bool) {
+	key := strings.ToLower(exePath)
+	if key == "" {
+		return
+	}
+	appVolumesMu.Lock()
+	if settings.AppVolumes == nil {
+		settings.AppVolumes = make(map[string]AppVolume)
+	}
+	v := settings.AppVolumes[key]
+	v.Volume, v.Muted = volume, muted
+	settings.AppVolumes[key] = v
+	appVolumesMu.Unlock()
+	scheduleSettingsSave()
+}
+
+// . appVolumeLocked reports whether an application is locked to its remembered volume
+func appVolumeLocked(exePath string) bool {
+	appVolumesMu.Lock()
+	defer appVolumesMu.Unlock()
+	return settings.AppVolumes[strings.ToLower(exePath)].Locked
+}
+
+// . lockAppVolume locks or unlocks an application. Locking an application that has no
+// remembered volume yet remembers the current one. Must be called on the Fyne goroutine.
+func lockAppVolume(exePath string, locked bool, volume float32, muted bool) {
+	key := strings.ToLower(exePath)
+	if key == "" {
+		return
+	}
+	appVolumesMu.Lock()
+	if settings.AppVolumes == nil {
+		settings.AppVolumes = make(map[string]AppVolume)
+	}
+	v, ok := settings.AppVolumes[key]
+	if !ok {
+		v = AppVolume{Volume: volume, Muted: muted}
+	}
+	v.Locked = locked
+	settings.AppVolumes[key] = v
+	appVolumesMu.Unlock()
+	scheduleSettingsSave()
+	signal(mixerResync) // a newly locked app is pulled back to its volume right away
+}
+
+// . restoreAppVolumes gives remembered volumes to the sessions of a snapshot that were not
+// in the previous one, and to every session of a locked application that drifted from
+// its volume, never above the application's cap. Returns the snapshot with the levels
+// applied. Must run on monitorMixer's thread.
+func restoreAppVolumes(sessions []policyConfig.AudioSession) []policyConfig.AudioSession {
+	restored := make([]policyConfig.AudioSession, len(sessions))
+	copy(restored, sessions)
+
+	seen := make(map[string]bool, len(sessions))
+	for i, s := range restored {
+		seen[s.ID] = true
+		v, ok := rememberedAppVolume(s)
+		if !ok || (seenSessionIDs[s.ID] && !v.Locked) || sessionTurnedDown(s.ID) || duck.ducks(s.ID) || soloHolds(s.ID) {
+			continue
+		}
+		if volume := cappedVolume(s, v.Volume); volumesDiffer(s.Volume, volume) {
+			if err := backend.SetSessionVolume(s.ID, volume); err != nil {
+				general.LogError("Error restoring volume of "+s.Name, err)
+			} else {
+				restored[i].Volume = volume
+			}
+		}
+		if s.Muted != v.Muted {
+			if err := backend.SetSessionMute(s.ID, v.Muted); err != nil {
+				general.LogError("Error restoring mute of "+s.Name, err)
+			} else {
+				restored[i].Muted = v.Muted
+			}
+		}
+	}
+	seenSessionIDs = seen
+	return restored
+}
+
+// . appVolumeDrifted reports whether a session of a locked application was moved away
+// from its volume, by the application itself or another mixer
+func appVolumeDrifted(s policyConfig.AudioSession) bool {
+	v, ok := rememberedAppVolume(s)
+	return ok && v.Locked && (volumesDiffer(s.Volume, cappedVolume(s, v.Volume)) || s.Muted != v.Muted)
+}
+
+// . volumesDiffer compares two volume scalars, ignoring the rounding a backend may apply
+// when storing a volume
+func volumesDiffer(a, b float32) bool {
+	return max(a-b, b-a) > 0.005
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+const gameExe = `C:\Games\Game\game.exe`
+
+func TestMixerRemembersAppVolume(t *testing.T) {
+	useFakeBackend(t)
+	game := policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 1, ExePath: gameExe}
+	refreshMixerWithSessions([]policyConfig.AudioSession{game})
+
+	mixerSliders[0].SetValue(40)
+	mixerMuteButtons[0].OnTapped()
+	want := AppVolume{Volume: 0.4, Muted: true}
+	if got := settings.AppVolumes[`c:\games\game\game.exe`]; got != want {
+		t.Fatalf("remembered volume = %+v, want %+v", got, want)
+	}
+
+	// A change made outside SoundShift moves the slider but is not remembered
+	game.Volume = 0.9
+	refreshMixerWithSessions([]policyConfig.AudioSession{game})
+	if got := settings.AppVolumes[`c:\games\game\game.exe`]; got.Volume != 0.4 {
+		t.Errorf("remembered volume after an outside change = %v, want 0.4", got.Volume)
+	}
+}
+
+func TestPublishSessionsRestoresRememberedVolume(t *testing.T) {
+	fake := useFakeBackend(t)
+	settings.AppVolumes = map[string]AppVolume{`c:\games\game\game.exe`: {Volume: 0.3}}
+	fake.SetSessions(policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 1, ExePath: gameExe})
+
+	volumeOf := func(id string) float32 {
+		sessions, _ := fake.GetSessions()
+		for _, s := range sessions {
+			if s.ID == id {
+				return s.Volume
+			}
+		}
+		t.Fatalf("no session %s", id)
+		return 0
+	}
+
+	publishSessions()
+	if v := volumeOf("g1"); v != 0.3 {
+		t.Fatalf("new session volume = %v, want the remembered 0.3", v)
+	}
+
+	// Once restored, the session is left alone unless its app is locked
+	fake.SetSessionVolume("g1", 1)
+	publishSessions()
+	if v := volumeOf("g1"); v != 1 {
+		t.Errorf("seen session volume = %v, want it left at 1", v)
+	}
+
+	settings.AppVolumes[`c:\games\game\game.exe`] = AppVolume{Volume: 0.3, Locked: true}
+	publishSessions()
+	if v := volumeOf("g1"); v != 0.3 {
+		t.Errorf("locked session volume = %v, want it pulled back to 0.3", v)
+	}
+	cachedSessionsMu.Lock()
+	cached := cachedSessions[0].Volume
+	cachedSessionsMu.Unlock()
+	if cached != 0.3 {
+		t.Errorf("cached volume = %v, want the restored 0.3", cached)
+	}
+}
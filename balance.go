@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"soundshift/general"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . speakerNames are the channel names of the common speaker layouts, in the
+// WAVEFORMATEXTENSIBLE channel order endpoints report them in
+var speakerNames = map[int][]string{
+	2: {"Left", "Right"},
+	4: {"Front left", "Front right", "Rear left", "Rear right"},
+	6: {"Front left", "Front right", "Center", "Subwoofer", "Rear left", "Rear right"},
+	8: {"Front left", "Front right", "Center", "Subwoofer", "Rear left", "Rear right", "Side left", "Side right"},
+}
+
+// . channelWriteMu serialises channel writes so a fast drag cannot interleave the
+// read-modify-write of two balance changes
+var channelWriteMu sync.Mutex
+
+// . channelName returns the speaker name of a channel for a device with count channels
+func channelName(count, channel int) string {
+	if names, ok := speakerNames[count]; ok {
+		return names[channel]
+	}
+	return fmt.Sprintf("Channel %d", channel+1)
+}
+
+// . balanceOf returns the left/right balance of two channel levels in [-1, 1]:
+// negative leans left, positive leans right, 0 is centered
+func balanceOf(left, right float32) float64 {
+	switch {
+	case left == right:
+		return 0
+	case left > right:
+		return -float64(1 - right/left)
+	default:
+		return float64(1 - left/right)
+	}
+}
+
+// . balancedLevels splits the loudest level into left and right levels for a balance in
+// [-1, 1]; the louder side keeps the full level so the master volume does not move
+func balancedLevels(loudest float32, balance float64) (left, right float32) {
+	left, right = loudest, loudest
+	if balance > 0 {
+		left = loudest * float32(1-balance)
+	} else if balance < 0 {
+		right = loudest * float32(1+balance)
+	}
+	return left, right
+}
+
+// . showChannelPopup reads the channel levels of a device and pops up its balance or
+// per-channel controls over the flyout. The read runs off the Fyne goroutine.
+func showChannelPopup(btn fyne.CanvasObject, deviceID, name string) {
+	go func() {
+		levels, err := backend.GetChannelVolumes(deviceID)
+		if err != nil {
+			general.LogError("Error getting channel volumes for device "+deviceID, err)
+			return
+		}
+		fyne.Do(func() {
+			c := fyne.CurrentApp().Driver().CanvasForObject(btn)
+			if c == nil {
+				return
+			}
+			var popUp *widget.PopUp
+			done := widget.NewButton("Done", func() { popUp.Hide() })
+			popUp = widget.NewModalPopUp(container.NewVBox(
+				widget.NewLabelWithStyle(name, fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
+				channelControls(deviceID, levels),
+				done,
+			), c)
+			popUp.Resize(fyne.NewSize(240, popUp.MinSize().Height))
+			popUp.Show()
+		})
+	}()
+}
+
+// . channelControls builds the controls for a device's channels: a balance slider for
+// stereo devices and one slider per channel for surround devices
+func channelControls(deviceID string, levels []float32) fyne.CanvasObject {
+	switch {
+	case len(levels) < 2:
+		return widget.NewLabelWithStyle("This device has a single channel", fyne.TextAlignCenter, fyne.TextStyle{})
+	case len(levels) == 2:
+		return balanceSlider(deviceID, levels[0], levels[1])
+	}
+
+	rows := container.NewVBox()
+	for i, level := range levels {
+		channel := uint32(i)
+		slider := widget.NewSlider(0, 100)
+		slider.SetValue(float64(level * 100))
+		slider.OnChanged = func(f float64) {
+			level := float32(f / 100.0)
+			go func() {
+				channelWriteMu.Lock()
+				defer channelWriteMu.Unlock()
+				if err := backend.SetChannelVolume(deviceID, channel, level); err != nil {
+					general.LogError("Error setting channel volume", err)
+				}
+			}()
+		}
+		rows.Add(container.NewBorder(widget.NewLabel(channelName(len(levels), i)), nil, nil, nil, slider))
+	}
+	return rows
+}
+
+// . balanceSlider builds the left/right balance slider of a stereo device. Each change
+// re-reads the channels so the balance applies to the current master volume.
+func balanceSlider(deviceID string, left, right float32) fyne.CanvasObject {
+	slider := widget.NewSlider(-100, 100)
+	slider.SetValue(balanceOf(left, right) * 100)
+	slider.OnChanged = func(f float64) {
+		balance := f / 100
+		go func() {
+			channelWriteMu.Lock()
+			defer channelWriteMu.Unlock()
+			levels, err := backend.GetChannelVolumes(deviceID)
+			if err != nil {
+				general.LogError("Error getting channel volumes for device "+deviceID, err)
+				return
+			}
+			if len(levels) != 2 {
+				return // the device changed its channel layout since the popup opened
+			}
+			left, right := balancedLevels(max(levels[0], levels[1]), balance)
+			for channel, level := range []float32{left, right} {
+				if err := backend.SetChannelVolume(deviceID, uint32(channel), level); err != nil {
+					general.LogError("Error setting channel volume", err)
+					return
+				}
+			}
+		}()
+	}
+
+	center := widget.NewButton("Center", func() { slider.SetValue(0) })
+	return container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("L"), widget.NewLabel("R"), slider),
+		container.NewCenter(center),
+	)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+func TestBalanceRoundTrip(t *testing.T) {
+	for _, balance := range []float64{-1, -0.5, 0, 0.25, 1} {
+		left, right := balancedLevels(0.8, balance)
+		if max(left, right) != 0.8 {
+			t.Errorf("balance %v: levels %v/%v, want the louder side kept at 0.8", balance, left, right)
+		}
+		if got := balanceOf(left, right); got < balance-1e-6 || got > balance+1e-6 {
+			t.Errorf("balanceOf(balancedLevels(0.8, %v)) = %v", balance, got)
+		}
+	}
+}
+
+// findSliders returns the sliders inside obj, depth first.
+func findSliders(obj fyne.CanvasObject) []*widget.Slider {
+	switch o := obj.(type) {
+	case *widget.Slider:
+		return []*widget.Slider{o}
+	case *fyne.Container:
+		var sliders []*widget.Slider
+		for _, child := range o.Objects {
+			sliders = append(sliders, findSliders(child)...)
+		}
+		return sliders
+	}
+	return nil
+}
+
+func TestBalanceSliderKeepsMasterVolume(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetChannels("spk", 0.5, 0.5)
+
+	sliders := findSliders(channelControls("spk", []float32{0.5, 0.5}))
+	if len(sliders) != 1 || sliders[0].Value != 0 {
+		t.Fatalf("stereo device should get one centered balance slider, got %d", len(sliders))
+	}
+
+	sliders[0].SetValue(50) // half way to the right
+	waitFor(t, "the left channel to drop", func() bool {
+		levels, _ := fake.GetChannelVolumes("spk")
+		return levels[0] == 0.25 && levels[1] == 0.5
+	})
+	if v := fake.Volume("spk"); v != 0.5 {
+		t.Errorf("master volume = %v, want it unchanged at 0.5", v)
+	}
+}
+
+func TestSurroundDeviceGetsChannelSliders(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Receiver", Id: "avr", IsDefault: true})
+	fake.SetChannels("avr", 1, 1, 1, 1, 1, 1)
+
+	sliders := findSliders(channelControls("avr", []float32{1, 1, 1, 1, 1, 1}))
+	if len(sliders) != 6 {
+		t.Fatalf("5.1 device should get 6 channel sliders, got %d", len(sliders))
+	}
+	if name := channelName(6, 3); name != "Subwoofer" {
+		t.Errorf("channel 4 of 5.1 = %q, want Subwoofer", name)
+	}
+
+	sliders[2].SetValue(25)
+	waitFor(t, "the center channel to change", func() bool {
+		levels, _ := fake.GetChannelVolumes("avr")
+		return levels[2] == 0.25 && levels[0] == 1
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"soundshift/general"
+	"soundshift/interfaces/mmDeviceEnumerator"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . formatPicker is the "Default Format" dropdown of one device in the config window. The
+// formats load in the background since probing a device's supported formats is slow.
+type formatPicker struct {
+	deviceID string
+	Select   *widget.Select
+	formats  []mmDeviceEnumerator.DeviceFormat
+	current  mmDeviceEnumerator.DeviceFormat
+	loaded   bool
+}
+
+// . newFormatPicker creates a disabled dropdown and starts loading the device's formats into it
+func newFormatPicker(deviceID string) *formatPicker {
+	p := &formatPicker{deviceID: deviceID, Select: widget.NewSelect(nil, nil)}
+	p.Select.PlaceHolder = "Loading formats…"
+	p.Select.Disable()
+	go p.load()
+	return p
+}
+
+// . load reads the device's current and supported formats into the dropdown. Runs off the
+// Fyne goroutine.
+func (p *formatPicker) load() {
+	current, err := backend.GetDeviceFormat(p.deviceID)
+	if err != nil {
+		fyne.Do(func() {
+			p.Select.PlaceHolder = "Format unavailable"
+			p.Select.Disable()
+			p.Select.Refresh()
+		})
+		return
+	}
+	formats, err := backend.GetSupportedFormats(p.deviceID)
+	if err != nil {
+		formats = []mmDeviceEnumerator.DeviceFormat{current}
+	}
+	fyne.Do(func() { p.setFormats(current, formats) })
+}
+
+// . setFormats fills the dropdown and selects the current format. Must be called on the
+// Fyne goroutine.
+func (p *formatPicker) setFormats(current mmDeviceEnumerator.DeviceFormat, formats []mmDeviceEnumerator.DeviceFormat) {
+	p.current = current
+	p.formats = formats
+	p.loaded = true
+
+	options := make([]string, len(formats))
+	for i, format := range formats {
+		options[i] = format.String()
+	}
+	p.Select.Options = options
+	p.Select.Selected = current.String()
+	if len(formats) > 1 {
+		p.Select.Enable()
+	} else {
+		p.Select.Disable()
+	}
+	p.Select.Refresh()
+}
+
+// . selected returns the chosen format, or false when nothing new was chosen
+func (p *formatPicker) selected() (mmDeviceEnumerator.DeviceFormat, bool) {
+	if !p.loaded || p.Select.Selected == p.current.String() {
+		return mmDeviceEnumerator.DeviceFormat{}, false
+	}
+	for _, format := range p.formats {
+		if format.String() == p.Select.Selected {
+			return format, true
+		}
+	}
+	return mmDeviceEnumerator.DeviceFormat{}, false
+}
+
+// . apply switches the device to the chosen format, off the Fyne goroutine. Must be called
+// on the Fyne goroutine.
+func (p *formatPicker) apply() {
+	format, changed := p.selected()
+	if !changed {
+		return
+	}
+	p.current = format
+	deviceID := p.deviceID
+	go func() {
+		if err := backend.SetDeviceFormat(deviceID, format); err != nil {
+			general.LogError("Error setting device format for "+deviceID, err)
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"testing"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+func TestFormatPickerSwitchesDeviceFormat(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Interface", Id: "dac", IsDefault: true})
+	calls := mmDeviceEnumerator.DeviceFormat{SampleRate: 48000, BitsPerSample: 24, ContainerBits: 24, Channels: 2}
+	music := mmDeviceEnumerator.DeviceFormat{SampleRate: 96000, BitsPerSample: 24, ContainerBits: 24, Channels: 2}
+	fake.SetFormats("dac", calls, calls, music)
+
+	p := &formatPicker{deviceID: "dac", Select: widget.NewSelect(nil, nil)}
+	p.load()
+	if len(p.Select.Options) != 2 || p.Select.Selected != "24 bit, 48000 Hz" {
+		t.Fatalf("options = %v, selected %q; want both formats with 48 kHz selected", p.Select.Options, p.Select.Selected)
+	}
+
+	p.apply() // nothing chosen yet
+	p.Select.SetSelected("24 bit, 96000 Hz")
+	p.apply()
+	waitFor(t, "the device to switch to 96 kHz", func() bool {
+		format, _ := fake.GetDeviceFormat("dac")
+		return format == music
+	})
+}
+
+func TestFormatPickerStaysDisabledForSingleFormat(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+
+	p := &formatPicker{deviceID: "spk", Select: widget.NewSelect(nil, nil)}
+	p.load()
+	if p.Select.Selected != "16 bit, 48000 Hz" || !p.Select.Disabled() {
+		t.Errorf("selected %q; a device with a single format should show it with nothing to choose from", p.Select.Selected)
+	}
+	if _, changed := p.selected(); changed {
+		t.Error("nothing should count as chosen")
+	}
+}
+
+func TestFormatPickerShowsUnavailableFormat(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Remote Audio", Id: "rdp", IsDefault: true})
+	fake.SetInaccessible("rdp", true)
+
+	p := &formatPicker{deviceID: "rdp", Select: widget.NewSelect(nil, nil)}
+	p.load()
+	if p.Select.PlaceHolder != "Format unavailable" || !p.Select.Disabled() {
+		t.Errorf("placeholder = %q; an unreadable device should say its format is unavailable", p.Select.PlaceHolder)
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"slices"
+	"soundshift/fyneCustom"
+	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . Device state shared between the device refresh loop and the UI
+var configWindowOpen atomic.Bool // replaces plain bool; safe for concurrent read from goroutines
+var currentDeviceID string
+var audioDevices []mmDeviceEnumerator.AudioDevice
+var captureDevices []mmDeviceEnumerator.AudioDevice
+
+// . mu protects audioDevices, captureDevices and currentDeviceID which are accessed from multiple goroutines.
+// Rule: never hold mu while calling fyne.Do.
+var mu sync.Mutex
+
+// . filterValidDevices filters out disabled and inaccessible devices while always including Remote Audio.
+func filterValidDevices(devices []mmDeviceEnumerator.AudioDevice) []mmDeviceEnumerator.AudioDevice {
+	valid := make([]mmDeviceEnumerator.AudioDevice, 0, len(devices))
+	var remoteAudio *mmDeviceEnumerator.AudioDevice
+	for _, device := range devices {
+		if device.IsDisabled {
+			continue
+		}
+		if device.Name == "Remote Audio" {
+			copy := device
+			remoteAudio = &copy
+			continue
+		}
+		if _, err := backend.GetVolume(device.Id); err == nil {
+			valid = append(valid, device)
+		}
+	}
+	if remoteAudio != nil {
+		valid = append(valid, *remoteAudio)
+	}
+	return valid
+}
+
+// . setDeviceEnabled enables or disables a device off the Fyne goroutine, then refreshes the
+// device list so it appears in or disappears from the flyout
+func setDeviceEnabled(deviceID string, enabled bool) {
+	go func() {
+		if err := backend.SetDeviceEnabled(deviceID, enabled); err != nil {
+			general.LogError("Error enabling or disabling device "+deviceID, err)
+			return
+		}
+		requestDeviceRefresh()
+	}()
+}
+
+// . checkAndUpdateDevices checks for changes in the list of audio devices and updates the UI if changes are detected
+func checkAndUpdateDevices() {
+	//* Retrieve the current list of audio devices
+	newAudioDevices, err := backend.GetDevices()
+	if err != nil || newAudioDevices == nil {
+		fmt.Println("Error getting audio devices:", err)
+		general.LogError("Error getting audio devices:", err)
+		return
+	}
+
+	newCaptureDevices := getCaptureDevices()
+	validDevices := filterValidDevices(newAudioDevices)
+	validCaptureDevices := filterValidDevices(newCaptureDevices)
+
+	//* Check for changes and whether config window is open — hold lock briefly
+	mu.Lock()
+	changed := !audioDevicesEqual(audioDevices, validDevices) || !audioDevicesEqual(captureDevices, validCaptureDevices)
+	open := configWindowOpen.Load()
+	if changed && !open {
+		audioDevices = validDevices
+		captureDevices = validCaptureDevices
+		currentDeviceID = ""
+	}
+	mu.Unlock()
+
+	if changed && !open {
+		//* Give new devices their entries on the Fyne goroutine, which owns the settings
+		currentDevices := slices.Concat(newAudioDevices, newCaptureDevices)
+		fyne.Do(func() {
+			if settings.DeviceNames == nil {
+				settings.DeviceNames = make(map[string]DeviceConfig)
+			}
+			mergeDeviceNames(settings.DeviceNames, currentDevices)
+			renderButtons()
+			if isMainWindowVisible() {
+				resizeOnUI()
+			}
+		})
+	}
+}
+
+// . deviceEvents is signalled by the Windows device notification sink. It holds at most
+// one pending signal, so a burst of events (plugging in a headset fires added, state,
+// default and property changes back to back) collapses into a single refresh.
+var deviceEvents = make(chan struct{}, 1)
+
+// . Device refresh timing: events are the primary trigger, polling is only a safety net
+// in case the sink misses a change or cannot be registered at all.
+const (
+	deviceEventSettle    = 150 * time.Millisecond // let a burst of notifications finish before re-enumerating
+	devicePollFallback   = 30 * time.Second       // safety-net poll while notifications are working
+	devicePollNoNotifier = 3 * time.Second        // poll interval when the notification sink is unavailable
+)
+
+// . signal performs a non-blocking send on a one-slot wake-up channel; a pending
+// signal already covers the new one
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// . requestDeviceRefresh asks updateDevices to re-enumerate devices without blocking
+func requestDeviceRefresh() {
+	signal(deviceEvents)
+}
+
+// . updateDevices refreshes the device list whenever Windows reports a device change,
+// falling back to periodic polling
+func updateDevices() {
+	// Force an immediate fresh device list retrieval on startup
+	freshDevices, err := backend.GetDevices()
+	if err == nil && freshDevices != nil {
+		validDevices := filterValidDevices(freshDevices)
+		validCaptureDevices := filterValidDevices(getCaptureDevices())
+
+		mu.Lock()
+		audioDevices = validDevices
+		captureDevices = validCaptureDevices
+		mu.Unlock()
+
+		fyne.Do(func() {
+			renderButtons()
+			if isMainWindowVisible() {
+				resizeOnUI()
+			}
+		})
+	}
+
+	// The notification sink is registered from a backend-bound thread,
+	// matching how monitorMixer owns its COM thread.
+	defer backend.BindThread()()
+
+	pollInterval := devicePollFallback
+	notifier, err := backend.WatchDevices(func(ev mmDeviceEnumerator.DeviceEvent) {
+		// Runs on a backend audio thread; signalling never blocks
+		requestDeviceRefresh()
+		switch ev.Kind {
+		case mmDeviceEnumerator.DeviceAdded, mmDeviceEnumerator.DeviceRemoved, mmDeviceEnumerator.DeviceStateChanged:
+			signal(mixerDeviceChanged) // the session watcher covers every active output device
+		case mmDeviceEnumerator.DefaultDeviceChanged:
+			if ev.Flow == mmDeviceEnumerator.FlowRender && ev.Role == mmDeviceEnumerator.RoleConsole {
+				signal(mixerDeviceChanged) // the mixer lists the default device's sessions first
+			}
+		}
+	})
+	if err != nil {
+		general.LogError("Device notifications unavailable, polling instead", err)
+		pollInterval = devicePollNoNotifier
+	} else {
+		defer notifier.Close()
+	}
+
+	// Set up the ticker for fallback device updates
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-deviceEvents:
+			time.Sleep(deviceEventSettle)
+			select {
+			case <-deviceEvents: // drop a signal raised during the settle delay
+			default:
+			}
+			checkAndUpdateDevices()
+		case <-ticker.C:
+			checkAndUpdateDevices()
+		}
+	}
+}
+
+// . renderButtons dynamically creates and updates buttons for each audio device in the UI.
+// Must be called on the Fyne goroutine (directly or inside fyne.Do).
+func renderButtons() {
+	//* Snapshot shared state under the lock so we don't hold it during UI work
+	mu.Lock()
+	devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
+	copy(devices, audioDevices)
+	prevDeviceID := currentDeviceID
+	mu.Unlock()
+
+	newDeviceVbox := container.New(&fyneCustom.CustomVBoxLayout{FixedWidth: 150})
+
+	// Track the new device ID and slider state we will commit at the end
+	var newDeviceID string
+	newSliderDisabled := false
+	newSliderValue := float64(100)
+	newMuted := false
+
+	//* Create a button for each audio device
+	for _, device := range devices {
+		//* Retrieve device configuration (use defaults if config does not exist)
+		config, exists := settings.DeviceNames[device.Id]
+		if !exists {
+			config = DeviceConfig{Name: device.Name, IsShown: true}
+		}
+
+		//* Skip device if it is marked as hidden
+		if !config.IsShown {
+			continue
+		}
+
+		//* Get a truncated version of the device name for display
+		deviceName := general.EllipticalTruncate(config.Name, 15)
+
+		//* Create the button tap handler for selecting a device
+		onTapped := createDeviceButtonHandler(device.Id, false)
+
+		//* Add button for the device to newDeviceVbox
+		if device.IsDefault {
+			if device.Name == "Remote Audio" {
+				newDeviceVbox.Add(newDeviceButton(deviceName+" (RDP)", theme.VolumeUpIcon(), device, func() {
+					fyne.CurrentApp().SendNotification(&fyne.Notification{
+						Title:   "Remote Audio",
+						Content: "Remote Audio device may not support volume/mute control over RDP.",
+					})
+					onTapped()
+				}))
+				volume, err := backend.GetVolume(device.Id)
+				if err == nil {
+					newDeviceID = device.Id
+					newSliderDisabled = false
+					newSliderValue = float64(volume * 100)
+					muted, err := backend.GetMute(device.Id)
+					newMuted = err == nil && muted
+				} else {
+					newDeviceID = device.Id
+					newSliderDisabled = true
+					newSliderValue = 100
+				}
+			} else {
+				newDeviceVbox.Add(newDeviceButton(deviceName, theme.VolumeUpIcon(), device, onTapped))
+				volume, err := backend.GetVolume(device.Id)
+				if err != nil {
+					fmt.Printf("Error getting volume for device %s: %v\n", device.Id, err)
+				} else {
+					//* Mid-fade, the slider shows where the fade is heading
+					if target, fading := fader.Target(audioBackend.Endpoint(device.Id)); fading {
+						volume = target
+					}
+					newDeviceID = device.Id
+					newSliderDisabled = false
+					newSliderValue = float64(volume * 100)
+					muted, err := backend.GetMute(device.Id)
+					if err != nil {
+						fmt.Printf("Error getting mute state for device %s: %v\n", device.Id, err)
+					}
+					newMuted = err == nil && muted
+				}
+			}
+		} else {
+			if device.Name == "Remote Audio" {
+				newDeviceVbox.Add(newDeviceButton(deviceName+" (RDP)", communicationsIcon(device), device, func() {
+					fyne.CurrentApp().SendNotification(&fyne.Notification{
+						Title:   "Remote Audio",
+						Content: "Remote Audio device may not support volume/mute control over RDP.",
+					})
+					onTapped()
+				}))
+				// If Remote Audio was the previously selected device, keep slider disabled
+				if prevDeviceID == device.Id {
+					newSliderDisabled = true
+					newSliderValue = 100
+				}
+			} else {
+				newDeviceVbox.Add(newDeviceButton(deviceName, communicationsIcon(device), device, onTapped))
+			}
+		}
+	}
+
+	//* Commit the new device ID under the lock
+	mu.Lock()
+	deviceChanged := currentDeviceID != newDeviceID
+	currentDeviceID = newDeviceID
+	mu.Unlock()
+
+	//* Move the volume callback to the new device
+	if deviceChanged {
+		signal(currentDeviceChanged)
+	}
+
+	//* Apply slider state
+	volumeSlider.Disabled = newSliderDisabled
+	if newSliderDisabled {
+		volumeSlider.Disable()
+	} else {
+		volumeSlider.Enable()
+	}
+	volumeSlider.SetValue(newSliderValue)
+	setMasterMuted(newMuted)
+
+	//* Refresh the container only once after adding all buttons
+	newDeviceVbox.Refresh()
+
+	//* Replace the old deviceVbox with the new one
+	deviceVboxPlaceholder.Objects = []fyne.CanvasObject{newDeviceVbox}
+	deviceVboxPlaceholder.Refresh()
+
+	//* Recording devices live in their own section below the master slider
+	renderInputButtons()
+}
+
+// . renderInputButtons creates a button for each recording device in the input section of the UI.
+// Must be called on the Fyne goroutine (directly or inside fyne.Do).
+func renderInputButtons() {
+	//* Snapshot shared state under the lock so we don't hold it during UI work
+	mu.Lock()
+	devices := make([]mmDeviceEnumerator.AudioDevice, len(captureDevices))
+	copy(devices, captureDevices)
+	mu.Unlock()
+
+	newInputVbox := container.New(&fyneCustom.CustomVBoxLayout{FixedWidth: 150})
+	for _, device := range devices {
+		//* Recording devices share the rename/hide settings with output devices
+		config, exists := settings.DeviceNames[device.Id]
+		if !exists {
+			config = DeviceConfig{Name: device.Name, IsShown: true}
+		}
+		if !config.IsShown {
+			continue
+		}
+
+		deviceName := general.EllipticalTruncate(config.Name, 15)
+		onTapped := createDeviceButtonHandler(device.Id, true)
+		if device.IsDefault {
+			newInputVbox.Add(newDeviceButton(deviceName, theme.MediaRecordIcon(), device, onTapped))
+		} else {
+			newInputVbox.Add(newDeviceButton(deviceName, communicationsIcon(device), device, onTapped))
+		}
+	}
+
+	//* Hide the whole section (label included) when no recording device is shown
+	if len(newInputVbox.Objects) == 0 {
+		inputSection.Objects = nil
+		inputSection.Refresh()
+		return
+	}
+
+	inputLabel := canvas.NewText("Input", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xb0})
+	inputLabel.TextSize = 12
+	inputSection.Objects = []fyne.CanvasObject{
+		&canvas.Line{StrokeColor: color.NRGBA{R: 0x30, G: 0x30, B: 0x30, A: 0xCC}, StrokeWidth: 1},
+		container.NewCenter(inputLabel),
+		newInputVbox,
+	}
+	inputSection.Refresh()
+}
+
+// . communicationsIcon returns the icon marking a non-default device that is the
+// default communications device, or nil when it isn't
+func communicationsIcon(device mmDeviceEnumerator.AudioDevice) fyne.Resource {
+	if device.IsDefaultCommunications {
+		return theme.AccountIcon()
+	}
+	return nil
+}
+
+// . newDeviceButton creates a device button whose right-click menu switches the
+// default device and the default communications device independently, and opens
+// the device's channel balance
+func newDeviceButton(label string, icon fyne.Resource, device mmDeviceEnumerator.AudioDevice, onTapped func()) fyne.CanvasObject {
+	btn := fyneCustom.NewDeviceButton(label, icon, onTapped, nil)
+	btn.OnTappedSecondary = func(ev *fyne.PointEvent) {
+		defaultItem := fyne.NewMenuItem("Set as default device", createDeviceButtonHandler(device.Id, device.IsCapture, mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia))
+		defaultItem.Checked = device.IsDefault
+		commsItem := fyne.NewMenuItem("Set as default communication device", createDeviceButtonHandler(device.Id, device.IsCapture, mmDeviceEnumerator.RoleCommunications))
+		commsItem.Checked = device.IsDefaultCommunications
+		balanceItem := fyne.NewMenuItem("Channel balance…", func() { showChannelPopup(btn, device.Id, label) })
+		canvasForBtn := fyne.CurrentApp().Driver().CanvasForObject(btn)
+		if canvasForBtn == nil {
+			return
+		}
+		widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", defaultItem, commsItem, fyne.NewMenuItemSeparator(), balanceItem), canvasForBtn, ev.AbsolutePosition)
+	}
+	return btn
+}
+
+// . getCaptureDevices returns the active recording devices. A machine without any
+// microphone has no default capture endpoint, which is reported as an empty list.
+func getCaptureDevices() []mmDeviceEnumerator.AudioDevice {
+	devices, err := backend.GetCaptureDevices()
+	if err != nil {
+		return nil
+	}
+	return devices
+}
+
+// . audioDevicesEqual performs a fast comparison of AudioDevice slices without reflection
+func audioDevicesEqual(a, b []mmDeviceEnumerator.AudioDevice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name ||
+			a[i].Id != b[i].Id ||
+			a[i].IsDefault != b[i].IsDefault ||
+			a[i].IsDefaultMultimedia != b[i].IsDefaultMultimedia ||
+			a[i].IsDefaultCommunications != b[i].IsDefaultCommunications {
+			return false
+		}
+	}
+	return true
+}
+
+// . currentDeviceChanged is signalled whenever renderButtons commits a different
+// currentDeviceID, so monitorMasterVolume can move its volume callback
+var currentDeviceChanged = make(chan struct{}, 1)
+
+// . monitorMasterVolume keeps an endpoint volume callback registered on the current
+// device and pushes volume/mute changes into the master slider as they happen, including
+// changes made via keyboard volume keys while the window is hidden.
+func monitorMasterVolume() {
+	// Registration happens on a dedicated backend thread, like monitorMixer.
+	defer backend.BindThread()()
+
+	var watcher audioBackend.Watcher
+	var watchedID string
+	defer func() {
+		if watcher != nil {
+			watcher.Close()
+		}
+	}()
+
+	for {
+		mu.Lock()
+		devID := currentDeviceID
+		mu.Unlock()
+
+		if devID != watchedID {
+			if watcher != nil {
+				watcher.Close()
+				watcher = nil
+			}
+			watchedID = devID
+
+			if devID != "" {
+				w, err := backend.WatchEndpointVolume(devID, onMasterVolumeNotify)
+				if err != nil {
+					// Inaccessible devices (e.g. Remote Audio over RDP) have no volume
+					// control; renderButtons has already disabled the slider for them.
+					general.LogError("Error watching volume for device "+devID, err)
+				} else {
+					watcher = w
+				}
+			}
+		}
+
+		<-currentDeviceChanged
+	}
+}
+
+// . onMasterVolumeNotify applies an endpoint volume notification to the master slider and
+// mute button. Runs on a Windows audio thread, so all UI work is handed to fyne.Do.
+func onMasterVolumeNotify(n policyConfig.VolumeNotification) {
+	// Our own slider writes echo back here; re-applying them would fight the user.
+	if n.FromSelf {
+		return
+	}
+	fyne.Do(func() {
+		mu.Lock()
+		isCurrent := currentDeviceID == n.DeviceID
+		mu.Unlock()
+
+		if !isCurrent {
+			return
+		}
+		setMasterMuted(n.Muted)
+		// Skip external updates while the user is dragging the slider so a
+		// notification cannot snap the thumb back mid-drag.
+		if !volumeSlider.IsDragging() {
+			volumeSlider.SetValue(float64(n.Volume * 100))
+		}
+	})
+}
+
+// . isDefaultOutput reports whether deviceID is already the default output device
+func isDefaultOutput(deviceID string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, device := range audioDevices {
+		if device.Id == deviceID {
+			return device.IsDefault
+		}
+	}
+	return false
+}
+
+// . fadesInOnSwitch reports whether making deviceID the default for roles fades it in.
+// Only moving the console/multimedia default output does; a communications switch leaves
+// what is playing where it is. Must be called on the Fyne goroutine.
+func fadesInOnSwitch(deviceID string, capture bool, roles []uint32) bool {
+	movesDefault := slices.Contains(roles, mmDeviceEnumerator.RoleConsole) || slices.Contains(roles, mmDeviceEnumerator.RoleMultimedia)
+	return !capture && movesDefault && fadeDuration() > 0 && !isDefaultOutput(deviceID)
+}
+
+// . createDeviceButtonHandler creates a button tap handler for device selection.
+// capture selects which list (output or recording devices) the device belongs to.
+// roles limits the switch to specific roles; when omitted, the roles follow
+// the KeepCommunicationsDevice setting.
+func createDeviceButtonHandler(deviceID string, capture bool, roles ...uint32) func() {
+	return func() {
+		setRoles := roles
+		if len(setRoles) == 0 {
+			setRoles = []uint32{mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia, mmDeviceEnumerator.RoleCommunications}
+			if settings.KeepCommunicationsDevice {
+				setRoles = []uint32{mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia}
+			}
+		}
+		//* With fades on, a newly chosen output starts silent and fades in instead of
+		//* popping in at full volume
+		fadeIn, level := fadesInOnSwitch(deviceID, capture, setRoles), float32(0)
+		if fadeIn {
+			var err error
+			level, err = backend.GetVolume(deviceID)
+			if err == nil {
+				err = backend.SetVolume(deviceID, 0)
+			}
+			fadeIn = err == nil
+		}
+
+		if err := backend.SetDefaultDevice(deviceID, setRoles...); err != nil {
+			fmt.Println("Error setting default endpoint:", err)
+			general.LogError("Error setting default endpoint:", err)
+			if fadeIn {
+				backend.SetVolume(deviceID, level)
+			}
+			return
+		}
+		if fadeIn {
+			fader.Fade(audioBackend.Endpoint(deviceID), 0, level, fadeDuration(), logFadeError)
+		}
+
+		// Optimistically update the per-role default flags for immediate visual feedback
+		mu.Lock()
+		devices := audioDevices
+		if capture {
+			devices = captureDevices
+		}
+		for i := range devices {
+			isTarget := devices[i].Id == deviceID
+			for _, role := range setRoles {
+				switch role {
+				case mmDeviceEnumerator.RoleConsole:
+					devices[i].IsDefault = isTarget
+				case mmDeviceEnumerator.RoleMultimedia:
+					devices[i].IsDefaultMultimedia = isTarget
+				case mmDeviceEnumerator.RoleCommunications:
+					devices[i].IsDefaultCommunications = isTarget
+				}
+			}
+		}
+		mu.Unlock()
+		renderButtons()
+
+		// After OS has had time to settle, confirm with a fresh device list
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			var newDevices []mmDeviceEnumerator.AudioDevice
+			var err error
+			if capture {
+				newDevices, err = backend.GetCaptureDevices()
+			} else {
+				newDevices, err = backend.GetDevices()
+			}
+			if err == nil && newDevices != nil {
+				valid := filterValidDevices(newDevices)
+				mu.Lock()
+				if capture {
+					captureDevices = valid
+				} else {
+					audioDevices = valid
+				}
+				mu.Unlock()
+				fyne.Do(func() {
+					renderButtons()
+				})
+			}
+			if settings.HideAfterSelection {
+				hideMainWindow()
+			}
+		}()
+	}
+}
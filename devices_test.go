@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"soundshift/file"
+	"soundshift/fyneCustom"
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+// testBackend is the backend for every test. It is installed once in TestMain rather than per
+// test: mixer writes run on goroutines that can outlive the test that started them.
+var testBackend = audioBackend.NewFake()
+
+func TestMain(m *testing.M) {
+	backend = testBackend
+	fader = audioBackend.NewFader(backend)
+	os.Exit(m.Run())
+}
+
+// useFakeBackend resets the fake backend, installs a headless Fyne app and an empty
+// settings directory, and resets the shared device/mixer state.
+func useFakeBackend(t *testing.T) *audioBackend.Fake {
+	t.Helper()
+	test.NewTempApp(t)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	os.MkdirAll(file.RoamingDir()+"/soundshift", os.ModePerm) // LogError writes here
+
+	testBackend.Reset()
+
+	settings = AppSettings{}
+	mu.Lock()
+	audioDevices = nil
+	captureDevices = nil
+	currentDeviceID = ""
+	mu.Unlock()
+	configWindowOpen.Store(false)
+	mixerSessionKeys = nil
+	mixerRowIDs = nil
+	mixerExpanded = make(map[mixerKey]bool)
+	seenSessionIDs = make(map[string]bool)
+	turnedDown = make(map[string]backgroundSession)
+	duck = newDucker()
+	volumeCaps.Store(nil)
+	soloIDs, soloExe, soloSaved = nil, "", make(map[string]bool)
+	t.Cleanup(func() {
+		if settingsSaveTimer != nil {
+			settingsSaveTimer.Stop()
+		}
+	})
+	mixerSection.Objects = nil
+	select {
+	case <-currentDeviceChanged:
+	default:
+	}
+	return testBackend
+}
+
+// shownDeviceLabels returns the labels of the output device buttons currently rendered.
+func shownDeviceLabels(t *testing.T) []string {
+	t.Helper()
+	if len(deviceVboxPlaceholder.Objects) != 1 {
+		t.Fatalf("device placeholder holds %d objects, want 1", len(deviceVboxPlaceholder.Objects))
+	}
+	var labels []string
+	for _, obj := range deviceVboxPlaceholder.Objects[0].(*fyne.Container).Objects {
+		labels = append(labels, obj.(*fyneCustom.DeviceButton).Text)
+	}
+	return labels
+}
+
+func TestCheckAndUpdateDevicesPicksUpNewDevices(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs", IsDefaultCommunications: true},
+	)
+	fake.SetEndpointState("spk", 0.42, false)
+
+	checkAndUpdateDevices()
+
+	mu.Lock()
+	gotDevices, gotCurrent := len(audioDevices), currentDeviceID
+	mu.Unlock()
+	if gotDevices != 2 {
+		t.Fatalf("audioDevices has %d entries, want 2", gotDevices)
+	}
+	if gotCurrent != "spk" {
+		t.Errorf("currentDeviceID = %q, want %q", gotCurrent, "spk")
+	}
+	if labels := shownDeviceLabels(t); len(labels) != 2 || labels[0] != "Speakers" || labels[1] != "Headset" {
+		t.Errorf("rendered buttons = %v, want [Speakers Headset]", labels)
+	}
+	if volumeSlider.Value != 42 {
+		t.Errorf("master slider = %v, want 42", volumeSlider.Value)
+	}
+	select {
+	case <-currentDeviceChanged:
+	default:
+		t.Error("currentDeviceChanged was not signalled for the new current device")
+	}
+}
+
+func TestCheckAndUpdateDevicesFiltersInaccessibleDevices(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk"},
+		mmDeviceEnumerator.AudioDevice{Name: "Broken", Id: "broken"},
+		mmDeviceEnumerator.AudioDevice{Name: "Remote Audio", Id: "rdp", IsDefault: true},
+	)
+	fake.SetInaccessible("broken", true)
+	fake.SetInaccessible("rdp", true)
+
+	checkAndUpdateDevices()
+
+	// Remote Audio is kept (and moved last) even though its volume is unreachable
+	if labels := shownDeviceLabels(t); len(labels) != 2 || labels[0] != "Speakers" || labels[1] != "Remote Audio (RDP)" {
+		t.Fatalf("rendered buttons = %v, want [Speakers Remote Audio (RDP)]", labels)
+	}
+	if !volumeSlider.Disabled {
+		t.Error("master slider should be disabled for an inaccessible Remote Audio device")
+	}
+}
+
+func TestDisabledDevicesStayOutOfTheFlyoutUntilEnabled(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Monitor", Id: "mon", IsDisabled: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Remote Audio", Id: "rdp", IsDisabled: true},
+	)
+	saveSettings()
+
+	checkAndUpdateDevices()
+	if labels := shownDeviceLabels(t); len(labels) != 1 || labels[0] != "Speakers" {
+		t.Fatalf("rendered buttons = %v, want [Speakers]", labels)
+	}
+
+	setDeviceEnabled("mon", true)
+	waitFor(t, "the monitor to be enabled", func() bool {
+		_, err := fake.GetVolume("mon")
+		return err == nil
+	})
+	checkAndUpdateDevices()
+	if labels := shownDeviceLabels(t); len(labels) != 2 || labels[1] != "Monitor" {
+		t.Errorf("rendered buttons = %v, want [Speakers Monitor]", labels)
+	}
+}
+
+func TestCheckAndUpdateDevicesHidesDevicesMarkedHidden(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Monitor", Id: "mon"},
+	)
+	settings = AppSettings{DeviceNames: map[string]DeviceConfig{
+		"spk": {Name: "Desk", IsShown: true, OriginalName: "Speakers"},
+		"mon": {Name: "Monitor", IsShown: false, OriginalName: "Monitor"},
+	}}
+	saveSettings()
+
+	checkAndUpdateDevices()
+
+	if labels := shownDeviceLabels(t); len(labels) != 1 || labels[0] != "Desk" {
+		t.Errorf("rendered buttons = %v, want [Desk]", labels)
+	}
+}
+
+func TestCheckAndUpdateDevicesKeepsUnsavedSettings(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	settings = AppSettings{DeviceNames: map[string]DeviceConfig{
+		"spk": {Name: "Desk", IsShown: true, OriginalName: "Speakers"},
+	}}
+	saveSettings()
+	checkAndUpdateDevices()
+
+	// A volume remembered while the batched save is still pending
+	rememberAppVolume(`c:\games\game.exe`, 0.3, false)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs"},
+	)
+	checkAndUpdateDevices()
+
+	game := policyConfig.AudioSession{ExePath: `c:\games\game.exe`}
+	if v, ok := rememberedAppVolume(game); !ok || v.Volume != 0.3 {
+		t.Errorf("remembered volume after a device change = %+v, %v; want 0.3", v, ok)
+	}
+	if got := settings.DeviceNames["hs"]; got.Name != "Headset" || !got.IsShown {
+		t.Errorf("entry of the new device = %+v, want a shown Headset", got)
+	}
+	if labels := shownDeviceLabels(t); len(labels) != 2 || labels[0] != "Desk" {
+		t.Errorf("rendered buttons = %v, want [Desk Headset]", labels)
+	}
+}
+
+func TestCheckAndUpdateDevicesDefersWhileConfigWindowOpen(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	checkAndUpdateDevices()
+
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs"},
+	)
+	configWindowOpen.Store(true)
+	checkAndUpdateDevices()
+
+	mu.Lock()
+	got := len(audioDevices)
+	mu.Unlock()
+	if got != 1 {
+		t.Fatalf("audioDevices changed to %d entries while the config window was open", got)
+	}
+
+	configWindowOpen.Store(false)
+	checkAndUpdateDevices()
+	mu.Lock()
+	got = len(audioDevices)
+	mu.Unlock()
+	if got != 2 {
+		t.Errorf("audioDevices has %d entries after the config window closed, want 2", got)
+	}
+}
+
+func TestCheckAndUpdateDevicesKeepsStateOnError(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	checkAndUpdateDevices()
+
+	fake.SetDevicesError(errors.New("audio service stopped"))
+	checkAndUpdateDevices()
+
+	mu.Lock()
+	got, current := len(audioDevices), currentDeviceID
+	mu.Unlock()
+	if got != 1 || current != "spk" {
+		t.Errorf("state after a failed enumeration = %d devices, current %q; want 1, %q", got, current, "spk")
+	}
+}
+
+func TestCheckAndUpdateDevicesIncludesRecordingDevices(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetCaptureDevices(mmDeviceEnumerator.AudioDevice{Name: "Microphone", Id: "mic", IsDefault: true})
+
+	checkAndUpdateDevices()
+
+	mu.Lock()
+	got := len(captureDevices)
+	mu.Unlock()
+	if got != 1 {
+		t.Fatalf("captureDevices has %d entries, want 1", got)
+	}
+	if len(inputSection.Objects) == 0 {
+		t.Error("input section was not rendered for the recording device")
+	}
+}
+
+func TestMutedDeviceShowsRealLevel(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetEndpointState("spk", 0.75, true)
+
+	checkAndUpdateDevices()
+
+	if volumeSlider.Value != 75 {
+		t.Errorf("master slider = %v, want the real level 75 while muted", volumeSlider.Value)
+	}
+	if !masterMuteButton.Active {
+		t.Error("master mute button should be active for a muted device")
+	}
+}
+
+func TestMasterMuteButtonTogglesMute(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetEndpointState("spk", 0.5, false)
+	checkAndUpdateDevices()
+
+	masterMuteButton.Tapped(nil)
+	if !masterMuteButton.Active {
+		t.Error("mute button should turn active immediately")
+	}
+	waitFor(t, "the device to be muted", func() bool {
+		muted, _ := fake.GetMute("spk")
+		return muted
+	})
+	if volumeSlider.Value != 50 {
+		t.Errorf("master slider = %v, want it unchanged at 50", volumeSlider.Value)
+	}
+
+	masterMuteButton.Tapped(nil)
+	waitFor(t, "the device to be unmuted", func() bool {
+		muted, _ := fake.GetMute("spk")
+		return !muted
+	})
+}
+
+func TestMasterVolumeNotifyAppliesExternalMute(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	checkAndUpdateDevices()
+
+	onMasterVolumeNotify(policyConfig.VolumeNotification{DeviceID: "spk", Volume: 0.25, Muted: true})
+
+	if volumeSlider.Value != 25 || !masterMuteButton.Active {
+		t.Errorf("slider = %v, mute active = %v; want 25 and muted", volumeSlider.Value, masterMuteButton.Active)
+	}
+}
+
+func TestDeviceSwitchFadesInOnlyWhenTheDefaultMoves(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true, IsDefaultMultimedia: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs"},
+	)
+	settings.FadeMilliseconds = 100
+	checkAndUpdateDevices()
+
+	all := []uint32{mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia, mmDeviceEnumerator.RoleCommunications}
+	if !fadesInOnSwitch("hs", false, all) {
+		t.Error("making the headset the default output should fade it in")
+	}
+	if fadesInOnSwitch("hs", false, []uint32{mmDeviceEnumerator.RoleCommunications}) {
+		t.Error("a communications switch should leave the headset's level alone")
+	}
+	if fadesInOnSwitch("spk", false, all) {
+		t.Error("the default output should not fade in again")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// . Ducking lowers the other mixer sessions while a trigger app, such as a voice chat, is
+// making sound, which the Windows communications ducking only does for some apps
+type Ducking struct {
+	Enabled     bool
+	Triggers    []string // names or globs of the apps whose sound ducks the others
+	Amount      int      // percent the other sessions are lowered by
+	HoldSeconds float64  // how long the others stay lowered after the trigger apps fall silent
+}
+
+// . Ducking timing: levels are sampled every duckInterval, and the other sessions glide
+// towards their target level instead of jumping, faster down than back up
+const (
+	duckInterval  = 50 * time.Millisecond
+	duckThreshold = 0.02 // peak above which a trigger app counts as making sound
+	duckAttack    = 0.35 // share of the way to the ducked level covered per interval
+	duckRelease   = 0.12 // share of the way back to full volume covered per interval
+)
+
+// . duckAmounts and duckHolds are the choices of the config window's ducking dropdowns
+var (
+	duckAmounts = []int{25, 50, 75, 90}
+	duckHolds   = []float64{0.5, 1, 2, 5}
+)
+
+// . duckAmountLabel and duckHoldLabel return the dropdown choice for a setting
+func duckAmountLabel(amount int) string    { return fmt.Sprintf("Lower others %d%%", amount) }
+func duckHoldLabel(seconds float64) string { return fmt.Sprintf("Hold %gs", seconds) }
+
+var (
+	// duckingMode is the configuration monitorDucking applies, copied from the settings by
+	// applyDucking so it can be read off the Fyne goroutine
+	duckingMode atomic.Pointer[Ducking]
+	// duckingChanged wakes monitorDucking when the configuration was changed
+	duckingChanged = make(chan struct{}, 1)
+
+	duck = newDucker()
+)
+
+// . ducker is the state of the ducking engine
+type ducker struct {
+	mu        sync.Mutex
+	level     float32            // share of their own volume the other sessions play at
+	heard     time.Time          // when a trigger app last made sound
+	originals map[string]float32 // session ID -> volume before ducking
+}
+
+// . newDucker returns a ducker with nothing ducked
+func newDucker() *ducker {
+	return &ducker{level: 1, originals: make(map[string]float32)}
+}
+
+// . applyDucking hands the ducking settings to monitorDucking. Must be called on the Fyne
+// goroutine after the settings change.
+func applyDucking() {
+	mode := settings.Ducking
+	mode.Triggers = append([]string(nil), mode.Triggers...)
+	duckingMode.Store(&mode)
+	signal(duckingChanged)
+}
+
+// . monitorDucking samples the sessions while ducking is on and sleeps until it is
+// changed while it is off
+func monitorDucking() {
+	defer backend.BindThread()()
+
+	ticker := time.NewTicker(duckInterval)
+	defer ticker.Stop()
+
+	for {
+		mode := duckingMode.Load()
+		if mode == nil || !mode.Enabled || len(mode.Triggers) == 0 {
+			duck.restore()
+			<-duckingChanged
+			continue
+		}
+
+		cachedSessionsMu.Lock()
+		sessions := cachedSessions
+		cachedSessionsMu.Unlock()
+		duck.step(*mode, time.Now(), sessions, triggerPeaks(*mode, sessions))
+
+		select {
+		case <-ticker.C:
+		case <-duckingChanged:
+		}
+	}
+}
+
+// . isTrigger reports whether a session belongs to one of the trigger apps
+func (mode Ducking) isTrigger(s policyConfig.AudioSession) bool {
+	for _, pattern := range mode.Triggers {
+		if (MixerRule{Match: MatchGlob, Pattern: pattern}).matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// . triggerPeaks returns the peak level of the trigger apps' sessions. Only those are
+// metered, each through its own session, so a tick costs nothing while no trigger app is
+// open. Returns nil when a session cannot be metered, in which case step falls back to the
+// session state.
+func triggerPeaks(mode Ducking, sessions []policyConfig.AudioSession) map[string]float32 {
+	peaks := make(map[string]float32)
+	for _, s := range sessions {
+		if !mode.isTrigger(s) {
+			continue
+		}
+		peak, err := backend.GetSessionPeak(s.ID)
+		if err != nil {
+			return nil
+		}
+		peaks[s.ID] = peak
+	}
+	return peaks
+}
+
+// . step moves the ducked level one interval towards its target and applies it to every
+// session but the trigger apps and system sounds. peaks is nil when the backend cannot
+// meter sessions, in which case an active trigger session counts as making sound.
+func (d *ducker) step(mode Ducking, now time.Time, sessions []policyConfig.AudioSession, peaks map[string]float32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, s := range sessions {
+		if !mode.isTrigger(s) {
+			continue
+		}
+		if (peaks != nil && peaks[s.ID] > duckThreshold) || (peaks == nil && s.Active) {
+			d.heard = now
+			break
+		}
+	}
+
+	target := float32(1)
+	if now.Sub(d.heard) < time.Duration(mode.HoldSeconds*float64(time.Second)) {
+		target = 1 - float32(min(max(mode.Amount, 0), 100))/100
+	}
+	rate := float32(duckRelease)
+	if target < d.level {
+		rate = duckAttack
+	}
+	previous := d.level
+	d.level += (target - d.level) * rate
+	if !volumesDiffer(d.level, target) {
+		d.level = target
+	}
+
+	if d.level == 1 {
+		d.restoreLocked()
+		return
+	}
+
+	present := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		present[s.ID] = true
+		original, ok := d.originals[s.ID]
+		switch {
+		case mode.isTrigger(s) || s.IsSystem:
+			if ok {
+				d.restoreSession(s.ID, original)
+			}
+			continue
+		case sessionTurnedDown(s.ID):
+			continue // the foreground mode has it for now
+		case ok && d.level == previous:
+			continue
+		}
+		if !ok {
+			original = s.Volume
+			d.originals[s.ID] = original
+		}
+		if err := backend.SetSessionVolume(s.ID, cappedVolume(s, original)*d.level); err != nil {
+			general.LogError("Error ducking session "+s.Name, err)
+		}
+	}
+
+	//* Sessions that ended need no restoring
+	for id := range d.originals {
+		if !present[id] {
+			delete(d.originals, id)
+		}
+	}
+}
+
+// . restore gives every ducked session back its volume
+func (d *ducker) restore() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.restoreLocked()
+}
+
+// . restoreLocked restores the ducked sessions and resets the level. Must hold d.mu.
+func (d *ducker) restoreLocked() {
+	d.level = 1
+	for id, original := range d.originals {
+		d.restoreSession(id, original)
+	}
+}
+
+// . restoreSession gives one ducked session back its volume. Must hold d.mu.
+func (d *ducker) restoreSession(id string, original float32) {
+	delete(d.originals, id)
+	if err := backend.SetSessionVolume(id, original); err != nil {
+		general.LogError("Error restoring ducked session volume", err)
+	}
+}
+
+// . userVolume records a volume the user gave a session from the mixer. A ducked session
+// plays it as its ducked level, so its volume to restore becomes that level scaled back
+// up, instead of the one it had before the user changed it.
+func (d *ducker) userVolume(id string, volume float32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.originals[id]; !ok {
+		return
+	}
+	if d.level > 0 {
+		volume = min(volume/d.level, 1)
+	}
+	d.originals[id] = volume
+}
+
+// . original returns the volume a ducked session will be given back
+func (d *ducker) original(id string) (float32, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	original, ok := d.originals[id]
+	return original, ok
+}
+
+// . ducks reports whether the engine has lowered a session, so other volume restoring
+// leaves it alone until the engine gives it back
+func (d *ducker) ducks(id string) bool {
+	_, ok := d.original(id)
+	return ok
+}
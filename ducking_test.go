@@ -0,0 +1,134 @@
+package main
+
+import (
+	"soundshift/interfaces/policyConfig"
+	"testing"
+	"time"
+)
+
+func TestDuckerLowersOthersWhileTriggerPlays(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "voice", Name: "Discord", Volume: 1, ExePath: `C:\Discord\Discord.exe`},
+		policyConfig.AudioSession{ID: "music", Name: "Spotify", Volume: 0.8, ExePath: `C:\Spotify\Spotify.exe`},
+		policyConfig.AudioSession{ID: "sys", Name: "System Sounds", Volume: 1, IsSystem: true},
+	)
+	mode := Ducking{Enabled: true, Triggers: []string{"discord"}, Amount: 50, HoldSeconds: 1}
+	volumes := func() map[string]float32 {
+		sessions, _ := fake.GetSessions()
+		got := make(map[string]float32)
+		for _, s := range sessions {
+			got[s.ID] = s.Volume
+		}
+		return got
+	}
+	step := func(now time.Time, peaks map[string]float32) {
+		sessions, _ := fake.GetSessions()
+		duck.step(mode, now, sessions, peaks)
+	}
+
+	start := time.Now()
+	now := start
+	for range 40 {
+		step(now, map[string]float32{"voice": 0.5})
+		now = now.Add(duckInterval)
+		if now.Sub(start) > 900*time.Millisecond {
+			break
+		}
+	}
+	if got := volumes(); volumesDiffer(got["music"], 0.4) || got["voice"] != 1 || got["sys"] != 1 {
+		t.Fatalf("volumes while the trigger plays = %v, want only the music at half", got)
+	}
+
+	// Silent but within the hold time: the music stays lowered
+	step(now, map[string]float32{"voice": 0})
+	if got := volumes()["music"]; volumesDiffer(got, 0.4) {
+		t.Fatalf("music volume within the hold time = %v, want 0.4", got)
+	}
+
+	// After the hold time the music glides back to where it was
+	now = now.Add(2 * time.Second)
+	for range 100 {
+		step(now, map[string]float32{"voice": 0})
+		now = now.Add(duckInterval)
+	}
+	if got := volumes()["music"]; got != 0.8 || duck.ducks("music") {
+		t.Fatalf("music volume after the hold time = %v, want 0.8 and no longer ducked", got)
+	}
+}
+
+func TestDuckerFallsBackToSessionState(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "voice", Name: "Teams", Volume: 1, Active: true},
+		policyConfig.AudioSession{ID: "game", Name: "Game", Volume: 1},
+	)
+	mode := Ducking{Enabled: true, Triggers: []string{"teams"}, Amount: 90, HoldSeconds: 1}
+
+	sessions, _ := fake.GetSessions()
+	duck.step(mode, time.Now(), sessions, nil)
+	if !duck.ducks("game") || duck.ducks("voice") {
+		t.Fatal("an active trigger session without peak meters did not duck the others")
+	}
+
+	duck.restore()
+	sessions, _ = fake.GetSessions()
+	for _, s := range sessions {
+		if s.Volume != 1 {
+			t.Fatalf("%s volume after restore = %v, want 1", s.ID, s.Volume)
+		}
+	}
+}
+
+func TestTriggerPeaksMetersOnlyTriggerSessions(t *testing.T) {
+	fake := useFakeBackend(t)
+	voice := policyConfig.AudioSession{ID: "voice", Name: "Discord", Active: true}
+	music := policyConfig.AudioSession{ID: "music", Name: "Spotify", Active: true}
+	fake.SetSessions(voice, music)
+	fake.SetSessionPeak("voice", 0.5)
+	fake.SetSessionPeak("music", 0.9)
+	mode := Ducking{Enabled: true, Triggers: []string{"discord"}}
+
+	peaks := triggerPeaks(mode, []policyConfig.AudioSession{voice, music})
+	if len(peaks) != 1 || peaks["voice"] != 0.5 {
+		t.Errorf("peaks = %v, want only the trigger session", peaks)
+	}
+
+	// A session that cannot be metered, e.g. one that ended since the snapshot, makes the
+	// engine fall back to the session state
+	gone := policyConfig.AudioSession{ID: "gone", Name: "Discord"}
+	if peaks := triggerPeaks(mode, []policyConfig.AudioSession{voice, gone}); peaks != nil {
+		t.Errorf("peaks with an unmeterable session = %v, want nil", peaks)
+	}
+}
+
+func TestDuckerKeepsVolumeSetWhileDucked(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "voice", Name: "Discord", Volume: 1},
+		policyConfig.AudioSession{ID: "music", Name: "Spotify", Volume: 0.8},
+	)
+	mode := Ducking{Enabled: true, Triggers: []string{"discord"}, Amount: 50, HoldSeconds: 1}
+	now := time.Now()
+	step := func(peak float32) {
+		sessions, _ := fake.GetSessions()
+		duck.step(mode, now, sessions, map[string]float32{"voice": peak})
+		now = now.Add(duckInterval)
+	}
+	for range 40 {
+		step(0.5)
+	}
+
+	// The user drags the ducked music down to 0.2 from the mixer
+	fake.SetSessionVolume("music", 0.2)
+	duck.userVolume("music", 0.2)
+
+	now = now.Add(2 * time.Second)
+	for range 100 {
+		step(0)
+	}
+	sessions, _ := fake.GetSessions()
+	if volumesDiffer(sessions[1].Volume, 0.4) || duck.ducks("music") {
+		t.Errorf("music after ducking = %v, want the user's 0.2 scaled back up to 0.4", sessions[1].Volume)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
+	"time"
+)
+
+// . fader ramps the volume changes SoundShift makes when fades are turned on
+var fader = audioBackend.NewFader(backend)
+
+// . fadeChoices are the choices of the config window's fade dropdown, in milliseconds
+var fadeChoices = []int{0, 100, 250, 500, 1000}
+
+// . fadeLabel returns the dropdown choice for a fade duration
+func fadeLabel(ms int) string {
+	if ms <= 0 {
+		return "No volume fades"
+	}
+	return fmt.Sprintf("Fade volume over %d ms", ms)
+}
+
+// . fadeDuration returns the configured fade duration, 0 when fades are off. Must be
+// called on the Fyne goroutine.
+func fadeDuration() time.Duration {
+	return time.Duration(max(settings.FadeMilliseconds, 0)) * time.Millisecond
+}
+
+// . fadeMute mutes or unmutes an endpoint or session through setMute, fading its volume
+// out before muting and in after unmuting. level is the target's volume while unmuted;
+// it is put back once a muted target has faded out, so unmuting it elsewhere is not
+// silent. d is the fade duration, 0 for none. onError is called when the mute could not
+// be set, possibly after a fade.
+func fadeMute(target audioBackend.FadeTarget, muted bool, level float32, d time.Duration, setMute func(bool) error, onError func(error)) {
+	if d <= 0 {
+		if err := setMute(muted); err != nil {
+			onError(err)
+		}
+		return
+	}
+
+	if muted {
+		fader.FadeWithCancel(target, level, 0, d, func(err error) {
+			if err == nil {
+				err = setMute(true)
+			}
+			if err != nil {
+				onError(err)
+			}
+			if err := setLevel(target, level); err != nil {
+				general.LogError("Error restoring volume after mute", err)
+			}
+		}, func() {
+			//* Another volume change, such as a slider move, took over before the fade-out
+			//* ended: the mute still happens, and the level is the new change's
+			if err := setMute(true); err != nil {
+				onError(err)
+			}
+		})
+		return
+	}
+
+	//* Unmute at silence and fade in, unless a fade-out is still running: the fade-in then
+	//* continues from where it got to, and the fade-out's pending mute is dropped
+	from, fading := fader.Stop(target)
+	if !fading {
+		if err := setLevel(target, 0); err != nil {
+			general.LogError("Error preparing fade-in", err)
+		}
+	}
+	if err := setMute(false); err != nil {
+		onError(err)
+		return
+	}
+	fader.Fade(target, from, level, d, logFadeError)
+}
+
+// . setLevel sets the volume of an endpoint or session at once
+func setLevel(target audioBackend.FadeTarget, level float32) error {
+	if target.Session {
+		return backend.SetSessionVolume(target.ID, level)
+	}
+	return backend.SetVolume(target.ID, level)
+}
+
+// . logFadeError is the done callback of fades nothing waits for
+func logFadeError(err error) {
+	if err != nil {
+		general.LogError("Error fading volume", err)
+	}
+}
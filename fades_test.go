@@ -0,0 +1,71 @@
+package main
+
+import (
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+	"time"
+)
+
+func TestFadeMuteFadesOutThenMutes(t *testing.T) {
+	fake := useFakeBackend(t)
+	d := 50 * time.Millisecond
+	fake.SetSessions(policyConfig.AudioSession{ID: "g1", Name: "Game", Volume: 0.7})
+	session := func() policyConfig.AudioSession {
+		sessions, _ := fake.GetSessions()
+		return sessions[0]
+	}
+	setMute := func(muted bool) error { return fake.SetSessionMute("g1", muted) }
+	fail := func(err error) { t.Errorf("mute failed: %v", err) }
+
+	fadeMute(audioBackend.Session("g1"), true, 0.7, d, setMute, fail)
+	if session().Muted {
+		t.Fatal("session muted before fading out")
+	}
+	waitFor(t, "the mute", func() bool { return session().Muted })
+	if v := session().Volume; v != 0.7 {
+		t.Errorf("volume after the fade-out = %v, want it restored to 0.7", v)
+	}
+
+	// Unmuting starts from silence and fades back in
+	fadeMute(audioBackend.Session("g1"), false, 0.7, d, setMute, fail)
+	if s := session(); s.Muted || s.Volume >= 0.7 {
+		t.Fatalf("session right after unmuting = %+v, want unmuted and quiet", s)
+	}
+	waitFor(t, "the fade-in", func() bool { return session().Volume == 0.7 })
+}
+
+func TestFadeMuteDuringFadeToSilence(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(policyConfig.AudioSession{ID: "g1", Name: "Game", Volume: 0.7})
+	muted := func() bool {
+		sessions, _ := fake.GetSessions()
+		return sessions[0].Muted
+	}
+
+	// A slider dragged to 0 is still fading when the mute button is tapped
+	fader.Fade(audioBackend.Session("g1"), 0.7, 0, 100*time.Millisecond, logFadeError)
+	fadeMute(audioBackend.Session("g1"), true, 0.7, 100*time.Millisecond,
+		func(muted bool) error { return fake.SetSessionMute("g1", muted) },
+		func(err error) { t.Errorf("mute failed: %v", err) })
+	waitFor(t, "the mute", muted)
+}
+
+func TestFadeMuteSurvivesSliderMove(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(policyConfig.AudioSession{ID: "g1", Name: "Game", Volume: 0.7})
+	session := func() policyConfig.AudioSession {
+		sessions, _ := fake.GetSessions()
+		return sessions[0]
+	}
+
+	fadeMute(audioBackend.Session("g1"), true, 0.7, time.Hour,
+		func(muted bool) error { return fake.SetSessionMute("g1", muted) },
+		func(err error) { t.Errorf("mute failed: %v", err) })
+
+	// The slider is moved while the fade-out is still running
+	fader.Fade(audioBackend.Session("g1"), 0.7, 0.4, 0, logFadeError)
+	if s := session(); !s.Muted || s.Volume != 0.4 {
+		t.Errorf("session after the slider move = %+v, want muted at 0.4", s)
+	}
+}
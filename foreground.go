@@ -0,0 +1,253 @@
+package main
+
+import (
+	"os"
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// . ForegroundMode turns down every mixer session except those of the app in the
+// foreground, so paused videos or games in the background stay quiet
+type ForegroundMode struct {
+	Enabled     bool
+	Attenuation int      // percent background sessions are turned down by; 100 mutes them
+	Allowlist   []string // names or globs of apps that stay audible in the background
+}
+
+// . attenuationLabels are the choices of the config window's attenuation dropdown, from
+// muting background apps to turning them down by a quarter
+var attenuationLabels = []string{"Mute others", "Others -75%", "Others -50%", "Others -25%"}
+
+// . attenuationLabel returns the dropdown choice for an attenuation
+func attenuationLabel(attenuation int) string {
+	switch {
+	case attenuation >= 100:
+		return attenuationLabels[0]
+	case attenuation >= 75:
+		return attenuationLabels[1]
+	case attenuation >= 50:
+		return attenuationLabels[2]
+	default:
+		return attenuationLabels[3]
+	}
+}
+
+// . attenuationPercent returns the attenuation of a dropdown choice
+func attenuationPercent(label string) int {
+	switch label {
+	case attenuationLabels[1]:
+		return 75
+	case attenuationLabels[2]:
+		return 50
+	case attenuationLabels[3]:
+		return 25
+	}
+	return 100
+}
+
+// . splitList splits a comma-separated list, dropping empty items
+func splitList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// . foregroundInterval is how often the foreground window is checked while the mode is on
+const foregroundInterval = 250 * time.Millisecond
+
+// . backgroundSession is the state a session had before the mode turned it down
+type backgroundSession struct {
+	volume float32
+	muted  bool
+	scale  float32 // share of volume the session plays at while turned down; 0 when muted
+}
+
+var (
+	// foregroundMode is the mode monitorForeground applies, copied from the settings by
+	// applyForegroundMode so it can be read off the Fyne goroutine
+	foregroundMode atomic.Pointer[ForegroundMode]
+	// foregroundChanged wakes monitorForeground when the mode was changed
+	foregroundChanged = make(chan struct{}, 1)
+
+	foregroundMu sync.Mutex
+	turnedDown   = make(map[string]backgroundSession) // session ID -> state to restore
+)
+
+// . applyForegroundMode hands the mode in the settings to monitorForeground. Must be
+// called on the Fyne goroutine after the settings change.
+func applyForegroundMode() {
+	mode := settings.ForegroundMode
+	mode.Allowlist = append([]string(nil), mode.Allowlist...)
+	foregroundMode.Store(&mode)
+	signal(foregroundChanged)
+}
+
+// . monitorForeground turns down background sessions while the mode is on and restores
+// them when it is turned off or changed
+func monitorForeground() {
+	defer backend.BindThread()()
+
+	ticker := time.NewTicker(foregroundInterval)
+	defer ticker.Stop()
+
+	for {
+		mode := foregroundMode.Load()
+		if mode == nil || !mode.Enabled {
+			restoreBackgroundSessions()
+			<-foregroundChanged
+			continue
+		}
+
+		pid, exePath := foregroundApp()
+		cachedSessionsMu.Lock()
+		sessions := cachedSessions
+		cachedSessionsMu.Unlock()
+		updateBackgroundSessions(*mode, pid, exePath, sessions)
+
+		select {
+		case <-ticker.C:
+		case <-foregroundChanged:
+			//* Sessions turned down under the old mode are restored before the new one applies
+			restoreBackgroundSessions()
+		}
+	}
+}
+
+// . updateBackgroundSessions turns down the sessions that are not the foreground app's
+// and restores those that are again. While nothing or SoundShift itself is in front,
+// everything is left as it is.
+func updateBackgroundSessions(mode ForegroundMode, pid uint32, exePath string, sessions []policyConfig.AudioSession) {
+	if pid == 0 || pid == uint32(os.Getpid()) {
+		return
+	}
+
+	foregroundMu.Lock()
+	defer foregroundMu.Unlock()
+
+	live := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		live[s.ID] = true
+		original, down := turnedDown[s.ID]
+		background := !s.IsSystem && !inForeground(s, pid, exePath) && !allowedInBackground(mode, s)
+		switch {
+		case background && !down:
+			turnDown(s, mode.Attenuation)
+		case !background && down:
+			restoreSession(s.ID, original)
+		}
+	}
+
+	//* Sessions that ended need no restoring
+	for id := range turnedDown {
+		if !live[id] {
+			delete(turnedDown, id)
+		}
+	}
+}
+
+// . inForeground reports whether a session belongs to the foreground app: its process,
+// or another process of the same executable such as a browser's audio process
+func inForeground(s policyConfig.AudioSession, pid uint32, exePath string) bool {
+	return s.PID == pid || (exePath != "" && strings.EqualFold(s.ExePath, exePath))
+}
+
+// . allowedInBackground reports whether a session's app is on the mode's allowlist
+func allowedInBackground(mode ForegroundMode, s policyConfig.AudioSession) bool {
+	for _, pattern := range mode.Allowlist {
+		if (MixerRule{Match: MatchGlob, Pattern: pattern}).matches(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// . turnDown mutes a background session, or lowers it by attenuation percent, and
+// records the state to restore. Must hold foregroundMu.
+func turnDown(s policyConfig.AudioSession, attenuation int) {
+	var err error
+	scale := float32(100-max(attenuation, 0)) / 100
+	if attenuation >= 100 {
+		scale = 0
+		if !s.Muted {
+			err = backend.SetSessionMute(s.ID, true)
+		}
+	} else {
+		err = backend.SetSessionVolume(s.ID, s.Volume*scale)
+	}
+	if err != nil {
+		general.LogError("Error turning down background session "+s.Name, err)
+		return
+	}
+	turnedDown[s.ID] = backgroundSession{volume: s.Volume, muted: s.Muted, scale: scale}
+}
+
+// . restoreSession gives a session back the state it had before it was turned down.
+// Must hold foregroundMu.
+func restoreSession(id string, original backgroundSession) {
+	delete(turnedDown, id)
+	if err := backend.SetSessionVolume(id, original.volume); err != nil {
+		general.LogError("Error restoring background session volume", err)
+	}
+	if err := backend.SetSessionMute(id, original.muted); err != nil {
+		general.LogError("Error restoring background session mute", err)
+	}
+}
+
+// . setBackgroundVolume and setBackgroundMute record a volume or mute the user gave a
+// session from the mixer, so a turned-down session comes back to the foreground with it
+// instead of with the state it had before it was turned down. A lowered session plays
+// the volume as its lowered level, which is scaled back up.
+func setBackgroundVolume(id string, volume float32) {
+	foregroundMu.Lock()
+	defer foregroundMu.Unlock()
+	original, down := turnedDown[id]
+	if !down {
+		return
+	}
+	if original.scale > 0 {
+		volume = min(volume/original.scale, 1)
+	}
+	original.volume = volume
+	turnedDown[id] = original
+}
+
+func setBackgroundMute(id string, muted bool) {
+	foregroundMu.Lock()
+	defer foregroundMu.Unlock()
+	if original, down := turnedDown[id]; down {
+		original.muted = muted
+		turnedDown[id] = original
+	}
+}
+
+// . backgroundOriginal returns the state a turned-down session will be given back
+func backgroundOriginal(id string) (backgroundSession, bool) {
+	foregroundMu.Lock()
+	defer foregroundMu.Unlock()
+	original, down := turnedDown[id]
+	return original, down
+}
+
+// . restoreBackgroundSessions restores every session the mode turned down
+func restoreBackgroundSessions() {
+	foregroundMu.Lock()
+	defer foregroundMu.Unlock()
+	for id, original := range turnedDown {
+		restoreSession(id, original)
+	}
+}
+
+// . sessionTurnedDown reports whether the mode has turned a session down, so other
+// volume restoring leaves it alone until the mode gives it back
+func sessionTurnedDown(id string) bool {
+	_, down := backgroundOriginal(id)
+	return down
+}
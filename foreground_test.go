@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+func TestForegroundModeTurnsDownBackgroundApps(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "game", Name: "Game", PID: 30, Volume: 1, ExePath: `C:\Games\game.exe`},
+		policyConfig.AudioSession{ID: "video", Name: "Browser", PID: 40, Volume: 0.8, ExePath: `C:\Browser\browser.exe`},
+		policyConfig.AudioSession{ID: "tab", Name: "Browser", PID: 41, Volume: 0.8, ExePath: `C:\Browser\browser.exe`},
+		policyConfig.AudioSession{ID: "music", Name: "Spotify", PID: 50, Volume: 0.5, ExePath: `C:\Spotify\Spotify.exe`},
+		policyConfig.AudioSession{ID: "sys", Name: "System Sounds", Volume: 1, IsSystem: true},
+	)
+	mode := ForegroundMode{Enabled: true, Attenuation: 100, Allowlist: []string{"spotify"}}
+	state := func() map[string]bool {
+		sessions, _ := fake.GetSessions()
+		muted := make(map[string]bool)
+		for _, s := range sessions {
+			muted[s.ID] = s.Muted
+		}
+		return muted
+	}
+	update := func(pid uint32, exePath string) {
+		sessions, _ := fake.GetSessions()
+		updateBackgroundSessions(mode, pid, exePath, sessions)
+	}
+
+	update(30, `C:\Games\game.exe`)
+	if got := state(); got["game"] || !got["video"] || !got["tab"] || got["music"] || got["sys"] {
+		t.Fatalf("muted with the game in front = %v, want only the browser muted", got)
+	}
+
+	// Another process of the browser is in front: every browser session plays again
+	update(42, `C:\Browser\browser.exe`)
+	if got := state(); !got["game"] || got["video"] || got["tab"] {
+		t.Fatalf("muted with the browser in front = %v, want only the game muted", got)
+	}
+
+	// SoundShift's own flyout coming to the front changes nothing
+	update(uint32(os.Getpid()), "")
+	if got := state(); !got["game"] {
+		t.Error("the game was restored while SoundShift itself was in front")
+	}
+
+	restoreBackgroundSessions()
+	if got := state(); got["game"] || got["video"] {
+		t.Errorf("muted after turning the mode off = %v, want nothing muted", got)
+	}
+}
+
+func TestForegroundModeAttenuatesAndRestoresVolume(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "game", Name: "Game", PID: 30, Volume: 1},
+		policyConfig.AudioSession{ID: "video", Name: "Browser", PID: 40, Volume: 0.8},
+	)
+	sessions, _ := fake.GetSessions()
+	updateBackgroundSessions(ForegroundMode{Enabled: true, Attenuation: 50}, 30, "", sessions)
+
+	sessions, _ = fake.GetSessions()
+	if sessions[1].Volume != 0.4 || sessions[1].Muted {
+		t.Fatalf("background session = %v (muted %v), want it halved to 0.4", sessions[1].Volume, sessions[1].Muted)
+	}
+
+	restoreBackgroundSessions()
+	sessions, _ = fake.GetSessions()
+	if sessions[1].Volume != 0.8 || sessions[0].Volume != 1 {
+		t.Errorf("volumes after restoring = %v/%v, want 1/0.8", sessions[0].Volume, sessions[1].Volume)
+	}
+}
+
+func TestForegroundModeKeepsUserChangesToBackgroundApps(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "game", Name: "Game", PID: 30, Volume: 1},
+		policyConfig.AudioSession{ID: "video", Name: "Browser", PID: 40, Volume: 0.8},
+	)
+	sessions, _ := fake.GetSessions()
+	updateBackgroundSessions(ForegroundMode{Enabled: true, Attenuation: 50}, 30, "", sessions)
+
+	// The user lowers and mutes the turned-down browser from the mixer
+	fake.SetSessionVolume("video", 0.3)
+	setBackgroundVolume("video", 0.3)
+	fake.SetSessionMute("video", true)
+	setBackgroundMute("video", true)
+
+	restoreBackgroundSessions()
+	sessions, _ = fake.GetSessions()
+	if volumesDiffer(sessions[1].Volume, 0.6) || !sessions[1].Muted {
+		t.Errorf("browser after restoring = %v (muted %v), want the user's 0.3 scaled back to 0.6, muted", sessions[1].Volume, sessions[1].Muted)
+	}
+}
+
+func TestAttenuationLabelsRoundTrip(t *testing.T) {
+	for _, percent := range []int{100, 75, 50, 25} {
+		if got := attenuationPercent(attenuationLabel(percent)); got != percent {
+			t.Errorf("attenuationPercent(attenuationLabel(%d)) = %d", percent, got)
+		}
+	}
+}
@@ -206,6 +206,30 @@ func (r *colorButtonRenderer) BackgroundColor() color.Color {
 	return r.button.backgroundColor
 }
 
+// . DeviceButton is a standard button that also reacts to right-clicks, used to
+// open the per-role context menu on device buttons
+type DeviceButton struct {
+	widget.Button
+	OnTappedSecondary func(*fyne.PointEvent) // Called on right-click; nil disables the secondary action
+}
+
+// . NewDeviceButton creates a DeviceButton with an optional icon (nil for none)
+func NewDeviceButton(label string, icon fyne.Resource, tapped func(), tappedSecondary func(*fyne.PointEvent)) *DeviceButton {
+	b := &DeviceButton{OnTappedSecondary: tappedSecondary}
+	b.Text = label
+	b.Icon = icon
+	b.OnTapped = tapped
+	b.ExtendBaseWidget(b) // Initialize as a Fyne widget
+	return b
+}
+
+// . TappedSecondary forwards right-clicks to OnTappedSecondary
+func (b *DeviceButton) TappedSecondary(ev *fyne.PointEvent) {
+	if b.OnTappedSecondary != nil {
+		b.OnTappedSecondary(ev)
+	}
+}
+
 // . CustomVBoxLayout is a vertical box layout with a fixed width and centered objects
 type CustomVBoxLayout struct {
 	FixedWidth float32 // Width to apply to each child object in the layout
@@ -403,6 +427,22 @@ func (tb *TitleBar) MouseDown(ev *desktop.MouseEvent) {
 	}
 }
 
+// . lockIconSVG is the Material "lock" icon, which the Fyne theme does not include
+var lockIconSVG = []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24"><path d="M18 8h-1V6c0-2.76-2.24-5-5-5S7 3.24 7 6v2H6c-1.1 0-2 .9-2 2v10c0 1.1.9 2 2 2h12c1.1 0 2-.9 2-2V10c0-1.1-.9-2-2-2zm-6 9c-1.1 0-2-.9-2-2s.9-2 2-2 2 .9 2 2-.9 2-2 2zm3.1-9H8.9V6c0-1.71 1.39-3.1 3.1-3.1 1.71 0 3.1 1.39 3.1 3.1v2z"/></svg>`)
+
+// . LockIcon returns a lock icon drawn in the theme's foreground colour
+func LockIcon() fyne.Resource {
+	return theme.NewThemedResource(fyne.NewStaticResource("lock.svg", lockIconSVG))
+}
+
+var soloIconSVG = []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24"><path d="M12 1c-4.97 0-9 4.03-9 9v7c0 1.66 1.34 3 3 3h3v-8H5v-2c0-3.87 3.13-7 7-7s7 3.13 7 7v2h-4v8h3c1.66 0 3-1.34 3-3v-7c0-4.97-4.03-9-9-9z"/></svg>`)
+
+// . SoloIcon returns a headphones icon, for soloing an app, drawn in the theme's
+// foreground colour
+func SoloIcon() fyne.Resource {
+	return theme.NewThemedResource(fyne.NewStaticResource("solo.svg", soloIconSVG))
+}
+
 // . IconButton is a borderless icon-only button with hover feedback and an
 // optional "active" visual state (e.g. muted). Satisfies desktop.Hoverable.
 type IconButton struct {
@@ -515,3 +555,106 @@ func (tb *TitleBar) MouseOut() {
 		tb.Refresh()
 	}
 }
+
+// . LevelMeter is a thin horizontal bar showing an audio level in [0, 1]
+type LevelMeter struct {
+	widget.BaseWidget
+	Level float32
+}
+
+// . NewLevelMeter creates an empty LevelMeter.
+func NewLevelMeter() *LevelMeter {
+	m := &LevelMeter{}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+// . SetLevel updates the level and redraws; changes too small to see are skipped.
+func (m *LevelMeter) SetLevel(level float32) {
+	level = max(0, min(level, 1))
+	if d := level - m.Level; d > -0.005 && d < 0.005 && level != 0 {
+		return
+	}
+	m.Level = level
+	m.Refresh()
+}
+
+type levelMeterRenderer struct {
+	meter *LevelMeter
+	track *canvas.Rectangle
+	fill  *canvas.Rectangle
+}
+
+func (m *LevelMeter) CreateRenderer() fyne.WidgetRenderer {
+	track := canvas.NewRectangle(color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x12})
+	track.CornerRadius = 1.5
+	fill := canvas.NewRectangle(color.NRGBA{R: 0x4c, G: 0xc2, B: 0x6a, A: 0xcc})
+	fill.CornerRadius = 1.5
+	return &levelMeterRenderer{meter: m, track: track, fill: fill}
+}
+
+func (r *levelMeterRenderer) Layout(size fyne.Size) {
+	r.track.Resize(size)
+	r.fill.Resize(fyne.NewSize(size.Width*r.meter.Level, size.Height))
+}
+
+func (r *levelMeterRenderer) MinSize() fyne.Size { return fyne.NewSize(10, 3) }
+
+func (r *levelMeterRenderer) Refresh() {
+	r.Layout(r.meter.Size())
+	r.fill.Refresh()
+}
+
+func (r *levelMeterRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.track, r.fill}
+}
+
+func (r *levelMeterRenderer) Destroy() {}
+
+// . SliderMarker draws a tick at a value along a horizontal slider's track. Stack it behind
+// the slider, at the slider's size, to mark a limit such as a volume cap.
+type SliderMarker struct {
+	widget.BaseWidget
+	Ratio float32 // position along the track in [0, 1]
+}
+
+// . NewSliderMarker creates a SliderMarker at ratio.
+func NewSliderMarker(ratio float32) *SliderMarker {
+	m := &SliderMarker{Ratio: max(0, min(ratio, 1))}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+type sliderMarkerRenderer struct {
+	marker *SliderMarker
+	tick   *canvas.Rectangle
+}
+
+func (m *SliderMarker) CreateRenderer() fyne.WidgetRenderer {
+	tick := canvas.NewRectangle(color.NRGBA{R: 0xff, G: 0xb0, B: 0x40, A: 0xd0})
+	return &sliderMarkerRenderer{marker: m, tick: tick}
+}
+
+// . Layout places the tick where widget.Slider draws that value, inside the same end
+// padding it keeps for its thumb
+func (r *sliderMarkerRenderer) Layout(size fyne.Size) {
+	th := r.marker.Theme()
+	endPad := (th.Size(theme.SizeNameInlineIcon)-4)/2 + th.Size(theme.SizeNameInnerPadding) - 1.5
+	const width, height = 2, 12
+	x := endPad + (size.Width-endPad*2)*r.marker.Ratio
+	r.tick.Resize(fyne.NewSize(width, height))
+	r.tick.Move(fyne.NewPos(x-width/2, (size.Height-height)/2))
+}
+
+func (r *sliderMarkerRenderer) MinSize() fyne.Size { return fyne.NewSize(0, 0) }
+
+func (r *sliderMarkerRenderer) Refresh() {
+	r.Layout(r.marker.Size())
+	r.tick.Refresh()
+}
+
+func (r *sliderMarkerRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.tick}
+}
+
+func (r *sliderMarkerRenderer) Destroy() {}
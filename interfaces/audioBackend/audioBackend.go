@@ -0,0 +1,75 @@
+package audioBackend
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+)
+
+// . AudioBackend is everything SoundShift needs from the platform audio stack: listing
+// and switching devices, endpoint volume and mute, per-app sessions, and change events.
+// Devices and sessions use the mmDeviceEnumerator and policyConfig shapes on every platform.
+type AudioBackend interface {
+	// BindThread prepares the calling goroutine for backend calls (WASAPI locks the OS
+	// thread and initialises COM on it) and returns the matching cleanup.
+	BindThread() (release func())
+
+	GetDevices() ([]mmDeviceEnumerator.AudioDevice, error)
+	GetCaptureDevices() ([]mmDeviceEnumerator.AudioDevice, error)
+	// SetDefaultDevice makes deviceID the default for the given roles
+	// (mmDeviceEnumerator.RoleConsole, RoleMultimedia, RoleCommunications).
+	SetDefaultDevice(deviceID string, roles ...uint32) error
+
+	GetVolume(deviceID string) (float32, error)
+	SetVolume(deviceID string, level float32) error
+	GetMute(deviceID string) (bool, error)
+	SetMute(deviceID string, muted bool) error
+	// GetChannelVolumes returns one volume scalar per channel of the device, in speaker
+	// order (front left, front right, ...); its length is the channel count.
+	GetChannelVolumes(deviceID string) ([]float32, error)
+	SetChannelVolume(deviceID string, channel uint32, level float32) error
+	// GetDeviceFormat returns the shared-mode format of a device, GetSupportedFormats the
+	// formats SetDeviceFormat can switch it to.
+	GetDeviceFormat(deviceID string) (mmDeviceEnumerator.DeviceFormat, error)
+	GetSupportedFormats(deviceID string) ([]mmDeviceEnumerator.DeviceFormat, error)
+	SetDeviceFormat(deviceID string, format mmDeviceEnumerator.DeviceFormat) error
+	// SetDeviceEnabled enables or disables a device for every application. GetDevices and
+	// GetCaptureDevices keep listing disabled devices, flagged IsDisabled.
+	SetDeviceEnabled(deviceID string, enabled bool) error
+	// GetPeak returns the current peak level of a device in [0, 1]. Backends that cannot
+	// meter report an error wrapping errors.ErrUnsupported.
+	GetPeak(deviceID string) (float32, error)
+
+	// GetSessions lists the per-app sessions on every output device, tagged with their
+	// AudioSession.DeviceID. The setters address a session by its AudioSession.ID.
+	GetSessions() ([]policyConfig.AudioSession, error)
+	SetSessionVolume(id string, level float32) error
+	SetSessionMute(id string, muted bool) error
+	// GetSessionPeaks returns the current peak level of every session GetSessions lists,
+	// GetSessionPeak that of one session. Backends that cannot meter report an error
+	// wrapping errors.ErrUnsupported.
+	GetSessionPeaks() ([]policyConfig.SessionPeak, error)
+	GetSessionPeak(id string) (float32, error)
+	// GetSessionDevice returns the output device an app is routed to, or "" when it
+	// follows the default output device. SetSessionDevice with "" restores that.
+	GetSessionDevice(pid uint32) (string, error)
+	SetSessionDevice(pid uint32, deviceID string) error
+
+	// Watch* register callbacks for changes, whoever makes them. Callbacks may run on
+	// backend-owned threads and must return quickly.
+	WatchDevices(onEvent func(mmDeviceEnumerator.DeviceEvent)) (Watcher, error)
+	WatchEndpointVolume(deviceID string, onNotify func(policyConfig.VolumeNotification)) (Watcher, error)
+	WatchSessions(onEvent func(policyConfig.SessionEvent)) (SessionWatcher, error)
+}
+
+// . Watcher is an event subscription; Close unregisters it
+type Watcher interface {
+	Close() error
+}
+
+// . SessionWatcher is a session event subscription. Refresh must be called after a
+// SessionCreated, SessionStateChanged or SessionDisconnected event so sessions that
+// appeared since the last call are watched as well.
+type SessionWatcher interface {
+	Watcher
+	Refresh() error
+}
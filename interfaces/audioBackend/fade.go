@@ -0,0 +1,238 @@
+package audioBackend
+
+import (
+	"sync"
+	"time"
+)
+
+// . fadeStep is how often a running fade sets the next level
+const fadeStep = 15 * time.Millisecond
+
+// . FadeTarget is what a fade ramps: an endpoint by device ID, or a session by its
+// AudioSession.ID
+type FadeTarget struct {
+	Session bool
+	ID      string
+}
+
+// . Endpoint and Session return the FadeTarget of a device and of a session
+func Endpoint(deviceID string) FadeTarget { return FadeTarget{ID: deviceID} }
+func Session(id string) FadeTarget        { return FadeTarget{Session: true, ID: id} }
+
+// . Fader ramps endpoint and session volumes of a backend over time. There is at most one
+// fade per target: starting another cancels the running one, which is how a new volume
+// change overrides a fade still in progress.
+type Fader struct {
+	backend AudioBackend
+	mu      sync.Mutex // guards fades; never held during a backend call
+	fades   map[FadeTarget]*fade
+	// writeMu orders the level writes, so a fade that was replaced while its write was
+	// waiting can see that and skip it instead of overwriting its replacement
+	writeMu sync.Mutex
+}
+
+// . fade is one running ramp
+type fade struct {
+	from, to  float32
+	level     float32 // last level set
+	done      func(error)
+	cancelled func()
+	cancel    chan struct{}
+}
+
+// . NewFader returns a Fader setting levels through backend
+func NewFader(backend AudioBackend) *Fader {
+	return &Fader{backend: backend, fades: make(map[FadeTarget]*fade)}
+}
+
+// . Fade ramps target from the level from to the level to over d, then calls done with
+// nil, or with the error that stopped the fade. A fade already running on target is
+// cancelled without calling its done (see FadeWithCancel), and the new one starts from
+// the level it had reached instead of from. A fade towards the level the running one is
+// already heading for leaves the running one alone, and done is called along with its
+// done when it ends. With d <= 0 the level is set at once and done is called before Fade
+// returns. done may be nil.
+func (f *Fader) Fade(target FadeTarget, from, to float32, d time.Duration, done func(error)) {
+	f.FadeWithCancel(target, from, to, d, done, nil)
+}
+
+// . FadeWithCancel is Fade with cancelled called instead of done when another fade
+// replaces this one before it ends, for callers with work left to do in that case.
+// cancelled may be nil.
+func (f *Fader) FadeWithCancel(target FadeTarget, from, to float32, d time.Duration, done func(error), cancelled func()) {
+	f.mu.Lock()
+	var replaced func()
+	if running, ok := f.fades[target]; ok {
+		if running.to == to {
+			running.done = chainDone(running.done, done)
+			running.cancelled = chainCancelled(running.cancelled, cancelled)
+			f.mu.Unlock()
+			return
+		}
+		from = running.level
+		replaced = running.cancelled
+		close(running.cancel)
+		delete(f.fades, target)
+	}
+
+	if d <= 0 || from == to {
+		f.mu.Unlock()
+		if replaced != nil {
+			replaced()
+		}
+		f.writeMu.Lock()
+		err := f.set(target, to)
+		f.writeMu.Unlock()
+		if done != nil {
+			done(err)
+		}
+		return
+	}
+
+	fd := &fade{from: from, to: to, level: from, done: done, cancelled: cancelled, cancel: make(chan struct{})}
+	f.fades[target] = fd
+	f.mu.Unlock()
+	if replaced != nil {
+		replaced()
+	}
+	go f.run(target, fd, d)
+}
+
+// . chainDone and chainCancelled return a callback calling first and then second, either
+// of which may be nil
+func chainDone(first, second func(error)) func(error) {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(err error) {
+		first(err)
+		second(err)
+	}
+}
+
+func chainCancelled(first, second func()) func() {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func() {
+		first()
+		second()
+	}
+}
+
+// . run sets the levels of one fade until it reaches its end or is cancelled
+func (f *Fader) run(target FadeTarget, fd *fade, d time.Duration) {
+	defer f.backend.BindThread()()
+
+	ticker := time.NewTicker(fadeStep)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		progress := min(float32(time.Since(start))/float32(d), 1)
+		level := fd.from + (fd.to-fd.from)*progress
+
+		//* The write happens outside f.mu, so Fade, Target and Stop never wait on the
+		//* backend; a fade replaced in the meantime finds it is no longer current and stops
+		f.writeMu.Lock()
+		f.mu.Lock()
+		current := f.fades[target] == fd
+		f.mu.Unlock()
+		if !current {
+			f.writeMu.Unlock()
+			return
+		}
+		err := f.set(target, level)
+		f.writeMu.Unlock()
+
+		finished := err != nil || progress == 1
+		f.mu.Lock()
+		if f.fades[target] != fd {
+			f.mu.Unlock()
+			return
+		}
+		fd.level = level
+		done := fd.done
+		if finished {
+			delete(f.fades, target)
+		}
+		f.mu.Unlock()
+
+		if finished {
+			if done != nil {
+				done(err)
+			}
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-fd.cancel:
+			return
+		}
+	}
+}
+
+// . set applies a level to a target
+func (f *Fader) set(target FadeTarget, level float32) error {
+	if target.Session {
+		return f.backend.SetSessionVolume(target.ID, level)
+	}
+	return f.backend.SetVolume(target.ID, level)
+}
+
+// . Target returns the level a running fade on target is heading for
+func (f *Fader) Target(target FadeTarget) (float32, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fd, ok := f.fades[target]
+	if !ok {
+		return 0, false
+	}
+	return fd.to, true
+}
+
+// . Stop ends the fade running on target where it has got to, calling neither its done
+// nor its cancelled, and returns the level it had reached
+func (f *Fader) Stop(target FadeTarget) (float32, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fd, ok := f.fades[target]
+	if !ok {
+		return 0, false
+	}
+	close(fd.cancel)
+	delete(f.fades, target)
+	return fd.level, true
+}
+
+// . Finish ends every running fade at once: each target is set to its final level and
+// its done is called, so nothing is left half-faded, for example on exit
+func (f *Fader) Finish() {
+	f.mu.Lock()
+	fades := f.fades
+	f.fades = make(map[FadeTarget]*fade)
+	for _, fd := range fades {
+		close(fd.cancel)
+	}
+	f.mu.Unlock()
+
+	f.writeMu.Lock()
+	errs := make(map[FadeTarget]error, len(fades))
+	for target, fd := range fades {
+		errs[target] = f.set(target, fd.to)
+	}
+	f.writeMu.Unlock()
+
+	for target, fd := range fades {
+		if fd.done != nil {
+			fd.done(errs[target])
+		}
+	}
+}
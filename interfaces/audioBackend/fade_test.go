@@ -0,0 +1,122 @@
+package audioBackend
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+	"time"
+)
+
+func TestFadeRampsToTarget(t *testing.T) {
+	f := NewFake()
+	f.SetDevices(mmDeviceEnumerator.AudioDevice{Id: "spk", Name: "Speakers"})
+	f.SetEndpointState("spk", 0, false)
+	fader := NewFader(f)
+
+	var levels []float32
+	w, _ := f.WatchEndpointVolume("spk", func(n policyConfig.VolumeNotification) { levels = append(levels, n.Volume) })
+	defer w.Close()
+
+	done := make(chan error, 1)
+	fader.Fade(Endpoint("spk"), 0, 0.8, 100*time.Millisecond, func(err error) { done <- err })
+	if target, ok := fader.Target(Endpoint("spk")); !ok || target != 0.8 {
+		t.Errorf("Target = %v, %v; want 0.8, true", target, ok)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fade did not finish")
+	}
+
+	if v := f.Volume("spk"); v != 0.8 {
+		t.Errorf("volume after the fade = %v, want 0.8", v)
+	}
+	if len(levels) < 3 {
+		t.Errorf("fade set %d levels, want it to ramp", len(levels))
+	}
+	if _, ok := fader.Target(Endpoint("spk")); ok {
+		t.Error("finished fade still running")
+	}
+}
+
+func TestFadeIsCancelledByNewChange(t *testing.T) {
+	f := NewFake()
+	f.SetSessions(policyConfig.AudioSession{ID: "s1", Name: "Game", Volume: 1})
+	fader := NewFader(f)
+
+	cancelled := make(chan error, 1)
+	fader.Fade(Session("s1"), 1, 0, time.Hour, func(err error) { cancelled <- err })
+
+	// A change without a fade replaces the running one at once
+	called := false
+	fader.Fade(Session("s1"), 0.2, 0.5, 0, func(err error) { called = err == nil })
+	if !called {
+		t.Fatal("an immediate change did not call its done")
+	}
+	sessions, _ := f.GetSessions()
+	if sessions[0].Volume != 0.5 {
+		t.Errorf("session volume = %v, want 0.5", sessions[0].Volume)
+	}
+	select {
+	case <-cancelled:
+		t.Error("the cancelled fade called its done")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFaderFinish(t *testing.T) {
+	f := NewFake()
+	f.SetSessions(policyConfig.AudioSession{ID: "s1", Name: "Game", Volume: 1})
+	fader := NewFader(f)
+
+	finished := false
+	fader.Fade(Session("s1"), 1, 0.25, time.Hour, func(err error) { finished = err == nil })
+	fader.Finish()
+
+	sessions, _ := f.GetSessions()
+	if !finished || sessions[0].Volume != 0.25 {
+		t.Errorf("after Finish: done called = %v, volume = %v; want true, 0.25", finished, sessions[0].Volume)
+	}
+}
+
+func TestFadeToSameTargetKeepsBothDones(t *testing.T) {
+	f := NewFake()
+	f.SetSessions(policyConfig.AudioSession{ID: "s1", Name: "Game", Volume: 1})
+	fader := NewFader(f)
+
+	var first, second bool
+	fader.Fade(Session("s1"), 1, 0, time.Hour, func(err error) { first = err == nil })
+	fader.Fade(Session("s1"), 1, 0, time.Hour, func(err error) { second = err == nil })
+	fader.Finish()
+
+	if !first || !second {
+		t.Errorf("after Finish: first done called = %v, second = %v; want both", first, second)
+	}
+}
+
+func TestFadeReplacedCallsCancelled(t *testing.T) {
+	f := NewFake()
+	f.SetSessions(policyConfig.AudioSession{ID: "s1", Name: "Game", Volume: 1})
+	fader := NewFader(f)
+
+	// A mute's fade-out, then a slider move before it ends
+	var done, cancelled bool
+	fader.FadeWithCancel(Session("s1"), 1, 0, time.Hour, func(error) { done = true }, func() { cancelled = true })
+	fader.Fade(Session("s1"), 0.5, 0.3, 0, nil)
+	if done || !cancelled {
+		t.Errorf("replaced fade: done called = %v, cancelled called = %v; want only cancelled", done, cancelled)
+	}
+
+	// Stopping a fade calls neither
+	cancelled = false
+	fader.FadeWithCancel(Session("s1"), 0.3, 0, time.Hour, func(error) { done = true }, func() { cancelled = true })
+	if level, ok := fader.Stop(Session("s1")); !ok || level != 0.3 {
+		t.Errorf("Stop = %v, %v; want 0.3, true", level, ok)
+	}
+	if done || cancelled {
+		t.Error("a stopped fade called back")
+	}
+}
@@ -0,0 +1,636 @@
+package audioBackend
+
+import (
+	"fmt"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"sync"
+)
+
+// . Fake is an in-memory AudioBackend for tests. Scripting methods (SetDevices,
+// SetSessions, SetInaccessible, Emit*) shape what the code under test sees, and
+// every change made through the AudioBackend methods is recorded and echoed to
+// watchers the way a real backend would report it.
+type Fake struct {
+	mu             sync.Mutex
+	devices        []mmDeviceEnumerator.AudioDevice
+	captureDevices []mmDeviceEnumerator.AudioDevice
+	volumes        map[string]float32
+	mutes          map[string]bool
+	channels       map[string][]float32 // per-channel volumes; devices without an entry are stereo at their volume
+	formats        map[string]mmDeviceEnumerator.DeviceFormat
+	supported      map[string][]mmDeviceEnumerator.DeviceFormat
+	peaks          map[string]float32
+	sessionPeaks   map[string]float32 // session ID -> peak
+	inaccessible   map[string]bool
+	devicesErr     error
+	sessions       []policyConfig.AudioSession
+	sessionDevices map[uint32]string // pid -> output device the app is routed to
+
+	nextWatchID     int
+	deviceWatchers  map[int]func(mmDeviceEnumerator.DeviceEvent)
+	volumeWatchers  map[int]fakeVolumeWatch
+	sessionWatchers map[int]func(policyConfig.SessionEvent)
+}
+
+type fakeVolumeWatch struct {
+	deviceID string
+	onNotify func(policyConfig.VolumeNotification)
+}
+
+// . NewFake returns an empty fake backend with no devices or sessions
+func NewFake() *Fake {
+	f := &Fake{}
+	f.Reset()
+	return f
+}
+
+// ---------------------------------------------------------------------------
+// Scripting
+// ---------------------------------------------------------------------------
+
+// . Reset drops every device, session, scripted failure and watcher, returning the
+// fake to the state NewFake produces
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = nil
+	f.captureDevices = nil
+	f.volumes = make(map[string]float32)
+	f.mutes = make(map[string]bool)
+	f.channels = make(map[string][]float32)
+	f.formats = make(map[string]mmDeviceEnumerator.DeviceFormat)
+	f.supported = make(map[string][]mmDeviceEnumerator.DeviceFormat)
+	f.peaks = make(map[string]float32)
+	f.sessionPeaks = make(map[string]float32)
+	f.inaccessible = make(map[string]bool)
+	f.devicesErr = nil
+	f.sessions = nil
+	f.sessionDevices = make(map[uint32]string)
+	f.deviceWatchers = make(map[int]func(mmDeviceEnumerator.DeviceEvent))
+	f.volumeWatchers = make(map[int]fakeVolumeWatch)
+	f.sessionWatchers = make(map[int]func(policyConfig.SessionEvent))
+}
+
+// . SetDevices replaces the output device list. Devices without a scripted volume start at 100%.
+func (f *Fake) SetDevices(devices ...mmDeviceEnumerator.AudioDevice) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = f.addVolumes(devices)
+}
+
+// . SetCaptureDevices replaces the recording device list
+func (f *Fake) SetCaptureDevices(devices ...mmDeviceEnumerator.AudioDevice) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range devices {
+		devices[i].IsCapture = true
+	}
+	f.captureDevices = f.addVolumes(devices)
+}
+
+func (f *Fake) addVolumes(devices []mmDeviceEnumerator.AudioDevice) []mmDeviceEnumerator.AudioDevice {
+	for _, device := range devices {
+		if _, ok := f.volumes[device.Id]; !ok {
+			f.volumes[device.Id] = 1
+		}
+	}
+	return append([]mmDeviceEnumerator.AudioDevice(nil), devices...)
+}
+
+// . SetDevicesError makes GetDevices fail with err (nil restores normal behaviour)
+func (f *Fake) SetDevicesError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devicesErr = err
+}
+
+// . SetInaccessible makes the volume calls of a device fail, like an unreachable
+// endpoint (e.g. Remote Audio over RDP)
+func (f *Fake) SetInaccessible(deviceID string, inaccessible bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inaccessible[deviceID] = inaccessible
+}
+
+// . SetSessions replaces the session list. Setters find sessions by their ID.
+func (f *Fake) SetSessions(sessions ...policyConfig.AudioSession) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = append([]policyConfig.AudioSession(nil), sessions...)
+}
+
+// . Volume returns the recorded volume of a device
+func (f *Fake) Volume(deviceID string) float32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.volumes[deviceID]
+}
+
+// . SetEndpointState sets a device's volume and mute without notifying watchers
+func (f *Fake) SetEndpointState(deviceID string, level float32, muted bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.volumes[deviceID] = level
+	f.mutes[deviceID] = muted
+}
+
+// . SetChannels scripts the per-channel volumes of a device without notifying watchers.
+// The device volume becomes the loudest channel.
+func (f *Fake) SetChannels(deviceID string, levels ...float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.channels[deviceID] = append([]float32(nil), levels...)
+	f.volumes[deviceID] = loudest(levels)
+}
+
+// . SetFormats scripts a device's current format and the formats it supports
+func (f *Fake) SetFormats(deviceID string, current mmDeviceEnumerator.DeviceFormat, supported ...mmDeviceEnumerator.DeviceFormat) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.formats[deviceID] = current
+	f.supported[deviceID] = append([]mmDeviceEnumerator.DeviceFormat(nil), supported...)
+}
+
+// . SetPeak sets the level GetPeak reports for a device
+func (f *Fake) SetPeak(deviceID string, peak float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peaks[deviceID] = peak
+}
+
+// . SetSessionPeak sets the level GetSessionPeaks and GetSessionPeak report for a session
+func (f *Fake) SetSessionPeak(id string, peak float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessionPeaks[id] = peak
+}
+
+// . EmitDeviceEvent delivers ev to every device watcher
+func (f *Fake) EmitDeviceEvent(ev mmDeviceEnumerator.DeviceEvent) {
+	f.mu.Lock()
+	watchers := make([]func(mmDeviceEnumerator.DeviceEvent), 0, len(f.deviceWatchers))
+	for _, fn := range f.deviceWatchers {
+		watchers = append(watchers, fn)
+	}
+	f.mu.Unlock()
+	for _, fn := range watchers {
+		fn(ev)
+	}
+}
+
+// . EmitVolume delivers n to the watchers of n.DeviceID
+func (f *Fake) EmitVolume(n policyConfig.VolumeNotification) {
+	f.mu.Lock()
+	var watchers []func(policyConfig.VolumeNotification)
+	for _, w := range f.volumeWatchers {
+		if w.deviceID == n.DeviceID {
+			watchers = append(watchers, w.onNotify)
+		}
+	}
+	f.mu.Unlock()
+	for _, fn := range watchers {
+		fn(n)
+	}
+}
+
+// . EmitSessionEvent delivers ev to every session watcher
+func (f *Fake) EmitSessionEvent(ev policyConfig.SessionEvent) {
+	f.mu.Lock()
+	watchers := make([]func(policyConfig.SessionEvent), 0, len(f.sessionWatchers))
+	for _, fn := range f.sessionWatchers {
+		watchers = append(watchers, fn)
+	}
+	f.mu.Unlock()
+	for _, fn := range watchers {
+		fn(ev)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// AudioBackend
+// ---------------------------------------------------------------------------
+
+func (f *Fake) BindThread() func() {
+	return func() {}
+}
+
+func (f *Fake) GetDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.devicesErr != nil {
+		return nil, f.devicesErr
+	}
+	return append([]mmDeviceEnumerator.AudioDevice{}, f.devices...), nil
+}
+
+func (f *Fake) GetCaptureDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.captureDevices) == 0 {
+		//! Mirrors WASAPI: without a recording device there is no default capture endpoint
+		return nil, fmt.Errorf("no default capture device")
+	}
+	return append([]mmDeviceEnumerator.AudioDevice{}, f.captureDevices...), nil
+}
+
+func (f *Fake) SetDefaultDevice(deviceID string, roles ...uint32) error {
+	f.mu.Lock()
+	devices := f.devices
+	flow := mmDeviceEnumerator.FlowRender
+	if f.indexOf(f.captureDevices, deviceID) >= 0 {
+		devices = f.captureDevices
+		flow = mmDeviceEnumerator.FlowCapture
+	} else if f.indexOf(f.devices, deviceID) < 0 {
+		f.mu.Unlock()
+		return fmt.Errorf("device with ID %s not found", deviceID)
+	}
+	for i := range devices {
+		isTarget := devices[i].Id == deviceID
+		for _, role := range roles {
+			switch role {
+			case mmDeviceEnumerator.RoleConsole:
+				devices[i].IsDefault = isTarget
+			case mmDeviceEnumerator.RoleMultimedia:
+				devices[i].IsDefaultMultimedia = isTarget
+			case mmDeviceEnumerator.RoleCommunications:
+				devices[i].IsDefaultCommunications = isTarget
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	for _, role := range roles {
+		f.EmitDeviceEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DefaultDeviceChanged, DeviceId: deviceID, Flow: flow, Role: role})
+	}
+	return nil
+}
+
+func (f *Fake) indexOf(devices []mmDeviceEnumerator.AudioDevice, deviceID string) int {
+	for i := range devices {
+		if devices[i].Id == deviceID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *Fake) endpointErr(deviceID string) error {
+	if f.inaccessible[deviceID] {
+		return fmt.Errorf("device %s is inaccessible", deviceID)
+	}
+	device := f.device(deviceID)
+	if device == nil {
+		return fmt.Errorf("device with ID %s not found", deviceID)
+	}
+	if device.IsDisabled {
+		//! Mirrors WASAPI: a disabled endpoint cannot be activated
+		return fmt.Errorf("device %s is disabled", deviceID)
+	}
+	return nil
+}
+
+// . device returns the output or recording device with the given ID, or nil
+func (f *Fake) device(deviceID string) *mmDeviceEnumerator.AudioDevice {
+	if i := f.indexOf(f.devices, deviceID); i >= 0 {
+		return &f.devices[i]
+	}
+	if i := f.indexOf(f.captureDevices, deviceID); i >= 0 {
+		return &f.captureDevices[i]
+	}
+	return nil
+}
+
+func (f *Fake) GetVolume(deviceID string) (float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return 0, err
+	}
+	return f.volumes[deviceID], nil
+}
+
+func (f *Fake) SetVolume(deviceID string, level float32) error {
+	f.mu.Lock()
+	if err := f.endpointErr(deviceID); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	//* Like the real endpoint, the master volume scales every channel and keeps the balance
+	if channels, ok := f.channels[deviceID]; ok {
+		top := loudest(channels)
+		for i := range channels {
+			if top == 0 {
+				channels[i] = level
+			} else {
+				channels[i] = channels[i] * level / top
+			}
+		}
+	}
+	f.volumes[deviceID] = level
+	n := f.notification(deviceID)
+	f.mu.Unlock()
+
+	f.EmitVolume(n)
+	return nil
+}
+
+func (f *Fake) GetMute(deviceID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return false, err
+	}
+	return f.mutes[deviceID], nil
+}
+
+func (f *Fake) SetMute(deviceID string, muted bool) error {
+	f.mu.Lock()
+	if err := f.endpointErr(deviceID); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	f.mutes[deviceID] = muted
+	n := f.notification(deviceID)
+	f.mu.Unlock()
+
+	f.EmitVolume(n)
+	return nil
+}
+
+func (f *Fake) GetChannelVolumes(deviceID string) ([]float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return nil, err
+	}
+	return f.channelVolumes(deviceID), nil
+}
+
+func (f *Fake) SetChannelVolume(deviceID string, channel uint32, level float32) error {
+	f.mu.Lock()
+	if err := f.endpointErr(deviceID); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	channels := f.channelVolumes(deviceID)
+	if int(channel) >= len(channels) {
+		f.mu.Unlock()
+		return fmt.Errorf("device %s has no channel %d", deviceID, channel)
+	}
+	channels[channel] = level
+	f.channels[deviceID] = channels
+	f.volumes[deviceID] = loudest(channels)
+	n := f.notification(deviceID)
+	f.mu.Unlock()
+
+	f.EmitVolume(n)
+	return nil
+}
+
+// . channelVolumes returns a copy of a device's channel volumes. Must be called with f.mu held.
+func (f *Fake) channelVolumes(deviceID string) []float32 {
+	if channels, ok := f.channels[deviceID]; ok {
+		return append([]float32(nil), channels...)
+	}
+	return []float32{f.volumes[deviceID], f.volumes[deviceID]}
+}
+
+// . notification describes a device's current endpoint state as our own change. Must be
+// called with f.mu held.
+func (f *Fake) notification(deviceID string) policyConfig.VolumeNotification {
+	return policyConfig.VolumeNotification{
+		DeviceID:       deviceID,
+		Volume:         f.volumes[deviceID],
+		Muted:          f.mutes[deviceID],
+		ChannelVolumes: f.channelVolumes(deviceID),
+		FromSelf:       true,
+	}
+}
+
+func loudest(levels []float32) float32 {
+	var top float32
+	for _, level := range levels {
+		top = max(top, level)
+	}
+	return top
+}
+
+// . fakeDefaultFormat is the format of devices without a scripted one
+var fakeDefaultFormat = mmDeviceEnumerator.DeviceFormat{SampleRate: 48000, BitsPerSample: 16, ContainerBits: 16, Channels: 2, ChannelMask: 0x3}
+
+func (f *Fake) GetDeviceFormat(deviceID string) (mmDeviceEnumerator.DeviceFormat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return mmDeviceEnumerator.DeviceFormat{}, err
+	}
+	if format, ok := f.formats[deviceID]; ok {
+		return format, nil
+	}
+	return fakeDefaultFormat, nil
+}
+
+func (f *Fake) GetSupportedFormats(deviceID string) ([]mmDeviceEnumerator.DeviceFormat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return nil, err
+	}
+	if supported, ok := f.supported[deviceID]; ok && len(supported) > 0 {
+		return append([]mmDeviceEnumerator.DeviceFormat(nil), supported...), nil
+	}
+	if format, ok := f.formats[deviceID]; ok {
+		return []mmDeviceEnumerator.DeviceFormat{format}, nil
+	}
+	return []mmDeviceEnumerator.DeviceFormat{fakeDefaultFormat}, nil
+}
+
+func (f *Fake) SetDeviceFormat(deviceID string, format mmDeviceEnumerator.DeviceFormat) error {
+	f.mu.Lock()
+	if err := f.endpointErr(deviceID); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	f.formats[deviceID] = format
+	f.mu.Unlock()
+
+	//* Windows reports a format change as a property change of the endpoint
+	f.EmitDeviceEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DevicePropertyChanged, DeviceId: deviceID})
+	return nil
+}
+
+func (f *Fake) SetDeviceEnabled(deviceID string, enabled bool) error {
+	f.mu.Lock()
+	device := f.device(deviceID)
+	if device == nil {
+		f.mu.Unlock()
+		return fmt.Errorf("device with ID %s not found", deviceID)
+	}
+	device.IsDisabled = !enabled
+	f.mu.Unlock()
+
+	f.EmitDeviceEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DeviceStateChanged, DeviceId: deviceID})
+	return nil
+}
+
+func (f *Fake) GetPeak(deviceID string) (float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return 0, err
+	}
+	return f.peaks[deviceID], nil
+}
+
+func (f *Fake) GetSessions() ([]policyConfig.AudioSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]policyConfig.AudioSession{}, f.sessions...), nil
+}
+
+func (f *Fake) GetSessionPeaks() ([]policyConfig.SessionPeak, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	peaks := make([]policyConfig.SessionPeak, len(f.sessions))
+	for i, s := range f.sessions {
+		peaks[i] = policyConfig.SessionPeak{ID: s.ID, Peak: f.sessionPeaks[s.ID]}
+	}
+	return peaks, nil
+}
+
+func (f *Fake) GetSessionPeak(id string) (float32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.sessions {
+		if s.ID == id {
+			return f.sessionPeaks[id], nil
+		}
+	}
+	return 0, fmt.Errorf("no audio session with ID %s", id)
+}
+
+// . updateSession applies fn to the session with the given ID and echoes the result to
+// session watchers
+func (f *Fake) updateSession(id string, fn func(*policyConfig.AudioSession)) error {
+	f.mu.Lock()
+	var ev *policyConfig.SessionEvent
+	for i := range f.sessions {
+		s := &f.sessions[i]
+		if s.ID != id {
+			continue
+		}
+		fn(s)
+		ev = &policyConfig.SessionEvent{
+			Kind:     policyConfig.SessionVolumeChanged,
+			ID:       s.ID,
+			PID:      s.PID,
+			IsSystem: s.IsSystem,
+			Volume:   s.Volume,
+			Muted:    s.Muted,
+			FromSelf: true,
+		}
+		break
+	}
+	f.mu.Unlock()
+
+	if ev == nil {
+		return fmt.Errorf("no audio session with ID %s", id)
+	}
+	f.EmitSessionEvent(*ev)
+	return nil
+}
+
+func (f *Fake) SetSessionVolume(id string, level float32) error {
+	return f.updateSession(id, func(s *policyConfig.AudioSession) { s.Volume = level })
+}
+
+func (f *Fake) SetSessionMute(id string, muted bool) error {
+	return f.updateSession(id, func(s *policyConfig.AudioSession) { s.Muted = muted })
+}
+
+func (f *Fake) GetSessionDevice(pid uint32) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessionDevices[pid], nil
+}
+
+func (f *Fake) SetSessionDevice(pid uint32, deviceID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pid == 0 {
+		return fmt.Errorf("invalid process ID provided")
+	}
+	if deviceID == "" {
+		delete(f.sessionDevices, pid)
+		return nil
+	}
+	if f.indexOf(f.devices, deviceID) < 0 {
+		return fmt.Errorf("device with ID %s not found", deviceID)
+	}
+	f.sessionDevices[pid] = deviceID
+	return nil
+}
+
+func (f *Fake) WatchDevices(onEvent func(mmDeviceEnumerator.DeviceEvent)) (Watcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.addWatch()
+	f.deviceWatchers[id] = onEvent
+	return &fakeWatcher{close: func() { f.removeWatch(id) }}, nil
+}
+
+func (f *Fake) WatchEndpointVolume(deviceID string, onNotify func(policyConfig.VolumeNotification)) (Watcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.endpointErr(deviceID); err != nil {
+		return nil, err
+	}
+	id := f.addWatch()
+	f.volumeWatchers[id] = fakeVolumeWatch{deviceID: deviceID, onNotify: onNotify}
+	return &fakeWatcher{close: func() { f.removeWatch(id) }}, nil
+}
+
+func (f *Fake) WatchSessions(onEvent func(policyConfig.SessionEvent)) (SessionWatcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.addWatch()
+	f.sessionWatchers[id] = onEvent
+	return &fakeWatcher{close: func() { f.removeWatch(id) }}, nil
+}
+
+// . WatcherCount reports how many subscriptions of any kind are still registered
+func (f *Fake) WatcherCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.deviceWatchers) + len(f.volumeWatchers) + len(f.sessionWatchers)
+}
+
+func (f *Fake) addWatch() int {
+	f.nextWatchID++
+	return f.nextWatchID
+}
+
+func (f *Fake) removeWatch(id int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.deviceWatchers, id)
+	delete(f.volumeWatchers, id)
+	delete(f.sessionWatchers, id)
+}
+
+// . fakeWatcher implements Watcher and SessionWatcher for the fake
+type fakeWatcher struct {
+	once  sync.Once
+	close func()
+}
+
+func (w *fakeWatcher) Close() error {
+	w.once.Do(w.close)
+	return nil
+}
+
+// . Refresh is a no-op: fake session events are delivered to the watcher directly
+func (w *fakeWatcher) Refresh() error {
+	return nil
+}
@@ -0,0 +1,551 @@
+//go:build !windows
+
+package audioBackend
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"soundshift/interfaces/pulseAudio"
+	"sync"
+	"time"
+)
+
+// selfEchoWindow is how long after one of our own writes a change event on the same
+// device or session is attributed to SoundShift. PulseAudio events carry no context.
+const selfEchoWindow = 250 * time.Millisecond
+
+// . PulseAudio is the Linux backend. It talks the PulseAudio native protocol, which
+// PipeWire serves as well. Commands share one lazily opened connection that is
+// re-opened after the server goes away; every watcher gets a connection of its own.
+type PulseAudio struct {
+	dial func(onEvent func(pulseAudio.Event)) (*pulseAudio.Client, error)
+
+	mu     sync.Mutex
+	client *pulseAudio.Client
+	writes map[string]time.Time // last write per device / session, for FromSelf
+}
+
+// . NewPulseAudio returns a backend for the user's PulseAudio server. No connection is
+// made until the first call.
+func NewPulseAudio() *PulseAudio {
+	return NewPulseAudioWith(pulseAudio.Dial)
+}
+
+// . NewPulseAudioWith returns a backend that opens its connections with dial
+func NewPulseAudioWith(dial func(onEvent func(pulseAudio.Event)) (*pulseAudio.Client, error)) *PulseAudio {
+	return &PulseAudio{dial: dial, writes: make(map[string]time.Time)}
+}
+
+func (p *PulseAudio) conn() (*pulseAudio.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil && p.client.Err() == nil {
+		return p.client, nil
+	}
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+	c, err := p.dial(nil)
+	if err != nil {
+		return nil, err
+	}
+	p.client = c
+	return c, nil
+}
+
+func (p *PulseAudio) markWrite(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes[key] = time.Now()
+}
+
+func (p *PulseAudio) isOwnWrite(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Since(p.writes[key]) < selfEchoWindow
+}
+
+func deviceKey(deviceID string) string {
+	return "device:" + deviceID
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// . BindThread is a no-op: the protocol client can be used from any goroutine
+func (p *PulseAudio) BindThread() func() {
+	return func() {}
+}
+
+func (p *PulseAudio) GetDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	c, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetDevices()
+}
+
+func (p *PulseAudio) GetCaptureDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	c, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetCaptureDevices()
+}
+
+func (p *PulseAudio) SetDefaultDevice(deviceID string, roles ...uint32) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	return c.SetDefaultDevice(deviceID, roles...)
+}
+
+func (p *PulseAudio) GetVolume(deviceID string) (float32, error) {
+	c, err := p.conn()
+	if err != nil {
+		return 0, err
+	}
+	return c.GetVolume(deviceID)
+}
+
+func (p *PulseAudio) SetVolume(deviceID string, level float32) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	p.markWrite(deviceKey(deviceID))
+	return c.SetVolume(deviceID, level)
+}
+
+func (p *PulseAudio) GetMute(deviceID string) (bool, error) {
+	c, err := p.conn()
+	if err != nil {
+		return false, err
+	}
+	return c.GetMute(deviceID)
+}
+
+func (p *PulseAudio) SetMute(deviceID string, muted bool) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	p.markWrite(deviceKey(deviceID))
+	return c.SetMute(deviceID, muted)
+}
+
+func (p *PulseAudio) GetChannelVolumes(deviceID string) ([]float32, error) {
+	c, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetChannelVolumes(deviceID)
+}
+
+func (p *PulseAudio) SetChannelVolume(deviceID string, channel uint32, level float32) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	p.markWrite(deviceKey(deviceID))
+	return c.SetChannelVolume(deviceID, channel, level)
+}
+
+func (p *PulseAudio) GetDeviceFormat(deviceID string) (mmDeviceEnumerator.DeviceFormat, error) {
+	c, err := p.conn()
+	if err != nil {
+		return mmDeviceEnumerator.DeviceFormat{}, err
+	}
+	return c.GetDeviceFormat(deviceID)
+}
+
+// . GetSupportedFormats only offers the current format: the server resamples every stream
+// to it, and changing it means reloading the device's module
+func (p *PulseAudio) GetSupportedFormats(deviceID string) ([]mmDeviceEnumerator.DeviceFormat, error) {
+	format, err := p.GetDeviceFormat(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return []mmDeviceEnumerator.DeviceFormat{format}, nil
+}
+
+func (p *PulseAudio) SetDeviceFormat(deviceID string, format mmDeviceEnumerator.DeviceFormat) error {
+	return fmt.Errorf("changing the format of %s is not supported with PulseAudio: %w", deviceID, errors.ErrUnsupported)
+}
+
+// . SetDeviceEnabled is not supported: PulseAudio has no disabled state for a device short of
+// switching its card to the "off" profile, which would take every device of the card with it
+func (p *PulseAudio) SetDeviceEnabled(deviceID string, enabled bool) error {
+	return fmt.Errorf("enabling or disabling %s is not supported with PulseAudio: %w", deviceID, errors.ErrUnsupported)
+}
+
+// . errNoMetering is returned by the peak meter calls: PulseAudio only reports levels
+// through a peak-detecting record stream per device or stream, which this backend does
+// not open
+var errNoMetering = fmt.Errorf("peak metering is not available with PulseAudio: %w", errors.ErrUnsupported)
+
+func (p *PulseAudio) GetPeak(deviceID string) (float32, error) {
+	return 0, errNoMetering
+}
+
+func (p *PulseAudio) GetSessions() ([]policyConfig.AudioSession, error) {
+	c, err := p.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetSessions()
+}
+
+func (p *PulseAudio) SetSessionVolume(id string, level float32) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	p.markWrite(sessionKey(id))
+	return c.SetSessionVolume(id, level)
+}
+
+func (p *PulseAudio) SetSessionMute(id string, muted bool) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	p.markWrite(sessionKey(id))
+	return c.SetSessionMute(id, muted)
+}
+
+func (p *PulseAudio) GetSessionPeaks() ([]policyConfig.SessionPeak, error) {
+	return nil, errNoMetering
+}
+
+func (p *PulseAudio) GetSessionPeak(id string) (float32, error) {
+	return 0, errNoMetering
+}
+
+func (p *PulseAudio) GetSessionDevice(pid uint32) (string, error) {
+	c, err := p.conn()
+	if err != nil {
+		return "", err
+	}
+	return c.GetSessionDevice(pid)
+}
+
+func (p *PulseAudio) SetSessionDevice(pid uint32, deviceID string) error {
+	c, err := p.conn()
+	if err != nil {
+		return err
+	}
+	return c.SetSessionDevice(pid, deviceID)
+}
+
+// ---------------------------------------------------------------------------
+// Watchers
+// ---------------------------------------------------------------------------
+
+// . pulseWatcher owns the subscribed connection of one watcher
+type pulseWatcher struct {
+	client *pulseAudio.Client
+	once   sync.Once
+	err    error
+}
+
+func (w *pulseWatcher) Close() error {
+	w.once.Do(func() { w.err = w.client.Close() })
+	return w.err
+}
+
+// . subscribe opens a watcher connection. onEvent only runs after setup has returned,
+// so it can rely on whatever state setup prepared.
+func (p *PulseAudio) subscribe(mask uint32, setup func(c *pulseAudio.Client) error, onEvent func(c *pulseAudio.Client, ev pulseAudio.Event)) (*pulseWatcher, error) {
+	ready := make(chan struct{})
+	var c *pulseAudio.Client
+	c, err := p.dial(func(ev pulseAudio.Event) {
+		<-ready
+		onEvent(c, ev)
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := &pulseWatcher{client: c}
+	if err := setup(c); err != nil {
+		close(ready)
+		w.Close()
+		return nil, err
+	}
+	if err := c.Subscribe(mask); err != nil {
+		close(ready)
+		w.Close()
+		return nil, err
+	}
+	close(ready)
+	return w, nil
+}
+
+// . WatchDevices reports sinks and sources appearing, disappearing or being renamed,
+// and changes of the default sink or source (as a change for every role)
+func (p *PulseAudio) WatchDevices(onEvent func(mmDeviceEnumerator.DeviceEvent)) (Watcher, error) {
+	type known struct {
+		name, description string
+	}
+	devices := map[[2]uint32]known{} // {facility, index} -> device
+	var defaults pulseAudio.ServerInfo
+
+	lookup := func(c *pulseAudio.Client, facility, index uint32) (known, bool) {
+		if facility == pulseAudio.FacilitySink {
+			sink, err := c.Sink(index)
+			return known{sink.Name, sink.Description}, err == nil
+		}
+		source, err := c.Source(index)
+		if err != nil || source.MonitorOfSink != pulseAudio.InvalidIndex {
+			return known{}, false
+		}
+		return known{source.Name, source.Description}, true
+	}
+
+	setup := func(c *pulseAudio.Client) error {
+		info, err := c.ServerInfo()
+		if err != nil {
+			return err
+		}
+		defaults = info
+		sinks, err := c.Sinks()
+		if err != nil {
+			return err
+		}
+		for _, sink := range sinks {
+			devices[[2]uint32{pulseAudio.FacilitySink, sink.Index}] = known{sink.Name, sink.Description}
+		}
+		sources, err := c.Sources()
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			if source.MonitorOfSink == pulseAudio.InvalidIndex {
+				devices[[2]uint32{pulseAudio.FacilitySource, source.Index}] = known{source.Name, source.Description}
+			}
+		}
+		return nil
+	}
+
+	handle := func(c *pulseAudio.Client, ev pulseAudio.Event) {
+		if ev.Facility == pulseAudio.FacilityServer {
+			info, err := c.ServerInfo()
+			if err != nil {
+				return
+			}
+			changed := []struct {
+				flow         uint32
+				old, current string
+			}{
+				{mmDeviceEnumerator.FlowRender, defaults.DefaultSink, info.DefaultSink},
+				{mmDeviceEnumerator.FlowCapture, defaults.DefaultSource, info.DefaultSource},
+			}
+			defaults = info
+			for _, d := range changed {
+				if d.old == d.current {
+					continue
+				}
+				for _, role := range []uint32{mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia, mmDeviceEnumerator.RoleCommunications} {
+					onEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DefaultDeviceChanged, DeviceId: d.current, Flow: d.flow, Role: role})
+				}
+			}
+			return
+		}
+
+		flow := mmDeviceEnumerator.FlowRender
+		if ev.Facility == pulseAudio.FacilitySource {
+			flow = mmDeviceEnumerator.FlowCapture
+		}
+		key := [2]uint32{ev.Facility, ev.Index}
+		switch ev.Type {
+		case pulseAudio.EventNew:
+			device, ok := lookup(c, ev.Facility, ev.Index)
+			if !ok {
+				return // a monitor source, or gone again already
+			}
+			devices[key] = device
+			onEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DeviceAdded, DeviceId: device.name, Flow: flow})
+		case pulseAudio.EventRemove:
+			device, ok := devices[key]
+			if !ok {
+				return
+			}
+			delete(devices, key)
+			onEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DeviceRemoved, DeviceId: device.name, Flow: flow})
+		case pulseAudio.EventChange:
+			//* Volume changes also arrive here; only a rename matters to the device list
+			old, tracked := devices[key]
+			device, ok := lookup(c, ev.Facility, ev.Index)
+			if !tracked || !ok || device == old {
+				return
+			}
+			devices[key] = device
+			onEvent(mmDeviceEnumerator.DeviceEvent{Kind: mmDeviceEnumerator.DevicePropertyChanged, DeviceId: device.name, Flow: flow})
+		}
+	}
+
+	w, err := p.subscribe(pulseAudio.SubscribeSink|pulseAudio.SubscribeSource|pulseAudio.SubscribeServer, setup, handle)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// . WatchEndpointVolume reports volume and mute changes of one sink or source
+func (p *PulseAudio) WatchEndpointVolume(deviceID string, onNotify func(policyConfig.VolumeNotification)) (Watcher, error) {
+	var index uint32
+	var isSource bool
+
+	setup := func(c *pulseAudio.Client) error {
+		device, source, err := c.FindDevice(deviceID)
+		index, isSource = device.Index, source
+		return err
+	}
+
+	handle := func(c *pulseAudio.Client, ev pulseAudio.Event) {
+		wantFacility := pulseAudio.FacilitySink
+		if isSource {
+			wantFacility = pulseAudio.FacilitySource
+		}
+		if ev.Facility != wantFacility || ev.Index != index || ev.Type != pulseAudio.EventChange {
+			return
+		}
+		var device pulseAudio.Sink
+		var err error
+		if isSource {
+			var source pulseAudio.Source
+			source, err = c.Source(index)
+			device = source.Sink
+		} else {
+			device, err = c.Sink(index)
+		}
+		if err != nil {
+			return
+		}
+		channels := make([]float32, len(device.Volume))
+		for i, v := range device.Volume {
+			channels[i] = pulseAudio.VolumeScalar([]uint32{v})
+		}
+		onNotify(policyConfig.VolumeNotification{
+			DeviceID:       deviceID,
+			Volume:         pulseAudio.VolumeScalar(device.Volume),
+			Muted:          device.Muted,
+			ChannelVolumes: channels,
+			FromSelf:       p.isOwnWrite(deviceKey(deviceID)),
+		})
+	}
+
+	w, err := p.subscribe(pulseAudio.SubscribeSink|pulseAudio.SubscribeSource, setup, handle)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// . pulseSessionWatcher reports changes of the streams on every sink
+type pulseSessionWatcher struct {
+	*pulseWatcher
+
+	mu      sync.Mutex
+	streams map[uint32]pulseAudio.SinkInput // sink input index -> last seen state
+}
+
+// . Refresh re-reads the streams so later removals can still be attributed to a session
+func (w *pulseSessionWatcher) Refresh() error {
+	if err := w.client.Err(); err != nil {
+		return err
+	}
+	return w.load(w.client)
+}
+
+func (w *pulseSessionWatcher) load(c *pulseAudio.Client) error {
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.streams = make(map[uint32]pulseAudio.SinkInput)
+	for _, in := range inputs {
+		w.streams[in.Index] = in
+	}
+	return nil
+}
+
+func (p *PulseAudio) WatchSessions(onEvent func(policyConfig.SessionEvent)) (SessionWatcher, error) {
+	sw := &pulseSessionWatcher{}
+
+	handle := func(c *pulseAudio.Client, ev pulseAudio.Event) {
+		if ev.Facility != pulseAudio.FacilitySinkInput {
+			return
+		}
+
+		sw.mu.Lock()
+		old, tracked := sw.streams[ev.Index]
+		sw.mu.Unlock()
+
+		var current pulseAudio.SinkInput
+		exists := false
+		if ev.Type != pulseAudio.EventRemove {
+			in, err := c.SinkInput(ev.Index)
+			if err != nil {
+				return
+			}
+			current, exists = in, true
+		}
+
+		sw.mu.Lock()
+		if exists {
+			sw.streams[ev.Index] = current
+		} else {
+			delete(sw.streams, ev.Index)
+		}
+		sw.mu.Unlock()
+
+		id := pulseAudio.SessionID(ev.Index)
+		switch {
+		case !tracked && exists:
+			onEvent(policyConfig.SessionEvent{Kind: policyConfig.SessionCreated})
+		case tracked && !exists:
+			pid, isSystem := pulseAudio.SessionOwner(old)
+			onEvent(policyConfig.SessionEvent{Kind: policyConfig.SessionDisconnected, ID: id, PID: pid, IsSystem: isSystem})
+		case tracked && current.Sink != old.Sink:
+			//* Moved to another sink; the session list must be re-read for its new device
+			onEvent(policyConfig.SessionEvent{Kind: policyConfig.SessionCreated})
+		case tracked:
+			pid, isSystem := pulseAudio.SessionOwner(current)
+			if current.Corked != old.Corked {
+				state := uint32(policyConfig.SessionStateActive)
+				if current.Corked {
+					state = policyConfig.SessionStateInactive
+				}
+				onEvent(policyConfig.SessionEvent{Kind: policyConfig.SessionStateChanged, ID: id, PID: pid, IsSystem: isSystem, State: state})
+			}
+			if current.Muted != old.Muted || !slices.Equal(current.Volume, old.Volume) {
+				onEvent(policyConfig.SessionEvent{
+					Kind:     policyConfig.SessionVolumeChanged,
+					ID:       id,
+					PID:      pid,
+					IsSystem: isSystem,
+					Volume:   pulseAudio.VolumeScalar(current.Volume),
+					Muted:    current.Muted,
+					FromSelf: p.isOwnWrite(sessionKey(id)),
+				})
+			}
+		}
+	}
+
+	w, err := p.subscribe(pulseAudio.SubscribeSinkInput, sw.load, handle)
+	if err != nil {
+		return nil, err
+	}
+	sw.pulseWatcher = w
+	return sw, nil
+}
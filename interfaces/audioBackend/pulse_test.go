@@ -0,0 +1,195 @@
+//go:build !windows
+
+package audioBackend
+
+import (
+	"errors"
+	"path/filepath"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"soundshift/interfaces/pulseAudio"
+	"testing"
+	"time"
+)
+
+// newPulseTest starts a fake PulseAudio server with two sinks and a browser stream on
+// the default one, and returns a backend connected to it.
+func newPulseTest(t *testing.T) (*PulseAudio, *pulseAudio.FakeServer) {
+	t.Helper()
+	s, err := pulseAudio.NewFakeServer(filepath.Join(t.TempDir(), "native"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	s.AddSink(pulseAudio.Sink{Index: 0, Name: "speakers", Description: "Speakers", Volume: []uint32{0x8000, 0x8000}})
+	s.AddSink(pulseAudio.Sink{Index: 1, Name: "headset", Description: "Headset", Volume: []uint32{0x10000}})
+	s.SetDefaults("speakers", "")
+	s.AddSinkInput(pulseAudio.SinkInput{Index: 10, Sink: 0, Volume: []uint32{0x10000}, Properties: map[string]string{
+		"application.name":       "Firefox",
+		"application.process.id": "4242",
+	}})
+
+	p := NewPulseAudioWith(func(onEvent func(pulseAudio.Event)) (*pulseAudio.Client, error) {
+		return pulseAudio.DialPath(s.Path(), onEvent)
+	})
+	return p, s
+}
+
+// receive waits for the next value on ch
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a notification")
+		var zero T
+		return zero
+	}
+}
+
+func TestPulseWatchDevicesReportsDefaultSwitch(t *testing.T) {
+	p, s := newPulseTest(t)
+	events := make(chan mmDeviceEnumerator.DeviceEvent, 16)
+	w, err := p.WatchDevices(func(ev mmDeviceEnumerator.DeviceEvent) { events <- ev })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := p.SetDefaultDevice("headset", mmDeviceEnumerator.RoleConsole); err != nil {
+		t.Fatal(err)
+	}
+	ev := receive(t, events)
+	if ev.Kind != mmDeviceEnumerator.DefaultDeviceChanged || ev.DeviceId != "headset" || ev.Flow != mmDeviceEnumerator.FlowRender || ev.Role != mmDeviceEnumerator.RoleConsole {
+		t.Errorf("event = %+v, want the headset as default render device", ev)
+	}
+
+	s.RemoveSink(1)
+	for ev.Kind == mmDeviceEnumerator.DefaultDeviceChanged {
+		ev = receive(t, events) // the remaining roles of the switch
+	}
+	if ev.Kind != mmDeviceEnumerator.DeviceRemoved || ev.DeviceId != "headset" {
+		t.Errorf("event = %+v, want the headset removed", ev)
+	}
+}
+
+func TestPulseWatchEndpointVolume(t *testing.T) {
+	p, s := newPulseTest(t)
+	notes := make(chan policyConfig.VolumeNotification, 16)
+	w, err := p.WatchEndpointVolume("speakers", func(n policyConfig.VolumeNotification) { notes <- n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := p.SetVolume("speakers", 0.25); err != nil {
+		t.Fatal(err)
+	}
+	n := receive(t, notes)
+	if n.DeviceID != "speakers" || n.Volume != 0.25 || len(n.ChannelVolumes) != 2 || !n.FromSelf {
+		t.Errorf("notification = %+v, want our own change to 25%%", n)
+	}
+
+	// A change from another client
+	time.Sleep(selfEchoWindow)
+	s.UpdateSink(pulseAudio.Sink{Index: 0, Name: "speakers", Description: "Speakers", Volume: []uint32{0x10000, 0x10000}, Muted: true})
+	n = receive(t, notes)
+	if n.Volume != 1 || !n.Muted || n.FromSelf {
+		t.Errorf("notification = %+v, want an outside change to 100%% and muted", n)
+	}
+
+	if _, err := p.WatchEndpointVolume("missing", func(policyConfig.VolumeNotification) {}); err == nil {
+		t.Error("watching an unknown device should fail")
+	}
+}
+
+func TestPulseWatchSessions(t *testing.T) {
+	p, s := newPulseTest(t)
+	events := make(chan policyConfig.SessionEvent, 16)
+	w, err := p.WatchSessions(func(ev policyConfig.SessionEvent) { events <- ev })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := p.SetSessionMute("10", true); err != nil {
+		t.Fatal(err)
+	}
+	ev := receive(t, events)
+	if ev.Kind != policyConfig.SessionVolumeChanged || ev.ID != "10" || ev.PID != 4242 || !ev.Muted || !ev.FromSelf {
+		t.Errorf("event = %+v, want our own mute of PID 4242", ev)
+	}
+
+	s.AddSinkInput(pulseAudio.SinkInput{Index: 11, Sink: 0, Volume: []uint32{0x10000}, Properties: map[string]string{
+		"application.name":       "Spotify",
+		"application.process.id": "5151",
+	}})
+	if ev := receive(t, events); ev.Kind != policyConfig.SessionCreated {
+		t.Errorf("event = %+v, want a new session", ev)
+	}
+
+	// Moving the stream to another sink needs the session list re-read for its new device
+	s.UpdateSinkInput(pulseAudio.SinkInput{Index: 11, Sink: 1, Volume: []uint32{0x10000}, Properties: map[string]string{
+		"application.process.id": "5151",
+	}})
+	if ev := receive(t, events); ev.Kind != policyConfig.SessionCreated {
+		t.Errorf("event = %+v, want the moved session re-read", ev)
+	}
+
+	s.RemoveSinkInput(10)
+	if ev := receive(t, events); ev.Kind != policyConfig.SessionDisconnected || ev.PID != 4242 {
+		t.Errorf("event = %+v, want PID 4242 disconnected", ev)
+	}
+}
+
+func TestPulseReconnectsAfterServerRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "native")
+	start := func() *pulseAudio.FakeServer {
+		s, err := pulseAudio.NewFakeServer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AddSink(pulseAudio.Sink{Index: 0, Name: "speakers", Description: "Speakers", Volume: []uint32{0x10000}})
+		s.SetDefaults("speakers", "")
+		return s
+	}
+	p := NewPulseAudioWith(func(onEvent func(pulseAudio.Event)) (*pulseAudio.Client, error) {
+		return pulseAudio.DialPath(path, onEvent)
+	})
+
+	s := start()
+	if _, err := p.GetDevices(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = start()
+	defer s.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		devices, err := p.GetDevices()
+		if err == nil && len(devices) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backend did not reconnect: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPulseMeteringIsUnsupported(t *testing.T) {
+	p, _ := newPulseTest(t)
+	if _, err := p.GetPeak("speakers"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("GetPeak error = %v, want errors.ErrUnsupported", err)
+	}
+	if _, err := p.GetSessionPeaks(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("GetSessionPeaks error = %v, want errors.ErrUnsupported", err)
+	}
+	if _, err := p.GetSessionPeak("1"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("GetSessionPeak error = %v, want errors.ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,141 @@
+//go:build windows
+
+package audioBackend
+
+import (
+	"runtime"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+)
+
+// . WASAPI is the Windows backend; it forwards to mmDeviceEnumerator and policyConfig
+type WASAPI struct{}
+
+// . BindThread locks the goroutine to its OS thread and initialises COM on it, so every
+// COM call and callback registration made from it stays on the same apartment
+func (WASAPI) BindThread() func() {
+	runtime.LockOSThread()
+	ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
+	return func() {
+		ole.CoUninitialize()
+		runtime.UnlockOSThread()
+	}
+}
+
+func (WASAPI) GetDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	return mmDeviceEnumerator.GetDevices()
+}
+
+func (WASAPI) GetCaptureDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	return mmDeviceEnumerator.GetCaptureDevices()
+}
+
+func (WASAPI) SetDefaultDevice(deviceID string, roles ...uint32) error {
+	eRoles := make([]wca.ERole, len(roles))
+	for i, role := range roles {
+		eRoles[i] = wca.ERole(role)
+	}
+	return policyConfig.SetDefaultEndPointForRoles(deviceID, eRoles...)
+}
+
+func (WASAPI) GetVolume(deviceID string) (float32, error) {
+	return policyConfig.GetVolume(deviceID)
+}
+
+func (WASAPI) SetVolume(deviceID string, level float32) error {
+	return policyConfig.SetVolume(deviceID, level)
+}
+
+func (WASAPI) GetMute(deviceID string) (bool, error) {
+	return policyConfig.GetMute(deviceID)
+}
+
+func (WASAPI) SetMute(deviceID string, muted bool) error {
+	return policyConfig.SetMute(deviceID, muted)
+}
+
+func (WASAPI) GetChannelVolumes(deviceID string) ([]float32, error) {
+	return policyConfig.GetChannelVolumes(deviceID)
+}
+
+func (WASAPI) SetChannelVolume(deviceID string, channel uint32, level float32) error {
+	return policyConfig.SetChannelVolume(deviceID, channel, level)
+}
+
+func (WASAPI) GetDeviceFormat(deviceID string) (mmDeviceEnumerator.DeviceFormat, error) {
+	return mmDeviceEnumerator.GetDeviceFormat(deviceID)
+}
+
+func (WASAPI) GetSupportedFormats(deviceID string) ([]mmDeviceEnumerator.DeviceFormat, error) {
+	return mmDeviceEnumerator.GetSupportedFormats(deviceID)
+}
+
+func (WASAPI) SetDeviceFormat(deviceID string, format mmDeviceEnumerator.DeviceFormat) error {
+	return policyConfig.SetDeviceFormat(deviceID, format)
+}
+
+func (WASAPI) SetDeviceEnabled(deviceID string, enabled bool) error {
+	return policyConfig.SetEndpointVisibility(deviceID, enabled)
+}
+
+func (WASAPI) GetPeak(deviceID string) (float32, error) {
+	return policyConfig.GetPeak(deviceID)
+}
+
+func (WASAPI) GetSessions() ([]policyConfig.AudioSession, error) {
+	return policyConfig.GetAudioSessions()
+}
+
+func (WASAPI) SetSessionVolume(id string, level float32) error {
+	return policyConfig.SetSessionVolume(id, level)
+}
+
+func (WASAPI) SetSessionMute(id string, muted bool) error {
+	return policyConfig.SetSessionMute(id, muted)
+}
+
+func (WASAPI) GetSessionPeaks() ([]policyConfig.SessionPeak, error) {
+	return policyConfig.GetSessionPeaks()
+}
+
+func (WASAPI) GetSessionPeak(id string) (float32, error) {
+	return policyConfig.GetSessionPeak(id)
+}
+
+func (WASAPI) GetSessionDevice(pid uint32) (string, error) {
+	return policyConfig.GetAppDefaultEndpoint(pid, mmDeviceEnumerator.FlowRender)
+}
+
+func (WASAPI) SetSessionDevice(pid uint32, deviceID string) error {
+	return policyConfig.SetAppDefaultEndpoint(pid, mmDeviceEnumerator.FlowRender, deviceID)
+}
+
+// . The Watch* methods return a nil interface on failure rather than a typed nil pointer,
+// so callers can compare the result against nil
+
+func (WASAPI) WatchDevices(onEvent func(mmDeviceEnumerator.DeviceEvent)) (Watcher, error) {
+	notifier, err := mmDeviceEnumerator.RegisterDeviceNotifications(onEvent)
+	if err != nil {
+		return nil, err
+	}
+	return notifier, nil
+}
+
+func (WASAPI) WatchEndpointVolume(deviceID string, onNotify func(policyConfig.VolumeNotification)) (Watcher, error) {
+	watcher, err := policyConfig.WatchEndpointVolume(deviceID, onNotify)
+	if err != nil {
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func (WASAPI) WatchSessions(onEvent func(policyConfig.SessionEvent)) (SessionWatcher, error) {
+	watcher, err := policyConfig.WatchSessions(onEvent)
+	if err != nil {
+		return nil, err
+	}
+	return watcher, nil
+}
@@ -0,0 +1,124 @@
+//go:build windows
+
+package mmDeviceEnumerator
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+	"golang.org/x/sys/windows"
+)
+
+var procPropVariantClear = windows.NewLazySystemDLL("ole32.dll").NewProc("PropVariantClear")
+
+// . GetDeviceFormat reads the shared-mode format of an endpoint from PKEY_AudioEngine_DeviceFormat
+func GetDeviceFormat(deviceID string) (DeviceFormat, error) {
+	device, err := openDevice(deviceID)
+	if err != nil {
+		return DeviceFormat{}, err
+	}
+	defer device.Release()
+
+	//* The format lives in the endpoint's property store as a VT_BLOB holding a WAVEFORMATEX(TENSIBLE)
+	var propStore *wca.IPropertyStore
+	if err := device.OpenPropertyStore(wca.STGM_READ, &propStore); err != nil {
+		return DeviceFormat{}, fmt.Errorf("failed to open property store for device %s: %w", deviceID, err)
+	}
+	defer propStore.Release()
+
+	var value wca.PROPVARIANT
+	if err := propStore.GetValue(&wca.PKEY_AudioEngine_DeviceFormat, &value); err != nil {
+		return DeviceFormat{}, fmt.Errorf("failed to get device format for device %s: %w", deviceID, err)
+	}
+	defer procPropVariantClear.Call(uintptr(unsafe.Pointer(&value)))
+
+	if value.VT != ole.VT_BLOB {
+		return DeviceFormat{}, fmt.Errorf("device %s has no device format", deviceID)
+	}
+	//* BLOB{cbSize, pBlobData} sits where the VARIANT keeps its value
+	blob := (*struct {
+		_    [8]byte
+		size uint32
+		data *byte
+	})(unsafe.Pointer(&value))
+	return ParseWaveFormat(unsafe.Slice(blob.data, blob.size))
+}
+
+// . GetSupportedFormats lists the common formats the endpoint's driver accepts, probed in
+// exclusive mode the way the Windows sound control panel builds its "Default Format" list.
+// All formats keep the endpoint's current channel layout.
+func GetSupportedFormats(deviceID string) ([]DeviceFormat, error) {
+	current, err := GetDeviceFormat(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := openDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer device.Release()
+
+	var client *wca.IAudioClient
+	if err := device.Activate(wca.IID_IAudioClient, wca.CLSCTX_ALL, nil, &client); err != nil {
+		return nil, fmt.Errorf("failed to activate audio client for device %s: %w", deviceID, err)
+	}
+	defer client.Release()
+
+	//* Only one container per sample size and rate is listed, like the control panel does
+	type key struct {
+		bits uint16
+		rate uint32
+	}
+	seen := make(map[key]bool)
+	var formats []DeviceFormat
+	for _, candidate := range candidateFormats(current) {
+		k := key{candidate.BitsPerSample, candidate.SampleRate}
+		if seen[k] {
+			continue
+		}
+		wfx := EncodeWaveFormat(candidate)
+		if err := client.IsFormatSupported(wca.AUDCLNT_SHAREMODE_EXCLUSIVE, (*wca.WAVEFORMATEX)(unsafe.Pointer(&wfx[0])), nil); err != nil {
+			continue
+		}
+		seen[k] = true
+		formats = append(formats, candidate)
+	}
+
+	//* A driver that refuses exclusive mode still has its current format
+	if len(formats) == 0 {
+		formats = []DeviceFormat{current}
+	}
+	return formats, nil
+}
+
+// . openDevice returns the endpoint with the given ID, whatever its state. The caller must
+// Release the returned device.
+func openDevice(deviceID string) (*wca.IMMDevice, error) {
+	var mmde *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &mmde); err != nil {
+		return nil, fmt.Errorf("failed to create device enumerator: %w", err)
+	}
+	defer mmde.Release()
+
+	ptr, err := syscall.UTF16PtrFromString(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert deviceID to UTF16 pointer: %w", err)
+	}
+
+	//* go-wca does not implement IMMDeviceEnumerator::GetDevice, so call it through the vtable
+	var device *wca.IMMDevice
+	hr, _, _ := syscall.SyscallN(
+		mmde.VTable().GetDevice,
+		uintptr(unsafe.Pointer(mmde)),
+		uintptr(unsafe.Pointer(ptr)),
+		uintptr(unsafe.Pointer(&device)),
+	)
+	if hr != 0 {
+		return nil, fmt.Errorf("device with ID %s not found: %w", deviceID, ole.NewError(hr))
+	}
+	return device, nil
+}
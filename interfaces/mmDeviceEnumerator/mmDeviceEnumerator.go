@@ -1,3 +1,5 @@
+//go:build windows
+
 package mmDeviceEnumerator
 
 import (
@@ -6,15 +8,18 @@ import (
 	"github.com/moutend/go-wca/pkg/wca"
 )
 
-// . AudioDevice represents an audio device with its name, ID, and default status
-type AudioDevice struct {
-	Name      string // Friendly name of the device (e.g., "Speakers", "Headphones")
-	Id        string // Unique identifier for the device
-	IsDefault bool   // Flag indicating if this is the default audio device
+// . GetDevices retrieves a list of active and disabled output (render) devices and identifies the default device
+func GetDevices() ([]AudioDevice, error) {
+	return getDevices(wca.ERender)
 }
 
-// . GetDevices retrieves a list of active audio devices and identifies the default device
-func GetDevices() ([]AudioDevice, error) {
+// . GetCaptureDevices retrieves a list of active and disabled recording (capture) devices and identifies the default device
+func GetCaptureDevices() ([]AudioDevice, error) {
+	return getDevices(wca.ECapture)
+}
+
+// . getDevices retrieves the active and disabled endpoints for the given data flow (wca.ERender or wca.ECapture)
+func getDevices(flow uint32) ([]AudioDevice, error) {
 	//* Create a COM instance of the multimedia device enumerator
 	var mmde *wca.IMMDeviceEnumerator
 	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &mmde); err != nil {
@@ -23,30 +28,28 @@ func GetDevices() ([]AudioDevice, error) {
 	}
 	defer mmde.Release()
 
-	//* Retrieve the default audio endpoint (render device for console output)
-	var defaultDevice *wca.IMMDevice
-	if err := mmde.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &defaultDevice); err != nil {
+	//* Retrieve the ID of the default audio endpoint for console use in the requested direction
+	defaultId, err := getDefaultId(mmde, flow, wca.EConsole)
+	if err != nil {
 		//! Failed to get the default audio device
-		return nil, fmt.Errorf("failed to get default audio endpoint: %w", err)
+		return nil, err
 	}
-	defer defaultDevice.Release()
 
-	//* Get the ID of the default audio device for later comparison
-	var defaultId string
-	if err := defaultDevice.GetId(&defaultId); err != nil {
-		//! Failed to retrieve the default device ID
-		return nil, fmt.Errorf("failed to get ID of default device: %w", err)
-	}
+	//* The multimedia and communications roles can point at other devices; a failure
+	//* here only means no device is flagged for that role
+	multimediaId, _ := getDefaultId(mmde, flow, wca.EMultimedia)
+	communicationsId, _ := getDefaultId(mmde, flow, wca.ECommunications)
 
-	//* Enumerate all active audio devices (render devices)
+	//* Enumerate the active and disabled audio devices in the requested direction; disabled
+	//* ones are listed so they can be enabled again
 	var mmdc *wca.IMMDeviceCollection
-	if err := mmde.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &mmdc); err != nil {
-		//! Failed to get the collection of active audio devices
+	if err := mmde.EnumAudioEndpoints(flow, wca.DEVICE_STATE_ACTIVE|wca.DEVICE_STATE_DISABLED, &mmdc); err != nil {
+		//! Failed to get the collection of audio devices
 		return nil, fmt.Errorf("failed to enumerate audio endpoints: %w", err)
 	}
 	defer mmdc.Release()
 
-	//* Get the total count of active audio devices
+	//* Get the total count of audio devices
 	var count uint32
 	if err := mmdc.GetCount(&count); err != nil {
 		//! Failed to retrieve the device count
@@ -71,6 +74,13 @@ func GetDevices() ([]AudioDevice, error) {
 			return nil, fmt.Errorf("failed to get ID for device at index %d: %w", i, err)
 		}
 
+		//* Check whether the device is disabled in the sound control panel
+		var state uint32
+		if err := device.GetState(&state); err != nil {
+			//! Failed to get device state
+			return nil, fmt.Errorf("failed to get state for device at index %d: %w", i, err)
+		}
+
 		//* Open the property store to access device properties like its friendly name
 		var propStore *wca.IPropertyStore
 		if err := device.OpenPropertyStore(wca.STGM_READ, &propStore); err != nil {
@@ -86,11 +96,35 @@ func GetDevices() ([]AudioDevice, error) {
 			return nil, fmt.Errorf("failed to get device name for device at index %d: %w", i, err)
 		}
 
-		//* Determine if this device is the default device
-		isDefault := id == defaultId
-		audioDevices[i] = AudioDevice{Name: name.String(), Id: id, IsDefault: isDefault}
+		//* Determine which roles this device is the default for
+		audioDevices[i] = AudioDevice{
+			Name:                    name.String(),
+			Id:                      id,
+			IsDefault:               id == defaultId,
+			IsDefaultMultimedia:     id == multimediaId,
+			IsDefaultCommunications: id == communicationsId,
+			IsCapture:               flow == wca.ECapture,
+			IsDisabled:              state&wca.DEVICE_STATE_DISABLED != 0,
+		}
 	}
 
-	//* Return the list of active audio devices
+	//* Return the list of audio devices
 	return audioDevices, nil
 }
+
+// . getDefaultId returns the ID of the default endpoint for the given data flow and role
+func getDefaultId(mmde *wca.IMMDeviceEnumerator, flow uint32, role uint32) (string, error) {
+	var defaultDevice *wca.IMMDevice
+	if err := mmde.GetDefaultAudioEndpoint(flow, role, &defaultDevice); err != nil {
+		//! Failed to get the default audio device for this role
+		return "", fmt.Errorf("failed to get default audio endpoint: %w", err)
+	}
+	defer defaultDevice.Release()
+
+	var id string
+	if err := defaultDevice.GetId(&id); err != nil {
+		//! Failed to retrieve the default device ID
+		return "", fmt.Errorf("failed to get ID of default device: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+package mmDeviceEnumerator
+
+import (
+	"fmt"
+
+	"github.com/moutend/go-wca/pkg/wca"
+)
+
+// . DeviceNotifier keeps an IMMNotificationClient registered with a device enumerator.
+// The client must stay referenced for as long as it is registered, since Windows
+// calls back into its Go-allocated vtable.
+type DeviceNotifier struct {
+	mmde   *wca.IMMDeviceEnumerator
+	client *wca.IMMNotificationClient
+}
+
+// . RegisterDeviceNotifications registers a notification sink that calls onEvent for every
+// device added/removed/state/default/property change. onEvent runs on a Windows audio
+// thread and must return quickly; hand the event off to a goroutine instead of doing work in it.
+// The caller must have initialized COM on the current thread.
+func RegisterDeviceNotifications(onEvent func(DeviceEvent)) (*DeviceNotifier, error) {
+	//* Create the enumerator the sink is registered with; it lives as long as the notifier
+	var mmde *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &mmde); err != nil {
+		//! Failed to initialize the device enumerator
+		return nil, fmt.Errorf("failed to create device enumerator: %w", err)
+	}
+
+	//* Translate each callback into a DeviceEvent
+	client := wca.NewIMMNotificationClient(wca.IMMNotificationClientCallback{
+		OnDeviceAdded: func(id string) error {
+			onEvent(DeviceEvent{Kind: DeviceAdded, DeviceId: id})
+			return nil
+		},
+		OnDeviceRemoved: func(id string) error {
+			onEvent(DeviceEvent{Kind: DeviceRemoved, DeviceId: id})
+			return nil
+		},
+		OnDeviceStateChanged: func(id string, _ uint64) error {
+			onEvent(DeviceEvent{Kind: DeviceStateChanged, DeviceId: id})
+			return nil
+		},
+		OnDefaultDeviceChanged: func(flow wca.EDataFlow, role wca.ERole, id string) error {
+			onEvent(DeviceEvent{Kind: DefaultDeviceChanged, DeviceId: id, Flow: uint32(flow), Role: uint32(role)})
+			return nil
+		},
+		OnPropertyValueChanged: func(id string, _ uint64) error {
+			onEvent(DeviceEvent{Kind: DevicePropertyChanged, DeviceId: id})
+			return nil
+		},
+	})
+
+	if err := mmde.RegisterEndpointNotificationCallback(client); err != nil {
+		//! Registration failed; release the enumerator so nothing leaks
+		mmde.Release()
+		return nil, fmt.Errorf("failed to register endpoint notification callback: %w", err)
+	}
+
+	return &DeviceNotifier{mmde: mmde, client: client}, nil
+}
+
+// . Close unregisters the notification sink and releases the enumerator
+func (n *DeviceNotifier) Close() error {
+	if n == nil || n.mmde == nil {
+		return nil
+	}
+	defer func() {
+		n.mmde.Release()
+		n.mmde = nil
+	}()
+
+	if err := n.mmde.UnregisterEndpointNotificationCallback(n.client); err != nil {
+		//! Windows refused to unregister the sink
+		return fmt.Errorf("failed to unregister endpoint notification callback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mmDeviceEnumerator
+
+import "fmt"
+
+// . AudioDevice represents an audio device with its name, ID, and default status
+type AudioDevice struct {
+	Name                    string // Friendly name of the device (e.g., "Speakers", "Headphones")
+	Id                      string // Unique identifier for the device
+	IsDefault               bool   // Flag indicating if this is the default audio device (console role)
+	IsDefaultMultimedia     bool   // Flag indicating if this is the default device for the multimedia role
+	IsDefaultCommunications bool   // Flag indicating if this is the default device for the communications role (voice chat)
+	IsCapture               bool   // Flag indicating if this is a recording (capture) device rather than an output device
+	IsDisabled              bool   // Flag indicating if the device is disabled in the sound control panel and cannot play or record
+}
+
+// . Data flow and role values, matching the Windows EDataFlow and ERole enums so they can
+// be passed straight through to WASAPI
+const (
+	FlowRender  uint32 = 0 // Output devices
+	FlowCapture uint32 = 1 // Recording devices
+)
+
+const (
+	RoleConsole        uint32 = 0 // Games, system sounds and most applications
+	RoleMultimedia     uint32 = 1 // Music and movie playback
+	RoleCommunications uint32 = 2 // Voice chat
+)
+
+// . DeviceEventKind identifies which IMMNotificationClient callback produced a DeviceEvent
+type DeviceEventKind int
+
+const (
+	DeviceAdded           DeviceEventKind = iota // A new endpoint was installed
+	DeviceRemoved                                // An endpoint was uninstalled
+	DeviceStateChanged                           // An endpoint became active, disabled, unplugged or not present
+	DefaultDeviceChanged                         // The default endpoint for a flow/role changed
+	DevicePropertyChanged                        // A property of an endpoint (e.g. its friendly name) changed
+)
+
+// . DeviceEvent describes a single endpoint change reported by Windows
+type DeviceEvent struct {
+	Kind     DeviceEventKind
+	DeviceId string // Endpoint ID the event refers to (empty when a default role has no device)
+	Flow     uint32 // Data flow (FlowRender / FlowCapture); only set for DefaultDeviceChanged
+	Role     uint32 // Role (RoleConsole / RoleMultimedia / RoleCommunications); only set for DefaultDeviceChanged
+}
+
+// . DeviceFormat is the shared-mode format of an endpoint, the one chosen under
+// "Default Format" in the Windows sound control panel
+type DeviceFormat struct {
+	SampleRate    uint32 // Samples per second, e.g. 48000
+	BitsPerSample uint16 // Valid bits per sample, e.g. 24
+	ContainerBits uint16 // Bits each sample occupies; 24-bit audio may be carried in 32 bits
+	Channels      uint16 // Number of channels
+	ChannelMask   uint32 // Speaker positions of the channels (SPEAKER_* flags), 0 when unknown
+	Float         bool   // IEEE float samples rather than integer PCM
+}
+
+// . String formats the way the Windows sound control panel lists formats, e.g. "24 bit, 48000 Hz"
+func (f DeviceFormat) String() string {
+	return fmt.Sprintf("%d bit, %d Hz", f.BitsPerSample, f.SampleRate)
+}
@@ -0,0 +1,110 @@
+package mmDeviceEnumerator
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// . Wave format layout: WAVEFORMATEX is 18 packed bytes, WAVEFORMATEXTENSIBLE appends
+// the valid bits, channel mask and subformat GUID for 40 bytes in total. The structs are
+// handled as bytes because Go would pad WAVEFORMATEX to 20.
+const (
+	waveFormatExSize         = 18
+	waveFormatExtensibleSize = 40
+
+	waveFormatPCM        = 0x0001
+	waveFormatIEEEFloat  = 0x0003
+	waveFormatExtensible = 0xFFFE
+)
+
+// . subFormatTail is the part shared by every KSDATAFORMAT_SUBTYPE_* GUID derived from a
+// wave format tag; the tag fills the first four bytes
+var subFormatTail = [12]byte{0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// . ParseWaveFormat decodes a WAVEFORMATEX or WAVEFORMATEXTENSIBLE, as stored in
+// PKEY_AudioEngine_DeviceFormat
+func ParseWaveFormat(b []byte) (DeviceFormat, error) {
+	if len(b) < waveFormatExSize {
+		return DeviceFormat{}, fmt.Errorf("wave format is %d bytes, want at least %d", len(b), waveFormatExSize)
+	}
+	tag := binary.LittleEndian.Uint16(b[0:])
+	f := DeviceFormat{
+		Channels:      binary.LittleEndian.Uint16(b[2:]),
+		SampleRate:    binary.LittleEndian.Uint32(b[4:]),
+		ContainerBits: binary.LittleEndian.Uint16(b[14:]),
+	}
+	f.BitsPerSample = f.ContainerBits
+
+	if tag == waveFormatExtensible {
+		if len(b) < waveFormatExtensibleSize {
+			return DeviceFormat{}, fmt.Errorf("extensible wave format is %d bytes, want %d", len(b), waveFormatExtensibleSize)
+		}
+		if valid := binary.LittleEndian.Uint16(b[18:]); valid != 0 {
+			f.BitsPerSample = valid
+		}
+		f.ChannelMask = binary.LittleEndian.Uint32(b[20:])
+		tag = binary.LittleEndian.Uint16(b[24:]) // subformat GUID, Data1 holds the real tag
+	}
+
+	switch tag {
+	case waveFormatPCM:
+	case waveFormatIEEEFloat:
+		f.Float = true
+	default:
+		return DeviceFormat{}, fmt.Errorf("unsupported wave format tag %#04x", tag)
+	}
+	return f, nil
+}
+
+// . EncodeWaveFormat encodes f as a WAVEFORMATEXTENSIBLE, the form IAudioClient and
+// IPolicyConfig expect for anything beyond 16-bit stereo
+func EncodeWaveFormat(f DeviceFormat) []byte {
+	container := f.ContainerBits
+	if container == 0 {
+		container = f.BitsPerSample
+	}
+	blockAlign := f.Channels * container / 8
+	tag := uint32(waveFormatPCM)
+	if f.Float {
+		tag = waveFormatIEEEFloat
+	}
+
+	b := make([]byte, waveFormatExtensibleSize)
+	binary.LittleEndian.PutUint16(b[0:], waveFormatExtensible)
+	binary.LittleEndian.PutUint16(b[2:], f.Channels)
+	binary.LittleEndian.PutUint32(b[4:], f.SampleRate)
+	binary.LittleEndian.PutUint32(b[8:], f.SampleRate*uint32(blockAlign))
+	binary.LittleEndian.PutUint16(b[12:], blockAlign)
+	binary.LittleEndian.PutUint16(b[14:], container)
+	binary.LittleEndian.PutUint16(b[16:], waveFormatExtensibleSize-waveFormatExSize)
+	binary.LittleEndian.PutUint16(b[18:], f.BitsPerSample)
+	binary.LittleEndian.PutUint32(b[20:], f.ChannelMask)
+	binary.LittleEndian.PutUint32(b[24:], tag)
+	copy(b[28:], subFormatTail[:])
+	return b
+}
+
+// . commonFormats are the sample rates and sample sizes probed for an endpoint's supported
+// formats, as listed by the Windows sound control panel
+var (
+	commonSampleRates = []uint32{44100, 48000, 88200, 96000, 176400, 192000}
+	commonSampleSizes = []struct{ bits, container uint16 }{{16, 16}, {24, 24}, {24, 32}, {32, 32}}
+)
+
+// . candidateFormats lists every common format with the channel layout of current, in the
+// order the control panel shows them
+func candidateFormats(current DeviceFormat) []DeviceFormat {
+	var formats []DeviceFormat
+	for _, size := range commonSampleSizes {
+		for _, rate := range commonSampleRates {
+			formats = append(formats, DeviceFormat{
+				SampleRate:    rate,
+				BitsPerSample: size.bits,
+				ContainerBits: size.container,
+				Channels:      current.Channels,
+				ChannelMask:   current.ChannelMask,
+			})
+		}
+	}
+	return formats
+}
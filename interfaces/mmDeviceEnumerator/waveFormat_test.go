@@ -0,0 +1,58 @@
+package mmDeviceEnumerator
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestWaveFormatRoundTrip(t *testing.T) {
+	for _, want := range []DeviceFormat{
+		{SampleRate: 48000, BitsPerSample: 16, ContainerBits: 16, Channels: 2, ChannelMask: 0x3},
+		{SampleRate: 96000, BitsPerSample: 24, ContainerBits: 32, Channels: 6, ChannelMask: 0x3f},
+		{SampleRate: 44100, BitsPerSample: 32, ContainerBits: 32, Channels: 2, ChannelMask: 0x3, Float: true},
+	} {
+		b := EncodeWaveFormat(want)
+		if len(b) != waveFormatExtensibleSize {
+			t.Fatalf("encoded %d bytes, want %d", len(b), waveFormatExtensibleSize)
+		}
+		if blockAlign := binary.LittleEndian.Uint16(b[12:]); blockAlign != want.Channels*want.ContainerBits/8 {
+			t.Errorf("%v: block align = %d", want, blockAlign)
+		}
+		got, err := ParseWaveFormat(b)
+		if err != nil || got != want {
+			t.Errorf("ParseWaveFormat(EncodeWaveFormat(%+v)) = %+v, %v", want, got, err)
+		}
+	}
+}
+
+func TestParsePlainWaveFormat(t *testing.T) {
+	b := make([]byte, waveFormatExSize)
+	binary.LittleEndian.PutUint16(b[0:], waveFormatPCM)
+	binary.LittleEndian.PutUint16(b[2:], 2)
+	binary.LittleEndian.PutUint32(b[4:], 44100)
+	binary.LittleEndian.PutUint16(b[14:], 16)
+	got, err := ParseWaveFormat(b)
+	if err != nil || got.String() != "16 bit, 44100 Hz" || got.Channels != 2 {
+		t.Errorf("ParseWaveFormat = %+v, %v; want 16 bit, 44100 Hz stereo", got, err)
+	}
+
+	if _, err := ParseWaveFormat(b[:10]); err == nil {
+		t.Error("a truncated format should fail")
+	}
+	binary.LittleEndian.PutUint16(b[0:], 0x0055) // MP3
+	if _, err := ParseWaveFormat(b); err == nil {
+		t.Error("a compressed format should fail")
+	}
+}
+
+func TestCandidateFormatsKeepChannelLayout(t *testing.T) {
+	formats := candidateFormats(DeviceFormat{Channels: 6, ChannelMask: 0x3f})
+	if len(formats) != len(commonSampleRates)*len(commonSampleSizes) {
+		t.Fatalf("got %d candidates", len(formats))
+	}
+	for _, f := range formats {
+		if f.Channels != 6 || f.ChannelMask != 0x3f {
+			t.Fatalf("candidate %+v lost the channel layout", f)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+//go:build windows
+
+package policyConfig
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+	"golang.org/x/sys/windows"
+)
+
+// . IAudioPolicyConfigFactory is the undocumented WinRT factory behind the Windows
+// "App volume and device preferences" page. Only the persisted default endpoint
+// methods are used; the slots before them cover volume groups, the ringer and the
+// preferred chat application.
+type IAudioPolicyConfigFactory struct {
+	ole.IInspectable
+}
+
+// . IAudioPolicyConfigFactoryVtbl contains pointers to the methods of IAudioPolicyConfigFactory
+type IAudioPolicyConfigFactoryVtbl struct {
+	ole.IInspectableVtbl
+	_                                            [19]uintptr
+	SetPersistedDefaultAudioEndpoint             uintptr
+	GetPersistedDefaultAudioEndpoint             uintptr
+	ClearAllPersistedApplicationDefaultEndpoints uintptr
+}
+
+// . VTable retrieves the virtual method table for the IAudioPolicyConfigFactory interface
+func (v *IAudioPolicyConfigFactory) VTable() *IAudioPolicyConfigFactoryVtbl {
+	return (*IAudioPolicyConfigFactoryVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// . The persisted endpoint API takes device interface paths rather than endpoint IDs:
+// the endpoint ID wrapped in the MMDEVAPI prefix and the render or capture interface class
+const (
+	mmDevApiPrefix         = `\\?\SWD#MMDEVAPI#`
+	renderInterfaceSuffix  = "#{e6327cad-dcec-4949-ae8a-991e976a79d2}"
+	captureInterfaceSuffix = "#{2eef81be-33fa-4800-9670-1cd474972c3f}"
+)
+
+// . newAudioPolicyConfigFactory activates the factory. Its IID changed in Windows 10 build 21390.
+func newAudioPolicyConfigFactory() (*IAudioPolicyConfigFactory, error) {
+	iid := ole.NewGUID("2A59116D-6C4F-45E0-A74F-707E3FEF9258")
+	if windows.RtlGetVersion().BuildNumber >= 21390 {
+		iid = ole.NewGUID("AB3D4648-E242-459F-B02F-541C70306324")
+	}
+
+	inspectable, err := ole.RoGetActivationFactory("Windows.Media.Internal.AudioPolicyConfig", iid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to activate AudioPolicyConfig factory: %w", err)
+	}
+	return (*IAudioPolicyConfigFactory)(unsafe.Pointer(inspectable)), nil
+}
+
+// . SetAppDefaultEndpoint routes every stream of a process with the given flow
+// (mmDeviceEnumerator.FlowRender or FlowCapture) to deviceID. An empty deviceID
+// makes the process follow the system default again. Windows persists the choice
+// per executable, so it also applies to later instances of the app.
+func SetAppDefaultEndpoint(pid uint32, flow uint32, deviceID string) error {
+	if pid == 0 {
+		return fmt.Errorf("invalid process ID provided")
+	}
+
+	factory, err := newAudioPolicyConfigFactory()
+	if err != nil {
+		return err
+	}
+	defer factory.Release()
+
+	//* A null HSTRING clears the assignment
+	var hstring ole.HString
+	if deviceID != "" {
+		hstring, err = ole.NewHString(toInterfacePath(deviceID, flow))
+		if err != nil {
+			return fmt.Errorf("failed to create HSTRING for device ID: %w", err)
+		}
+		defer ole.DeleteHString(hstring)
+	}
+
+	//* Windows' own settings page assigns both the console and multimedia roles
+	for _, role := range []wca.ERole{wca.EConsole, wca.EMultimedia} {
+		hr, _, e := syscall.SyscallN(
+			factory.VTable().SetPersistedDefaultAudioEndpoint,
+			uintptr(unsafe.Pointer(factory)),
+			uintptr(pid),
+			uintptr(flow),
+			uintptr(role),
+			uintptr(hstring),
+		)
+		if e != 0 {
+			return fmt.Errorf("syscall failed: %v", e)
+		}
+		if hr != 0 {
+			return fmt.Errorf("failed to set app endpoint for role %v: %w", role, ole.NewError(hr))
+		}
+	}
+	return nil
+}
+
+// . GetAppDefaultEndpoint returns the device a process is routed to for the given flow,
+// or "" when it follows the system default
+func GetAppDefaultEndpoint(pid uint32, flow uint32) (string, error) {
+	if pid == 0 {
+		return "", nil
+	}
+
+	factory, err := newAudioPolicyConfigFactory()
+	if err != nil {
+		return "", err
+	}
+	defer factory.Release()
+
+	var hstring ole.HString
+	hr, _, e := syscall.SyscallN(
+		factory.VTable().GetPersistedDefaultAudioEndpoint,
+		uintptr(unsafe.Pointer(factory)),
+		uintptr(pid),
+		uintptr(flow),
+		uintptr(wca.EMultimedia),
+		uintptr(unsafe.Pointer(&hstring)),
+	)
+	if e != 0 {
+		return "", fmt.Errorf("syscall failed: %v", e)
+	}
+	if hr != 0 {
+		return "", fmt.Errorf("failed to get app endpoint: %w", ole.NewError(hr))
+	}
+	if hstring == 0 {
+		return "", nil
+	}
+	defer ole.DeleteHString(hstring)
+	return fromInterfacePath(hstring.String()), nil
+}
+
+// . toInterfacePath wraps an endpoint ID in the device interface path the factory expects
+func toInterfacePath(deviceID string, flow uint32) string {
+	suffix := renderInterfaceSuffix
+	if flow == wca.ECapture {
+		suffix = captureInterfaceSuffix
+	}
+	return mmDevApiPrefix + deviceID + suffix
+}
+
+// . fromInterfacePath strips the device interface path back to an endpoint ID
+func fromInterfacePath(path string) string {
+	path = strings.TrimPrefix(path, mmDevApiPrefix)
+	path = strings.TrimSuffix(path, renderInterfaceSuffix)
+	return strings.TrimSuffix(path, captureInterfaceSuffix)
+}
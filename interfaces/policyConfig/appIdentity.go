@@ -0,0 +1,175 @@
+//go:build windows
+
+package policyConfig
+
+import (
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+	"golang.org/x/sys/windows"
+)
+
+// . PackagedAppIconPrefix starts the IconPath of a packaged (Store) app that did not set an
+// icon on its session: the rest is the app's AppUserModelID, whose logo the shell renders
+const PackagedAppIconPrefix = `shell:AppsFolder\`
+
+// . applicationUserModelIDMaxLength is APPLICATION_USER_MODEL_ID_MAX_LENGTH, terminator included
+const applicationUserModelIDMaxLength = 130
+
+var (
+	procGetApplicationUserModelId   = modKernel32.NewProc("GetApplicationUserModelId")
+	procSHLoadIndirectString        = windows.NewLazySystemDLL("shlwapi.dll").NewProc("SHLoadIndirectString")
+	procSHCreateItemFromParsingName = windows.NewLazySystemDLL("shell32.dll").NewProc("SHCreateItemFromParsingName")
+)
+
+// . iShellItem is the shell's IShellItem; only GetDisplayName is used
+type iShellItem struct {
+	ole.IUnknown
+}
+
+// . iShellItemVtbl contains pointers to the methods of iShellItem
+type iShellItemVtbl struct {
+	ole.IUnknownVtbl
+	BindToHandler  uintptr
+	GetParent      uintptr
+	GetDisplayName uintptr
+	GetAttributes  uintptr
+	Compare        uintptr
+}
+
+// . VTable retrieves the virtual method table for the iShellItem interface
+func (v *iShellItem) VTable() *iShellItemVtbl {
+	return (*iShellItemVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// . packagedAppNames caches the display names of packaged apps by AppUserModelID, and
+// indirectStrings the resolved indirect display names, since sessions are re-read on
+// every mixer refresh
+var (
+	packagedAppNames sync.Map // map[string]string
+	indirectStrings  sync.Map // map[string]string
+)
+
+// . sessionString reads a string property of a session (GetDisplayName or GetIconPath).
+// The wca wrappers dereference the result even when the call fails, so the vtable is
+// called directly. Returns "" when the session did not set the property.
+func sessionString(ctrl *wca.IAudioSessionControl, method uintptr) string {
+	var ptr *uint16
+	hr, _, _ := syscall.SyscallN(method, uintptr(unsafe.Pointer(ctrl)), uintptr(unsafe.Pointer(&ptr)))
+	if hr != 0 || ptr == nil {
+		return ""
+	}
+	defer ole.CoTaskMemFree(uintptr(unsafe.Pointer(ptr)))
+	return strings.TrimSpace(windows.UTF16PtrToString(ptr))
+}
+
+// . loadIndirectString resolves an indirect "@file,-id" resource string, as sessions often
+// give their display name. Other strings are returned as they are, and unresolvable ones as "".
+func loadIndirectString(s string) string {
+	if !strings.HasPrefix(s, "@") {
+		return s
+	}
+	if cached, ok := indirectStrings.Load(s); ok {
+		return cached.(string)
+	}
+	resolved := resolveIndirectString(s)
+	indirectStrings.Store(s, resolved)
+	return resolved
+}
+
+// . resolveIndirectString loads an indirect resource string through the shell, or returns
+// "" when it cannot be resolved
+func resolveIndirectString(s string) string {
+	src, err := syscall.UTF16PtrFromString(s)
+	if err != nil {
+		return ""
+	}
+	var buf [512]uint16
+	hr, _, _ := procSHLoadIndirectString.Call(
+		uintptr(unsafe.Pointer(src)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		0,
+	)
+	if hr != 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:])
+}
+
+// . appUserModelID returns the AppUserModelID of a packaged process, or "" for a classic
+// desktop process
+func appUserModelID(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+
+	var buf [applicationUserModelIDMaxLength]uint16
+	n := uint32(len(buf))
+	//* Unpackaged processes fail with APPMODEL_ERROR_NO_APPLICATION
+	r1, _, _ := procGetApplicationUserModelId.Call(
+		uintptr(h),
+		uintptr(unsafe.Pointer(&n)),
+		uintptr(unsafe.Pointer(&buf[0])),
+	)
+	if r1 != 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf[:])
+}
+
+// . packagedAppName returns the display name the Start menu shows for a packaged app,
+// or "" when the shell does not know the AppUserModelID
+func packagedAppName(aumid string) string {
+	if cached, ok := packagedAppNames.Load(aumid); ok {
+		return cached.(string)
+	}
+
+	name := shellDisplayName(PackagedAppIconPrefix + aumid)
+	packagedAppNames.Store(aumid, name)
+	return name
+}
+
+// . shellDisplayName returns the normal display name of a shell item parsing name
+func shellDisplayName(parsingName string) string {
+	path, err := syscall.UTF16PtrFromString(parsingName)
+	if err != nil {
+		return ""
+	}
+
+	iidShellItem := ole.NewGUID("43826D1E-E718-42EE-BC55-A1E261C37BFE")
+	var item *iShellItem
+	hr, _, _ := procSHCreateItemFromParsingName.Call(
+		uintptr(unsafe.Pointer(path)),
+		0,
+		uintptr(unsafe.Pointer(iidShellItem)),
+		uintptr(unsafe.Pointer(&item)),
+	)
+	if hr != 0 || item == nil {
+		return ""
+	}
+	defer item.Release()
+
+	const sigdnNormalDisplay = 0
+	var ptr *uint16
+	hr, _, _ = syscall.SyscallN(
+		item.VTable().GetDisplayName,
+		uintptr(unsafe.Pointer(item)),
+		sigdnNormalDisplay,
+		uintptr(unsafe.Pointer(&ptr)),
+	)
+	if hr != 0 || ptr == nil {
+		return ""
+	}
+	defer ole.CoTaskMemFree(uintptr(unsafe.Pointer(ptr)))
+	return windows.UTF16PtrToString(ptr)
+}
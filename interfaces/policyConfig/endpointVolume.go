@@ -0,0 +1,199 @@
+//go:build windows
+
+package policyConfig
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+)
+
+// . EventContext is passed as the event-context GUID on every volume/mute change made by
+// SoundShift, so notification handlers can tell their own writes apart from external ones
+var EventContext = ole.NewGUID("{5D0F3C1E-8B2A-4C67-9E41-2F7A6B13C8D5}")
+
+// . audioVolumeNotificationData mirrors AUDIO_VOLUME_NOTIFICATION_DATA. The channel array
+// is variable-length; only the first element is declared.
+type audioVolumeNotificationData struct {
+	GuidEventContext ole.GUID
+	BMuted           int32
+	FMasterVolume    float32
+	NChannels        uint32
+	AfChannelVolumes [1]float32
+}
+
+// . endpointVolumeCallbackVtbl is the IAudioEndpointVolumeCallback vtable
+type endpointVolumeCallbackVtbl struct {
+	QueryInterface uintptr
+	AddRef         uintptr
+	Release        uintptr
+	OnNotify       uintptr
+}
+
+// . endpointVolumeCallback is a Go-implemented IAudioEndpointVolumeCallback COM object.
+// The vtable pointer must stay the first field so COM sees a valid object layout.
+type endpointVolumeCallback struct {
+	vtbl     *endpointVolumeCallbackVtbl
+	refCount int32
+	deviceID string
+	onNotify func(VolumeNotification)
+}
+
+// . The vtable is shared by every callback object: syscall.NewCallback slots are a
+// limited, never-freed resource, so they are created exactly once
+var (
+	endpointVolumeVtblOnce sync.Once
+	endpointVolumeVtbl     *endpointVolumeCallbackVtbl
+)
+
+func getEndpointVolumeVtbl() *endpointVolumeCallbackVtbl {
+	endpointVolumeVtblOnce.Do(func() {
+		endpointVolumeVtbl = &endpointVolumeCallbackVtbl{
+			QueryInterface: syscall.NewCallback(evcQueryInterface),
+			AddRef:         syscall.NewCallback(evcAddRef),
+			Release:        syscall.NewCallback(evcRelease),
+			OnNotify:       syscall.NewCallback(evcOnNotify),
+		}
+	})
+	return endpointVolumeVtbl
+}
+
+func evcQueryInterface(this *endpointVolumeCallback, riid *ole.GUID, ppv **endpointVolumeCallback) uintptr {
+	if ole.IsEqualGUID(riid, ole.IID_IUnknown) || ole.IsEqualGUID(riid, wca.IID_IAudioEndpointVolumeCallback) {
+		evcAddRef(this)
+		*ppv = this
+		return ole.S_OK
+	}
+	*ppv = nil
+	return ole.E_NOINTERFACE
+}
+
+func evcAddRef(this *endpointVolumeCallback) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, 1))
+}
+
+func evcRelease(this *endpointVolumeCallback) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, -1))
+}
+
+func evcOnNotify(this *endpointVolumeCallback, data *audioVolumeNotificationData) uintptr {
+	if data == nil || this.onNotify == nil {
+		return ole.S_OK
+	}
+	channels := make([]float32, data.NChannels)
+	if data.NChannels > 0 {
+		copy(channels, unsafe.Slice(&data.AfChannelVolumes[0], data.NChannels))
+	}
+	this.onNotify(VolumeNotification{
+		DeviceID:       this.deviceID,
+		Volume:         data.FMasterVolume,
+		Muted:          data.BMuted != 0,
+		ChannelVolumes: channels,
+		FromSelf:       ole.IsEqualGUID(&data.GuidEventContext, EventContext),
+	})
+	return ole.S_OK
+}
+
+// EndpointVolumeWatcher keeps an IAudioEndpointVolumeCallback registered on one endpoint.
+// Keep it referenced until Close: Windows calls back into Go-allocated memory.
+type EndpointVolumeWatcher struct {
+	device   *wca.IMMDevice
+	volume   *wca.IAudioEndpointVolume
+	callback *endpointVolumeCallback
+}
+
+// WatchEndpointVolume registers onNotify for volume, mute and channel changes on the given
+// endpoint, whoever makes them (keyboard keys, the Windows flyout, other apps or SoundShift).
+// onNotify runs on a Windows audio thread and must return quickly.
+func WatchEndpointVolume(deviceID string, onNotify func(VolumeNotification)) (*EndpointVolumeWatcher, error) {
+	device, err := findDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var aev *wca.IAudioEndpointVolume
+	if err := device.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &aev); err != nil {
+		device.Release()
+		return nil, fmt.Errorf("failed to activate endpoint volume interface for device %s: %w", deviceID, err)
+	}
+
+	cb := &endpointVolumeCallback{
+		vtbl:     getEndpointVolumeVtbl(),
+		deviceID: deviceID,
+		onNotify: onNotify,
+	}
+
+	hr, _, _ := syscall.SyscallN(
+		aev.VTable().RegisterControlChangeNotify,
+		uintptr(unsafe.Pointer(aev)),
+		uintptr(unsafe.Pointer(cb)),
+	)
+	if hr != 0 {
+		aev.Release()
+		device.Release()
+		return nil, fmt.Errorf("failed to register volume callback for device %s: %w", deviceID, ole.NewError(hr))
+	}
+
+	return &EndpointVolumeWatcher{device: device, volume: aev, callback: cb}, nil
+}
+
+// Close unregisters the callback and releases the endpoint.
+func (w *EndpointVolumeWatcher) Close() error {
+	if w == nil || w.volume == nil {
+		return nil
+	}
+	hr, _, _ := syscall.SyscallN(
+		w.volume.VTable().UnregisterControlChangeNotify,
+		uintptr(unsafe.Pointer(w.volume)),
+		uintptr(unsafe.Pointer(w.callback)),
+	)
+	w.volume.Release()
+	w.device.Release()
+	w.volume = nil
+	w.device = nil
+	if hr != 0 {
+		return fmt.Errorf("failed to unregister volume callback: %w", ole.NewError(hr))
+	}
+	return nil
+}
+
+// findDevice returns the active endpoint (output or recording) with the given ID.
+// The caller must Release the returned device.
+func findDevice(deviceID string) (*wca.IMMDevice, error) {
+	var deviceEnumerator *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &deviceEnumerator); err != nil {
+		return nil, fmt.Errorf("failed to create device enumerator instance: %w", err)
+	}
+	defer deviceEnumerator.Release()
+
+	var deviceCollection *wca.IMMDeviceCollection
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.EAll, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+		return nil, fmt.Errorf("failed to enumerate audio endpoints: %w", err)
+	}
+	defer deviceCollection.Release()
+
+	var count uint32
+	if err := deviceCollection.GetCount(&count); err != nil {
+		return nil, fmt.Errorf("failed to get count of devices: %w", err)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var device *wca.IMMDevice
+		if err := deviceCollection.Item(i, &device); err != nil {
+			continue
+		}
+		var id string
+		if err := device.GetId(&id); err != nil || id != deviceID {
+			device.Release()
+			continue
+		}
+		return device, nil
+	}
+
+	return nil, fmt.Errorf("device with ID %s not found", deviceID)
+}
@@ -1,8 +1,11 @@
+//go:build windows
+
 package policyConfig
 
 import (
 	"errors"
 	"fmt"
+	"soundshift/interfaces/mmDeviceEnumerator"
 	"syscall"
 	"unsafe"
 
@@ -49,27 +52,31 @@ func (v *IPolicyConfig) SetDefaultEndpoint(deviceID string, eRole wca.ERole) err
 	return nil
 }
 
-// . SetDefaultEndPoint sets the given device as the default endpoint for multimedia and communication roles
+// . SetDefaultEndPoint sets the given device as the default endpoint for multimedia and communication roles.
+// Works for both output (render) and recording (capture) endpoints; Windows infers the direction from the ID.
 func SetDefaultEndPoint(deviceId string) error {
-	//* Validate the provided device ID
+	return SetDefaultEndPointForRoles(deviceId, wca.EConsole, wca.EMultimedia, wca.ECommunications)
+}
+
+// . SetDefaultEndPointForRoles sets the given device as the default endpoint for only the listed roles,
+// e.g. wca.ECommunications alone to move voice chat without touching the multimedia default
+func SetDefaultEndPointForRoles(deviceId string, roles ...wca.ERole) error {
+	//* Validate the provided device ID and roles
 	if deviceId == "" {
 		return fmt.Errorf("invalid device ID provided")
 	}
-
-	//* Define GUIDs for the IPolicyConfig COM interface and the client instance
-	CPolicyConfigClientUID := ole.NewGUID("870AF99C-171D-4F9E-AF0D-E63DF40C2BC9")
-	IPolicyConfigUID := ole.NewGUID("F8679F50-850A-41CF-9C72-430F290290C8")
+	if len(roles) == 0 {
+		return fmt.Errorf("no roles provided")
+	}
 
 	//* Create an instance of IPolicyConfig to access audio policy configuration methods
-	var pcv *IPolicyConfig
-	if err := wca.CoCreateInstance(CPolicyConfigClientUID, 0, wca.CLSCTX_ALL, IPolicyConfigUID, &pcv); err != nil {
-		//! Return an error if the COM instance creation fails
-		return fmt.Errorf("failed to create IPolicyConfig instance: %w", err)
+	pcv, release, err := newPolicyConfig()
+	if err != nil {
+		return err
 	}
-	defer pcv.Release() // Ensure the COM object is released after usage
+	defer release()
 
-	//* Set the specified device as the default endpoint for console, multimedia, and communication roles
-	roles := []wca.ERole{wca.EConsole, wca.EMultimedia, wca.ECommunications}
+	//* Set the specified device as the default endpoint for each requested role
 	for _, role := range roles {
 		if err := pcv.SetDefaultEndpoint(deviceId, role); err != nil {
 			//! Return an error if setting the default endpoint fails for any role
@@ -77,10 +84,25 @@ func SetDefaultEndPoint(deviceId string) error {
 		}
 	}
 
-	//* Default endpoint successfully set for all roles
+	//* Default endpoint successfully set for all requested roles
 	return nil
 }
 
+// . newPolicyConfig creates an instance of the IPolicyConfig COM interface, and returns it
+// with the func that releases it
+func newPolicyConfig() (*IPolicyConfig, func(), error) {
+	//* Define GUIDs for the IPolicyConfig COM interface and the client instance
+	CPolicyConfigClientUID := ole.NewGUID("870AF99C-171D-4F9E-AF0D-E63DF40C2BC9")
+	IPolicyConfigUID := ole.NewGUID("F8679F50-850A-41CF-9C72-430F290290C8")
+
+	var pcv *IPolicyConfig
+	if err := wca.CoCreateInstance(CPolicyConfigClientUID, 0, wca.CLSCTX_ALL, IPolicyConfigUID, &pcv); err != nil {
+		//! Return an error if the COM instance creation fails
+		return nil, nil, fmt.Errorf("failed to create IPolicyConfig instance: %w", err)
+	}
+	return pcv, func() { pcv.Release() }, nil
+}
+
 // . pcvSetDefaultEndpoint makes a syscall to set the default audio endpoint for a specific role
 func pcvSetDefaultEndpoint(pcv *IPolicyConfig, deviceID string, eRole wca.ERole) error {
 	//* Validate that the IPolicyConfig reference is not nil
@@ -115,6 +137,84 @@ func pcvSetDefaultEndpoint(pcv *IPolicyConfig, deviceID string, eRole wca.ERole)
 	return nil
 }
 
+// . SetEndpointVisibility enables or disables the specified audio device, as the "Enable" and
+// "Disable" entries of the Windows sound control panel do. A disabled device is hidden from
+// every application, not just SoundShift.
+func SetEndpointVisibility(deviceID string, visible bool) error {
+	if deviceID == "" {
+		return fmt.Errorf("invalid device ID provided")
+	}
+
+	pcv, release, err := newPolicyConfig()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ptr, err := syscall.UTF16PtrFromString(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to convert deviceID to UTF16 pointer: %w", err)
+	}
+
+	var isVisible uintptr
+	if visible {
+		isVisible = 1
+	}
+	hr, _, e := syscall.SyscallN(
+		pcv.VTable().SetEndpointVisibility,
+		uintptr(unsafe.Pointer(pcv)),
+		uintptr(unsafe.Pointer(ptr)),
+		isVisible,
+	)
+	if e != 0 {
+		return fmt.Errorf("syscall failed: %v", e)
+	}
+	if hr != 0 {
+		return fmt.Errorf("failed to set visibility of device %s: %w", deviceID, ole.NewError(hr))
+	}
+	return nil
+}
+
+// . SetDeviceFormat sets the shared-mode format of the specified audio device, as the
+// "Default Format" setting of the Windows sound control panel does. The audio engine mixes
+// in 32-bit float at the same rate and channel layout.
+func SetDeviceFormat(deviceID string, format mmDeviceEnumerator.DeviceFormat) error {
+	if deviceID == "" {
+		return fmt.Errorf("invalid device ID provided")
+	}
+
+	pcv, release, err := newPolicyConfig()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ptr, err := syscall.UTF16PtrFromString(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to convert deviceID to UTF16 pointer: %w", err)
+	}
+
+	mix := format
+	mix.BitsPerSample, mix.ContainerBits, mix.Float = 32, 32, true
+	endpointFormat := mmDeviceEnumerator.EncodeWaveFormat(format)
+	mixFormat := mmDeviceEnumerator.EncodeWaveFormat(mix)
+
+	hr, _, e := syscall.SyscallN(
+		pcv.VTable().SetDeviceFormat,
+		uintptr(unsafe.Pointer(pcv)),
+		uintptr(unsafe.Pointer(ptr)),
+		uintptr(unsafe.Pointer(&endpointFormat[0])),
+		uintptr(unsafe.Pointer(&mixFormat[0])),
+	)
+	if e != 0 {
+		return fmt.Errorf("syscall failed: %v", e)
+	}
+	if hr != 0 {
+		return fmt.Errorf("failed to set format %s for device %s: %w", format, deviceID, ole.NewError(hr))
+	}
+	return nil
+}
+
 // . SetVolume sets the volume level for the specified audio device
 func SetVolume(deviceID string, volumeLevel float32) error {
 	var deviceEnumerator *wca.IMMDeviceEnumerator
@@ -127,8 +227,8 @@ func SetVolume(deviceID string, volumeLevel float32) error {
 	}
 	defer deviceEnumerator.Release()
 
-	//* Enumerate active audio rendering devices
-	if err := deviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+	//* Enumerate active output and recording devices
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.EAll, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
 		return fmt.Errorf("failed to enumerate audio endpoints: %w", err)
 	}
 	defer deviceCollection.Release()
@@ -166,8 +266,8 @@ func SetVolume(deviceID string, volumeLevel float32) error {
 		}
 		defer audioEndpointVolume.Release()
 
-		//* Set the master volume level for the device
-		if err := audioEndpointVolume.SetMasterVolumeLevelScalar(volumeLevel, nil); err != nil {
+		//* Set the master volume level for the device, tagged so volume callbacks can recognise our own change
+		if err := audioEndpointVolume.SetMasterVolumeLevelScalar(volumeLevel, EventContext); err != nil {
 			return fmt.Errorf("failed to set volume level for device %s: %w", deviceID, err)
 		}
 		return nil
@@ -176,6 +276,67 @@ func SetVolume(deviceID string, volumeLevel float32) error {
 	return nil
 }
 
+// . SetMute mutes or unmutes the specified audio device
+func SetMute(deviceID string, muted bool) error {
+	var deviceEnumerator *wca.IMMDeviceEnumerator
+	var deviceCollection *wca.IMMDeviceCollection
+	var audioEndpointVolume *wca.IAudioEndpointVolume
+
+	//* Create an instance of the device enumerator to access audio devices
+	if err := wca.CoCreateInstance(wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL, wca.IID_IMMDeviceEnumerator, &deviceEnumerator); err != nil {
+		return fmt.Errorf("failed to create device enumerator instance: %w", err)
+	}
+	defer deviceEnumerator.Release()
+
+	//* Enumerate active output and recording devices
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.EAll, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+		return fmt.Errorf("failed to enumerate audio endpoints: %w", err)
+	}
+	defer deviceCollection.Release()
+
+	//* Get the count of available audio devices
+	var count uint32
+	if err := deviceCollection.GetCount(&count); err != nil {
+		return fmt.Errorf("failed to get count of devices: %w", err)
+	}
+
+	//* Iterate over each device to find the one matching the specified deviceID
+	for i := uint32(0); i < count; i++ {
+		var device *wca.IMMDevice
+		if err := deviceCollection.Item(i, &device); err != nil {
+			continue
+		}
+
+		var id string
+		if err := device.GetId(&id); err != nil {
+			device.Release()
+			continue
+		}
+
+		if id != deviceID {
+			device.Release()
+			continue
+		}
+
+		// Found the matching device — release when done
+		defer device.Release()
+
+		//* Activate the audio endpoint volume interface for mute control
+		if err := device.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &audioEndpointVolume); err != nil {
+			return fmt.Errorf("failed to activate endpoint volume interface for device %s: %w", deviceID, err)
+		}
+		defer audioEndpointVolume.Release()
+
+		//* Set the mute state, tagged so volume callbacks can recognise our own change
+		if err := audioEndpointVolume.SetMute(muted, EventContext); err != nil {
+			return fmt.Errorf("failed to set mute state for device %s: %w", deviceID, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("device with ID %s not found", deviceID)
+}
+
 // . GetVolume retrieves the current volume level for the specified audio device
 func GetVolume(deviceID string) (float32, error) {
 	var deviceEnumerator *wca.IMMDeviceEnumerator
@@ -188,8 +349,8 @@ func GetVolume(deviceID string) (float32, error) {
 	}
 	defer deviceEnumerator.Release()
 
-	//* Enumerate active audio rendering devices
-	if err := deviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+	//* Enumerate active output and recording devices
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.EAll, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
 		return 0, fmt.Errorf("failed to enumerate audio endpoints: %w", err)
 	}
 	defer deviceCollection.Release()
@@ -249,8 +410,8 @@ func GetMute(deviceID string) (bool, error) {
 	}
 	defer deviceEnumerator.Release()
 
-	// Enumerate active render devices.
-	if err := deviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+	// Enumerate active output and recording devices.
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.EAll, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
 		return false, fmt.Errorf("failed to enumerate audio endpoints: %w", err)
 	}
 	defer deviceCollection.Release()
@@ -299,3 +460,65 @@ func GetMute(deviceID string) (bool, error) {
 
 	return false, fmt.Errorf("device with ID %s not found", deviceID)
 }
+
+// . GetChannelCount returns the number of channels of the specified audio device
+func GetChannelCount(deviceID string) (uint32, error) {
+	var count uint32
+	err := withEndpointVolume(deviceID, func(aev *wca.IAudioEndpointVolume) error {
+		if err := aev.GetChannelCount(&count); err != nil {
+			return fmt.Errorf("failed to get channel count for device %s: %w", deviceID, err)
+		}
+		return nil
+	})
+	return count, err
+}
+
+// . GetChannelVolumes returns the volume scalar [0.0 – 1.0] of every channel of the
+// specified audio device, in speaker order (front left, front right, ...)
+func GetChannelVolumes(deviceID string) ([]float32, error) {
+	var levels []float32
+	err := withEndpointVolume(deviceID, func(aev *wca.IAudioEndpointVolume) error {
+		var count uint32
+		if err := aev.GetChannelCount(&count); err != nil {
+			return fmt.Errorf("failed to get channel count for device %s: %w", deviceID, err)
+		}
+		levels = make([]float32, count)
+		for channel := uint32(0); channel < count; channel++ {
+			if err := aev.GetChannelVolumeLevelScalar(channel, &levels[channel]); err != nil {
+				return fmt.Errorf("failed to get volume of channel %d for device %s: %w", channel, deviceID, err)
+			}
+		}
+		return nil
+	})
+	return levels, err
+}
+
+// . SetChannelVolume sets the volume scalar of one channel of the specified audio device.
+// The master volume follows the loudest channel.
+func SetChannelVolume(deviceID string, channel uint32, volumeLevel float32) error {
+	return withEndpointVolume(deviceID, func(aev *wca.IAudioEndpointVolume) error {
+		//* Tagged so volume callbacks can recognise our own change
+		if err := aev.SetChannelVolumeLevelScalar(channel, volumeLevel, EventContext); err != nil {
+			return fmt.Errorf("failed to set volume of channel %d for device %s: %w", channel, deviceID, err)
+		}
+		return nil
+	})
+}
+
+// . withEndpointVolume activates IAudioEndpointVolume on the specified audio device for
+// the duration of fn
+func withEndpointVolume(deviceID string, fn func(*wca.IAudioEndpointVolume) error) error {
+	device, err := findDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	defer device.Release()
+
+	var audioEndpointVolume *wca.IAudioEndpointVolume
+	if err := device.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &audioEndpointVolume); err != nil {
+		return fmt.Errorf("failed to activate endpoint volume interface for device %s: %w", deviceID, err)
+	}
+	defer audioEndpointVolume.Release()
+
+	return fn(audioEndpointVolume)
+}
@@ -0,0 +1,407 @@
+//go:build windows
+
+package policyConfig
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+)
+
+// sessionNotificationVtbl is the IAudioSessionNotification vtable.
+type sessionNotificationVtbl struct {
+	QueryInterface   uintptr
+	AddRef           uintptr
+	Release          uintptr
+	OnSessionCreated uintptr
+}
+
+// sessionNotification is a Go-implemented IAudioSessionNotification COM object.
+type sessionNotification struct {
+	vtbl     *sessionNotificationVtbl
+	refCount int32
+	onEvent  func(SessionEvent)
+}
+
+// sessionEventsVtbl is the IAudioSessionEvents vtable.
+type sessionEventsVtbl struct {
+	QueryInterface         uintptr
+	AddRef                 uintptr
+	Release                uintptr
+	OnDisplayNameChanged   uintptr
+	OnIconPathChanged      uintptr
+	OnSimpleVolumeChanged  uintptr
+	OnChannelVolumeChanged uintptr
+	OnGroupingParamChanged uintptr
+	OnStateChanged         uintptr
+	OnSessionDisconnected  uintptr
+}
+
+// sessionEvents is a Go-implemented IAudioSessionEvents COM object bound to one session.
+type sessionEvents struct {
+	vtbl     *sessionEventsVtbl
+	refCount int32
+	id       string
+	pid      uint32
+	isSystem bool
+	vol      *wca.ISimpleAudioVolume
+	expired  atomic.Bool
+	onEvent  func(SessionEvent)
+}
+
+// The vtables are shared by every callback object; syscall.NewCallback slots are a
+// limited, never-freed resource, so they are created exactly once.
+var (
+	sessionVtblOnce           sync.Once
+	sessionNotificationVtable *sessionNotificationVtbl
+	sessionEventsVtable       *sessionEventsVtbl
+)
+
+func getSessionVtbls() (*sessionNotificationVtbl, *sessionEventsVtbl) {
+	sessionVtblOnce.Do(func() {
+		sessionNotificationVtable = &sessionNotificationVtbl{
+			QueryInterface:   syscall.NewCallback(snQueryInterface),
+			AddRef:           syscall.NewCallback(snAddRef),
+			Release:          syscall.NewCallback(snRelease),
+			OnSessionCreated: syscall.NewCallback(snOnSessionCreated),
+		}
+		sessionEventsVtable = &sessionEventsVtbl{
+			QueryInterface:         syscall.NewCallback(seQueryInterface),
+			AddRef:                 syscall.NewCallback(seAddRef),
+			Release:                syscall.NewCallback(seRelease),
+			OnDisplayNameChanged:   syscall.NewCallback(seIgnore2),
+			OnIconPathChanged:      syscall.NewCallback(seIgnore2),
+			OnSimpleVolumeChanged:  syscall.NewCallback(seOnSimpleVolumeChanged),
+			OnChannelVolumeChanged: syscall.NewCallback(seIgnore4),
+			OnGroupingParamChanged: syscall.NewCallback(seIgnore2),
+			OnStateChanged:         syscall.NewCallback(seOnStateChanged),
+			OnSessionDisconnected:  syscall.NewCallback(seOnSessionDisconnected),
+		}
+	})
+	return sessionNotificationVtable, sessionEventsVtable
+}
+
+func snQueryInterface(this *sessionNotification, riid *ole.GUID, ppv **sessionNotification) uintptr {
+	if ole.IsEqualGUID(riid, ole.IID_IUnknown) || ole.IsEqualGUID(riid, wca.IID_IAudioSessionNotification) {
+		snAddRef(this)
+		*ppv = this
+		return ole.S_OK
+	}
+	*ppv = nil
+	return ole.E_NOINTERFACE
+}
+
+func snAddRef(this *sessionNotification) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, 1))
+}
+
+func snRelease(this *sessionNotification) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, -1))
+}
+
+// snOnSessionCreated only signals the new session; registering its event sink is left to
+// SessionWatcher.Refresh on the owner's thread, since COM calls from inside a
+// notification callback can deadlock the audio service.
+func snOnSessionCreated(this *sessionNotification, newSession uintptr) uintptr {
+	if this.onEvent != nil {
+		this.onEvent(SessionEvent{Kind: SessionCreated})
+	}
+	return ole.S_OK
+}
+
+func seQueryInterface(this *sessionEvents, riid *ole.GUID, ppv **sessionEvents) uintptr {
+	if ole.IsEqualGUID(riid, ole.IID_IUnknown) || ole.IsEqualGUID(riid, wca.IID_IAudioSessionEvents) {
+		seAddRef(this)
+		*ppv = this
+		return ole.S_OK
+	}
+	*ppv = nil
+	return ole.E_NOINTERFACE
+}
+
+func seAddRef(this *sessionEvents) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, 1))
+}
+
+func seRelease(this *sessionEvents) uintptr {
+	return uintptr(atomic.AddInt32(&this.refCount, -1))
+}
+
+func seIgnore2(this *sessionEvents, a, b uintptr) uintptr { return ole.S_OK }
+
+func seIgnore4(this *sessionEvents, a, b, c, d uintptr) uintptr { return ole.S_OK }
+
+// seOnSimpleVolumeChanged receives (float NewVolume, BOOL NewMute, LPCGUID EventContext).
+// The float travels in an XMM register that Go callbacks cannot read, so its slot is
+// ignored and the volume is re-read from the session instead.
+func seOnSimpleVolumeChanged(this *sessionEvents, _ uintptr, newMute uintptr, eventContext *ole.GUID) uintptr {
+	if this.onEvent == nil {
+		return ole.S_OK
+	}
+	var level float32
+	if this.vol != nil {
+		_ = this.vol.GetMasterVolume(&level)
+	}
+	this.onEvent(SessionEvent{
+		Kind:     SessionVolumeChanged,
+		ID:       this.id,
+		PID:      this.pid,
+		IsSystem: this.isSystem,
+		Volume:   level,
+		Muted:    uint32(newMute) != 0,
+		FromSelf: eventContext != nil && ole.IsEqualGUID(eventContext, EventContext),
+	})
+	return ole.S_OK
+}
+
+func seOnStateChanged(this *sessionEvents, newState uintptr) uintptr {
+	state := uint32(newState)
+	if state == SessionStateExpired {
+		this.expired.Store(true)
+	}
+	if this.onEvent != nil {
+		this.onEvent(SessionEvent{Kind: SessionStateChanged, ID: this.id, PID: this.pid, IsSystem: this.isSystem, State: state})
+	}
+	return ole.S_OK
+}
+
+func seOnSessionDisconnected(this *sessionEvents, reason uintptr) uintptr {
+	this.expired.Store(true)
+	if this.onEvent != nil {
+		this.onEvent(SessionEvent{Kind: SessionDisconnected, ID: this.id, PID: this.pid, IsSystem: this.isSystem})
+	}
+	return ole.S_OK
+}
+
+// watchedSession is a session with a registered IAudioSessionEvents sink.
+type watchedSession struct {
+	ctrl   *wca.IAudioSessionControl
+	events *sessionEvents
+}
+
+// SessionWatcher keeps an IAudioSessionNotification registered on every active render
+// device plus an IAudioSessionEvents sink on every live session of those devices.
+// All methods must be called from the thread that created the watcher; the event
+// callback itself runs on Windows audio threads and must return quickly.
+type SessionWatcher struct {
+	endpoints []*watchedEndpoint
+	sessions  map[string]*watchedSession // key = session instance identifier
+	onEvent   func(SessionEvent)
+}
+
+// watchedEndpoint is a render device with a registered IAudioSessionNotification.
+type watchedEndpoint struct {
+	device       *wca.IMMDevice
+	manager      *wca.IAudioSessionManager2
+	notification *sessionNotification
+}
+
+// WatchSessions starts watching the sessions of the active render devices. Recreate
+// the watcher when a render device is added, removed, enabled or disabled.
+func WatchSessions(onEvent func(SessionEvent)) (*SessionWatcher, error) {
+	w := &SessionWatcher{
+		sessions: make(map[string]*watchedSession),
+		onEvent:  onEvent,
+	}
+
+	var deviceEnumerator *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(
+		wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL,
+		wca.IID_IMMDeviceEnumerator, &deviceEnumerator,
+	); err != nil {
+		return nil, fmt.Errorf("create device enumerator: %w", err)
+	}
+	defer deviceEnumerator.Release()
+
+	var collection *wca.IMMDeviceCollection
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &collection); err != nil {
+		return nil, fmt.Errorf("enumerate render endpoints: %w", err)
+	}
+	defer collection.Release()
+
+	var count uint32
+	if err := collection.GetCount(&count); err != nil {
+		return nil, fmt.Errorf("get endpoint count: %w", err)
+	}
+
+	var lastErr error
+	for i := uint32(0); i < count; i++ {
+		var device *wca.IMMDevice
+		if err := collection.Item(i, &device); err != nil {
+			lastErr = err
+			continue
+		}
+		endpoint, err := watchEndpoint(device, onEvent)
+		if err != nil {
+			device.Release()
+			lastErr = err
+			continue
+		}
+		w.endpoints = append(w.endpoints, endpoint)
+	}
+	if len(w.endpoints) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no active render device")
+		}
+		return nil, lastErr
+	}
+
+	// Session notifications only start flowing once the session enumerator has been
+	// requested after registration, which Refresh does.
+	if err := w.Refresh(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watchEndpoint registers a session notification on device. On success the endpoint
+// holds the device reference.
+func watchEndpoint(device *wca.IMMDevice, onEvent func(SessionEvent)) (*watchedEndpoint, error) {
+	notificationVtbl, _ := getSessionVtbls()
+
+	var manager *wca.IAudioSessionManager2
+	if err := device.Activate(wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &manager); err != nil {
+		return nil, fmt.Errorf("activate session manager: %w", err)
+	}
+
+	notification := &sessionNotification{vtbl: notificationVtbl, onEvent: onEvent}
+	if err := manager.RegisterSessionNotification((*wca.IAudioSessionNotification)(unsafe.Pointer(notification))); err != nil {
+		manager.Release()
+		return nil, fmt.Errorf("register session notification: %w", err)
+	}
+	return &watchedEndpoint{device: device, manager: manager, notification: notification}, nil
+}
+
+// Refresh registers event sinks on sessions that appeared since the last call and drops
+// the sinks of sessions that expired or disconnected. Call it after a SessionCreated,
+// SessionStateChanged or SessionDisconnected event.
+func (w *SessionWatcher) Refresh() error {
+	seen := make(map[string]bool)
+	var lastErr error
+	refreshed := 0
+	for _, endpoint := range w.endpoints {
+		if err := w.refreshEndpoint(endpoint, seen); err != nil {
+			lastErr = err
+			continue
+		}
+		refreshed++
+	}
+	if refreshed == 0 && lastErr != nil {
+		return lastErr
+	}
+
+	// Sessions no longer enumerated, or flagged expired by their own callbacks, are dropped.
+	for id, ws := range w.sessions {
+		if !seen[id] || ws.events.expired.Load() {
+			ws.release()
+			delete(w.sessions, id)
+		}
+	}
+	return nil
+}
+
+// refreshEndpoint registers event sinks on the new sessions of one device and marks
+// every live session of it in seen.
+func (w *SessionWatcher) refreshEndpoint(endpoint *watchedEndpoint, seen map[string]bool) error {
+	_, eventsVtbl := getSessionVtbls()
+
+	var enumerator *wca.IAudioSessionEnumerator
+	if err := endpoint.manager.GetSessionEnumerator(&enumerator); err != nil {
+		return fmt.Errorf("get session enumerator: %w", err)
+	}
+	defer enumerator.Release()
+
+	var count int
+	if err := enumerator.GetCount(&count); err != nil {
+		return fmt.Errorf("get session count: %w", err)
+	}
+
+	for i := 0; i < count; i++ {
+		var ctrl *wca.IAudioSessionControl
+		if err := enumerator.GetSession(i, &ctrl); err != nil {
+			continue
+		}
+
+		var ctrl2 *wca.IAudioSessionControl2
+		if err := ctrl.PutQueryInterface(wca.IID_IAudioSessionControl2, &ctrl2); err != nil {
+			ctrl.Release()
+			continue
+		}
+
+		var instanceID string
+		_ = ctrl2.GetSessionInstanceIdentifier(&instanceID)
+		if existing, ok := w.sessions[instanceID]; instanceID == "" || (ok && !existing.events.expired.Load()) {
+			seen[instanceID] = true
+			ctrl2.Release()
+			ctrl.Release()
+			continue
+		}
+
+		var state uint32
+		if err := ctrl.GetState(&state); err != nil || state == SessionStateExpired {
+			ctrl2.Release()
+			ctrl.Release()
+			continue
+		}
+
+		var pid uint32
+		_ = ctrl2.GetProcessId(&pid)
+		isSystem := ctrl2.IsSystemSoundsSession() == nil
+		ctrl2.Release()
+
+		var vol *wca.ISimpleAudioVolume
+		if err := ctrl.PutQueryInterface(wca.IID_ISimpleAudioVolume, &vol); err != nil {
+			ctrl.Release()
+			continue
+		}
+
+		events := &sessionEvents{vtbl: eventsVtbl, id: instanceID, pid: pid, isSystem: isSystem, vol: vol, onEvent: w.onEvent}
+		if err := ctrl.RegisterAudioSessionNotification((*wca.IAudioSessionEvents)(unsafe.Pointer(events))); err != nil {
+			vol.Release()
+			ctrl.Release()
+			continue
+		}
+
+		// A stale entry with the same identifier belongs to a session that has since
+		// been replaced; drop it before storing the new one.
+		if old, ok := w.sessions[instanceID]; ok {
+			old.release()
+		}
+		w.sessions[instanceID] = &watchedSession{ctrl: ctrl, events: events}
+		seen[instanceID] = true
+	}
+	return nil
+}
+
+// release unregisters the session's event sink and drops its COM references.
+func (ws *watchedSession) release() {
+	_ = ws.ctrl.UnregisterAudioSessionNotification((*wca.IAudioSessionEvents)(unsafe.Pointer(ws.events)))
+	if ws.events.vol != nil {
+		ws.events.vol.Release()
+	}
+	ws.ctrl.Release()
+}
+
+// Close unregisters every callback and releases the devices.
+func (w *SessionWatcher) Close() error {
+	if w == nil {
+		return nil
+	}
+	for id, ws := range w.sessions {
+		ws.release()
+		delete(w.sessions, id)
+	}
+	for _, endpoint := range w.endpoints {
+		_ = endpoint.manager.UnregisterSessionNotification((*wca.IAudioSessionNotification)(unsafe.Pointer(endpoint.notification)))
+		endpoint.manager.Release()
+		endpoint.device.Release()
+	}
+	w.endpoints = nil
+	return nil
+}
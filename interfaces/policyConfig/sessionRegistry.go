@@ -0,0 +1,72 @@
+//go:build windows
+
+package policyConfig
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/moutend/go-wca/pkg/wca"
+)
+
+// sessionHandle is a session kept open between enumerations.
+type sessionHandle struct {
+	ctrl *wca.IAudioSessionControl
+	vol  *wca.ISimpleAudioVolume
+}
+
+// sessionRegistry holds the live sessions of the last GetAudioSessions call, keyed by
+// session instance identifier. Setters reach a session through its handle instead of
+// re-enumerating, so neither a process with several sessions nor a change in the
+// enumeration order can send a change to the wrong session.
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionHandle
+}
+
+var registry = &sessionRegistry{sessions: make(map[string]*sessionHandle)}
+
+// replace swaps in the sessions of a fresh enumeration and releases the old handles.
+func (r *sessionRegistry) replace(sessions map[string]*sessionHandle) {
+	r.mu.Lock()
+	old := r.sessions
+	r.sessions = sessions
+	r.mu.Unlock()
+
+	for _, h := range old {
+		h.release()
+	}
+}
+
+// with runs fn on the volume control of the session with the given ID.
+func (r *sessionRegistry) with(id string, fn func(*wca.ISimpleAudioVolume) error) error {
+	return r.withHandle(id, func(h *sessionHandle) error { return fn(h.vol) })
+}
+
+// withHandle runs fn on the handle of the session with the given ID. A session that
+// appeared since the last enumeration is picked up by enumerating once more.
+func (r *sessionRegistry) withHandle(id string, fn func(*sessionHandle) error) error {
+	r.mu.Lock()
+	_, ok := r.sessions[id]
+	r.mu.Unlock()
+	if !ok {
+		if _, err := GetAudioSessions(); err != nil {
+			return err
+		}
+	}
+
+	// The lock is held during fn so replace cannot release the handle mid-call.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.sessions[id]
+	if !ok {
+		return fmt.Errorf("no audio session with ID %s", id)
+	}
+	return fn(h)
+}
+
+// release drops the session's COM references.
+func (h *sessionHandle) release() {
+	h.vol.Release()
+	h.ctrl.Release()
+}
@@ -1,347 +1,241 @@
+//go:build windows
+
 package policyConfig
 
 import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"unsafe"
 
+	"github.com/go-ole/go-ole"
 	"github.com/moutend/go-wca/pkg/wca"
 	"golang.org/x/sys/windows"
 )
 
-// AudioSession represents a single per-application audio session on the default
-// render device, exposing the information needed for a mixer UI.
-type AudioSession struct {
-	Name       string  // Friendly display name (process executable name or "System Sounds")
-	PID        uint32  // Process ID (0 for system sounds)
-	Volume     float32 // Master volume scalar [0.0 – 1.0]
-	Muted      bool    // Whether the session is muted
-	IsSystem   bool    // True when the session represents system sounds
-	SessionIdx int     // Index inside the enumerator (used to re-acquire the session for Set calls)
-	ExePath    string  // Full path to the executable (empty for system sounds)
-}
-
-// GetAudioSessions enumerates all active audio sessions on the default render
-// device and returns a slice of AudioSession structs.
+// GetAudioSessions enumerates all audio sessions on every active render device and
+// returns a slice of AudioSession structs tagged with their device. The sessions are
+// kept open in the session registry so SetSessionVolume and SetSessionMute can reach
+// them by ID.
 func GetAudioSessions() ([]AudioSession, error) {
-	var deviceEnumerator *wca.IMMDeviceEnumerator
-	if err := wca.CoCreateInstance(
-		wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL,
-		wca.IID_IMMDeviceEnumerator, &deviceEnumerator,
-	); err != nil {
-		return nil, fmt.Errorf("create device enumerator: %w", err)
+	var sessions []AudioSession
+	handles := make(map[string]*sessionHandle)
+	err := forEachSession(func(deviceID string, ctrl *wca.IAudioSessionControl) {
+		session, handle, ok := readSession(deviceID, ctrl)
+		if !ok {
+			ctrl.Release()
+			return
+		}
+		sessions = append(sessions, session)
+		// The registry takes over the session's references.
+		handles[session.ID] = handle
+	})
+	if err != nil {
+		for _, h := range handles {
+			h.release()
+		}
+		return nil, err
 	}
-	defer deviceEnumerator.Release()
 
-	var defaultDevice *wca.IMMDevice
-	if err := deviceEnumerator.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &defaultDevice); err != nil {
-		return nil, fmt.Errorf("get default endpoint: %w", err)
-	}
-	defer defaultDevice.Release()
+	registry.replace(handles)
+	return sessions, nil
+}
 
-	var sessionManager *wca.IAudioSessionManager2
-	if err := defaultDevice.Activate(
-		wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &sessionManager,
-	); err != nil {
-		return nil, fmt.Errorf("activate session manager: %w", err)
+// readSession reads one session of the given device. On success the returned handle
+// holds ctrl; otherwise the caller still owns it.
+func readSession(deviceID string, ctrl *wca.IAudioSessionControl) (AudioSession, *sessionHandle, bool) {
+	// Check session state – include active (1) and inactive (0) sessions.
+	// Only skip expired sessions (state == 2) which have been disconnected.
+	// This matches Windows Volume Mixer behaviour: paused apps stay visible.
+	var state uint32
+	if err := ctrl.GetState(&state); err != nil || state == SessionStateExpired {
+		return AudioSession{}, nil, false
 	}
-	defer sessionManager.Release()
 
-	var enumerator *wca.IAudioSessionEnumerator
-	if err := sessionManager.GetSessionEnumerator(&enumerator); err != nil {
-		return nil, fmt.Errorf("get session enumerator: %w", err)
+	// Query IAudioSessionControl2 for identity, PID and the system-sounds flag.
+	var ctrl2 *wca.IAudioSessionControl2
+	if err := ctrl.PutQueryInterface(wca.IID_IAudioSessionControl2, &ctrl2); err != nil {
+		return AudioSession{}, nil, false
 	}
-	defer enumerator.Release()
+	defer ctrl2.Release()
 
-	var count int
-	if err := enumerator.GetCount(&count); err != nil {
-		return nil, fmt.Errorf("get session count: %w", err)
+	// The instance identifier is the session's identity; a session without one
+	// could not be found again, so it is not listed.
+	var id, appID string
+	if err := ctrl2.GetSessionInstanceIdentifier(&id); err != nil || id == "" {
+		return AudioSession{}, nil, false
 	}
+	_ = ctrl2.GetSessionIdentifier(&appID)
 
-	sessions := make([]AudioSession, 0, count)
-	for i := 0; i < count; i++ {
-		var ctrl *wca.IAudioSessionControl
-		if err := enumerator.GetSession(i, &ctrl); err != nil {
-			continue
-		}
-
-		// Query IAudioSessionControl2 for PID / system-sounds flag.
-		var ctrl2 *wca.IAudioSessionControl2
-		if err := ctrl.PutQueryInterface(wca.IID_IAudioSessionControl2, &ctrl2); err != nil {
-			ctrl.Release()
-			continue
-		}
-
-		// Query ISimpleAudioVolume for volume / mute.
-		var vol *wca.ISimpleAudioVolume
-		if err := ctrl.PutQueryInterface(wca.IID_ISimpleAudioVolume, &vol); err != nil {
-			ctrl2.Release()
-			ctrl.Release()
-			continue
-		}
-
-		// Check session state – include active (1) and inactive (0) sessions.
-		// Only skip expired sessions (state == 2) which have been disconnected.
-		// This matches Windows Volume Mixer behaviour: paused apps stay visible.
-		var state uint32
-		if err := ctrl.GetState(&state); err != nil || state == 2 {
-			vol.Release()
-			ctrl2.Release()
-			ctrl.Release()
-			continue
-		}
-
-		var pid uint32
-		_ = ctrl2.GetProcessId(&pid)
-
-		isSystem := ctrl2.IsSystemSoundsSession() == nil
-
-		// Resolve the executable path; skip system host processes that aren't
-		// meaningful to show in a per-app mixer (svchost, RuntimeBroker, etc.).
-		exePath := exePathForPID(pid)
-		bareName := bareExeName(exePath)
-		if shouldFilterSession(bareName) && !isSystem {
-			vol.Release()
-			ctrl2.Release()
-			ctrl.Release()
-			continue
-		}
-
-		var level float32
-		_ = vol.GetMasterVolume(&level)
+	// Apps that open several sessions (one per renderer process in browsers) can
+	// put them in one group with a shared grouping parameter.
+	var grouping ole.GUID
+	var groupID string
+	if err := ctrl.GetGroupingParam(&grouping); err == nil && grouping != (ole.GUID{}) {
+		groupID = grouping.String()
+	}
 
-		var muted bool
-		_ = vol.GetMute(&muted)
+	var pid uint32
+	_ = ctrl2.GetProcessId(&pid)
 
-		name := friendlyName(exePath, bareName)
-		if isSystem {
-			name = "System Sounds"
-		}
+	isSystem := ctrl2.IsSystemSoundsSession() == nil
 
-		sessions = append(sessions, AudioSession{
-			Name:       name,
-			PID:        pid,
-			Volume:     level,
-			Muted:      muted,
-			IsSystem:   isSystem,
-			SessionIdx: i,
-			ExePath:    exePath,
-		})
+	// Sessions can name themselves and point at their own icon, and packaged (Store)
+	// apps are known by their AppUserModelID rather than their executable.
+	displayName := loadIndirectString(sessionString(ctrl, ctrl.VTable().GetDisplayName))
+	iconPath := sessionString(ctrl, ctrl.VTable().GetIconPath)
+	aumid := appUserModelID(pid)
 
-		vol.Release()
-		ctrl2.Release()
-		ctrl.Release()
+	// Resolve the executable path. A session nothing is known about is skipped;
+	// which apps the mixer shows is otherwise up to its rules.
+	exePath := ExePathForPID(pid)
+	bareName := bareExeName(exePath)
+	if bareName == "" && !isSystem && displayName == "" && aumid == "" {
+		return AudioSession{}, nil, false
+	}
+	if isHostExe(bareName) && (displayName != "" || aumid != "") {
+		// The host's executable says nothing about the app the session says it
+		// belongs to; without it the session is not grouped with other apps of the
+		// same host, shown with the host's icon or hidden by rules for the host.
+		exePath = ""
 	}
 
-	return sessions, nil
+	// Query ISimpleAudioVolume for volume / mute.
+	var vol *wca.ISimpleAudioVolume
+	if err := ctrl.PutQueryInterface(wca.IID_ISimpleAudioVolume, &vol); err != nil {
+		return AudioSession{}, nil, false
+	}
+
+	var level float32
+	_ = vol.GetMasterVolume(&level)
+
+	var muted bool
+	_ = vol.GetMute(&muted)
+
+	name := sessionName(displayName, aumid, exePath, bareName, isSystem)
+	if iconPath == "" && aumid != "" {
+		iconPath = PackagedAppIconPrefix + aumid
+	}
+
+	return AudioSession{
+		ID:       id,
+		AppID:    appID,
+		GroupID:  groupID,
+		DeviceID: deviceID,
+		Name:     name,
+		PID:      pid,
+		Volume:   level,
+		Muted:    muted,
+		Active:   state == SessionStateActive,
+		IsSystem: isSystem,
+		ExePath:  exePath,
+		IconPath: iconPath,
+	}, &sessionHandle{ctrl: ctrl, vol: vol}, true
 }
 
-// forEachSessionVolume invokes fn on the ISimpleAudioVolume of every session
-// on the default render device that matches pid/isSystem.
-func forEachSessionVolume(pid uint32, isSystem bool, fn func(*wca.ISimpleAudioVolume) error) error {
+// forEachSession calls fn with every session on every active render device, together
+// with the device's ID. fn takes over the session control and must release it.
+func forEachSession(fn func(deviceID string, ctrl *wca.IAudioSessionControl)) error {
 	var deviceEnumerator *wca.IMMDeviceEnumerator
 	if err := wca.CoCreateInstance(
 		wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL,
 		wca.IID_IMMDeviceEnumerator, &deviceEnumerator,
 	); err != nil {
-		return err
+		return fmt.Errorf("create device enumerator: %w", err)
 	}
 	defer deviceEnumerator.Release()
 
-	var defaultDevice *wca.IMMDevice
-	if err := deviceEnumerator.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &defaultDevice); err != nil {
-		return err
+	var collection *wca.IMMDeviceCollection
+	if err := deviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &collection); err != nil {
+		return fmt.Errorf("enumerate render endpoints: %w", err)
+	}
+	defer collection.Release()
+
+	var count uint32
+	if err := collection.GetCount(&count); err != nil {
+		return fmt.Errorf("get endpoint count: %w", err)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var device *wca.IMMDevice
+		if err := collection.Item(i, &device); err != nil {
+			continue
+		}
+		// A device that cannot list its sessions (e.g. unplugged mid-enumeration) is skipped.
+		_ = forEachDeviceSession(device, fn)
+		device.Release()
+	}
+	return nil
+}
+
+// forEachDeviceSession calls fn with every session of one device.
+func forEachDeviceSession(device *wca.IMMDevice, fn func(deviceID string, ctrl *wca.IAudioSessionControl)) error {
+	var deviceID string
+	if err := device.GetId(&deviceID); err != nil {
+		return fmt.Errorf("get device ID: %w", err)
 	}
-	defer defaultDevice.Release()
 
 	var sessionManager *wca.IAudioSessionManager2
-	if err := defaultDevice.Activate(wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &sessionManager); err != nil {
-		return err
+	if err := device.Activate(
+		wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &sessionManager,
+	); err != nil {
+		return fmt.Errorf("activate session manager: %w", err)
 	}
 	defer sessionManager.Release()
 
 	var enumerator *wca.IAudioSessionEnumerator
 	if err := sessionManager.GetSessionEnumerator(&enumerator); err != nil {
-		return err
+		return fmt.Errorf("get session enumerator: %w", err)
 	}
 	defer enumerator.Release()
 
 	var count int
 	if err := enumerator.GetCount(&count); err != nil {
-		return err
+		return fmt.Errorf("get session count: %w", err)
 	}
 
-	matched := false
 	for i := 0; i < count; i++ {
 		var ctrl *wca.IAudioSessionControl
 		if err := enumerator.GetSession(i, &ctrl); err != nil {
 			continue
 		}
-		var ctrl2 *wca.IAudioSessionControl2
-		if err := ctrl.PutQueryInterface(wca.IID_IAudioSessionControl2, &ctrl2); err != nil {
-			ctrl.Release()
-			continue
-		}
-
-		var sessPID uint32
-		_ = ctrl2.GetProcessId(&sessPID)
-		sessIsSystem := ctrl2.IsSystemSoundsSession() == nil
-
-		if sessPID == pid && sessIsSystem == isSystem {
-			var vol *wca.ISimpleAudioVolume
-			if err := ctrl.PutQueryInterface(wca.IID_ISimpleAudioVolume, &vol); err == nil {
-				matched = true
-				_ = fn(vol)
-				vol.Release()
-			}
-		}
-		ctrl2.Release()
-		ctrl.Release()
-	}
-
-	if !matched {
-		return fmt.Errorf("no audio session found for pid=%d isSystem=%v", pid, isSystem)
+		fn(deviceID, ctrl)
 	}
 	return nil
 }
 
-// SetSessionVolumeByPID sets the volume for all sessions belonging to a process.
-func SetSessionVolumeByPID(pid uint32, isSystem bool, level float32) error {
-	return forEachSessionVolume(pid, isSystem, func(v *wca.ISimpleAudioVolume) error {
-		return v.SetMasterVolume(level, nil)
+// SetSessionVolume sets the volume of the session with the given ID.
+func SetSessionVolume(id string, level float32) error {
+	return registry.with(id, func(v *wca.ISimpleAudioVolume) error {
+		return v.SetMasterVolume(level, EventContext)
 	})
 }
 
-// SetSessionMuteByPID sets the mute state for all sessions belonging to a process.
-func SetSessionMuteByPID(pid uint32, isSystem bool, muted bool) error {
-	return forEachSessionVolume(pid, isSystem, func(v *wca.ISimpleAudioVolume) error {
-		return v.SetMute(muted, nil)
+// SetSessionMute sets the mute state of the session with the given ID.
+func SetSessionMute(id string, muted bool) error {
+	return registry.with(id, func(v *wca.ISimpleAudioVolume) error {
+		return v.SetMute(muted, EventContext)
 	})
 }
 
-// SetSessionVolume sets the volume for the audio session at the given enumerator index.
-func SetSessionVolume(sessionIdx int, level float32) error {
-	vol, release, err := acquireSessionVolume(sessionIdx)
-	if err != nil {
-		return err
-	}
-	defer release()
-	return vol.SetMasterVolume(level, nil)
-}
-
-// SetSessionMute sets the mute state for the audio session at the given enumerator index.
-func SetSessionMute(sessionIdx int, muted bool) error {
-	vol, release, err := acquireSessionVolume(sessionIdx)
-	if err != nil {
-		return err
-	}
-	defer release()
-	return vol.SetMute(muted, nil)
-}
-
-// acquireSessionVolume opens the COM chain down to ISimpleAudioVolume for the
-// given session index. The caller must invoke the returned release func.
-func acquireSessionVolume(sessionIdx int) (*wca.ISimpleAudioVolume, func(), error) {
-	var deviceEnumerator *wca.IMMDeviceEnumerator
-	if err := wca.CoCreateInstance(
-		wca.CLSID_MMDeviceEnumerator, 0, wca.CLSCTX_ALL,
-		wca.IID_IMMDeviceEnumerator, &deviceEnumerator,
-	); err != nil {
-		return nil, nil, err
-	}
-
-	var defaultDevice *wca.IMMDevice
-	if err := deviceEnumerator.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &defaultDevice); err != nil {
-		deviceEnumerator.Release()
-		return nil, nil, err
-	}
-
-	var sessionManager *wca.IAudioSessionManager2
-	if err := defaultDevice.Activate(
-		wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &sessionManager,
-	); err != nil {
-		defaultDevice.Release()
-		deviceEnumerator.Release()
-		return nil, nil, err
-	}
-
-	var enumerator *wca.IAudioSessionEnumerator
-	if err := sessionManager.GetSessionEnumerator(&enumerator); err != nil {
-		sessionManager.Release()
-		defaultDevice.Release()
-		deviceEnumerator.Release()
-		return nil, nil, err
-	}
-
-	var ctrl *wca.IAudioSessionControl
-	if err := enumerator.GetSession(sessionIdx, &ctrl); err != nil {
-		enumerator.Release()
-		sessionManager.Release()
-		defaultDevice.Release()
-		deviceEnumerator.Release()
-		return nil, nil, err
-	}
-
-	var vol *wca.ISimpleAudioVolume
-	if err := ctrl.PutQueryInterface(wca.IID_ISimpleAudioVolume, &vol); err != nil {
-		ctrl.Release()
-		enumerator.Release()
-		sessionManager.Release()
-		defaultDevice.Release()
-		deviceEnumerator.Release()
-		return nil, nil, err
-	}
-
-	release := func() {
-		vol.Release()
-		ctrl.Release()
-		enumerator.Release()
-		sessionManager.Release()
-		defaultDevice.Release()
-		deviceEnumerator.Release()
-	}
-
-	return vol, release, nil
-}
-
-// processName returns a friendly display name for a PID.
-func processName(pid uint32) string {
-	p := exePathForPID(pid)
-	return friendlyName(p, bareExeName(p))
+// hostExeNames are the system executables that play audio on behalf of other apps.
+var hostExeNames = map[string]bool{
+	"svchost":              true,
+	"runtimebroker":        true,
+	"backgroundtaskhost":   true,
+	"dllhost":              true,
+	"applicationframehost": true,
 }
 
-// filteredExeNames is the set of system host executables that should be hidden
-// from the per-app volume mixer.
-var filteredExeNames = map[string]bool{
-	"svchost":                 true,
-	"runtimebroker":           true,
-	"backgroundtaskhost":      true,
-	"sihost":                  true,
-	"systemsettings":          true,
-	"systemsettingsbroker":    true,
-	"searchhost":              true,
-	"taskhostw":               true,
-	"dllhost":                 true,
-	"applicationframehost":    true,
-	"shellexperiencehost":     true,
-	"startmenuexperiencehost": true,
-	"ctfmon":                  true,
-	"conhost":                 true,
+// isHostExe returns true if the given bare exe name (no ext) is a host executable.
+func isHostExe(bareName string) bool {
+	return hostExeNames[strings.ToLower(bareName)]
 }
 
-// shouldFilterSession returns true if the given bare exe name (no ext, lower)
-// should be hidden from the mixer.
-func shouldFilterSession(bareName string) bool {
-	if bareName == "" {
-		return true
-	}
-	return filteredExeNames[strings.ToLower(bareName)]
-}
-
-// exePathForPID returns the full executable path for a PID. Returns "" on failure.
-func exePathForPID(pid uint32) string {
+// ExePathForPID returns the full executable path for a PID. Returns "" on failure.
+func ExePathForPID(pid uint32) string {
 	if pid == 0 {
 		return ""
 	}
@@ -368,6 +262,27 @@ func bareExeName(fullPath string) string {
 	return strings.TrimSuffix(name, filepath.Ext(name))
 }
 
+// sessionName returns the name a session is shown under: the name the session set
+// itself, then the packaged app's display name, then the executable's description.
+func sessionName(displayName, aumid, exePath, bareName string, isSystem bool) string {
+	switch {
+	case isSystem:
+		return "System Sounds"
+	case displayName != "":
+		return displayName
+	}
+	if aumid != "" {
+		if name := packagedAppName(aumid); name != "" {
+			return name
+		}
+	}
+	return friendlyName(exePath, bareName)
+}
+
+// exeDescriptions caches fileDescription by executable path, so the version info is read
+// from disk once per executable rather than on every session enumeration.
+var exeDescriptions sync.Map // map[string]string
+
 // friendlyName returns a user-facing display name for a process.
 // It reads the FileDescription from the executable's version-info resource
 // (the same source Windows Volume Mixer uses), falling back to capitalised exe name.
@@ -378,8 +293,13 @@ func friendlyName(exePath, bareName string) string {
 
 	// Try to read the FileDescription from the executable's version info.
 	if exePath != "" {
-		if desc := fileDescription(exePath); desc != "" {
-			return desc
+		desc, ok := exeDescriptions.Load(exePath)
+		if !ok {
+			desc = fileDescription(exePath)
+			exeDescriptions.Store(exePath, desc)
+		}
+		if desc != "" {
+			return desc.(string)
 		}
 	}
 
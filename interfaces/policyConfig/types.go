@@ -0,0 +1,66 @@
+package policyConfig
+
+// AudioSession represents a single per-application audio session on one of the
+// render devices, exposing the information needed for a mixer UI.
+type AudioSession struct {
+	ID       string  // Session instance identifier: unique to this session and stable while it lives
+	AppID    string  // Session identifier: shared by every session of the same app and stable across restarts
+	GroupID  string  // Grouping parameter: sessions an app puts in one group share it (empty when unknown)
+	DeviceID string  // Render device the session plays on
+	Name     string  // Friendly display name (process executable name or "System Sounds")
+	PID      uint32  // Process ID (0 for system sounds)
+	Volume   float32 // Master volume scalar [0.0 – 1.0]
+	Muted    bool    // Whether the session is muted
+	Active   bool    // Whether the session is playing rather than idle or paused
+	IsSystem bool    // True when the session represents system sounds
+	ExePath  string  // Full path to the executable (empty for system sounds)
+	IconPath string  // Icon the session set ("file,index"), or PackagedAppIconPrefix and an AppUserModelID; empty to use the executable's
+}
+
+// . VolumeNotification is the payload delivered by an endpoint volume callback
+type VolumeNotification struct {
+	DeviceID       string    // Endpoint the change happened on
+	Volume         float32   // Master volume scalar [0.0 – 1.0]
+	Muted          bool      // Endpoint mute state
+	ChannelVolumes []float32 // Per-channel volume scalars
+	FromSelf       bool      // True when the change was made by SoundShift (EventContext)
+}
+
+// SessionEventKind identifies what changed on an audio session.
+type SessionEventKind int
+
+const (
+	SessionCreated       SessionEventKind = iota // A new session appeared on the device
+	SessionVolumeChanged                         // Session volume or mute changed
+	SessionStateChanged                          // Session became active, inactive or expired
+	SessionDisconnected                          // Session was torn down (device removed, server shut down, ...)
+)
+
+// AudioSessionState values reported in SessionEvent.State.
+const (
+	SessionStateInactive = 0
+	SessionStateActive   = 1
+	SessionStateExpired  = 2
+)
+
+// SessionEvent describes a change on one audio session of the watched device.
+// ID identifies the session the same way AudioSession does and PID/IsSystem name its
+// owner; all three are zero for SessionCreated, which only signals that the session
+// list must be re-read.
+type SessionEvent struct {
+	Kind     SessionEventKind
+	ID       string
+	PID      uint32
+	IsSystem bool
+	Volume   float32 // Current volume, for SessionVolumeChanged
+	Muted    bool    // Current mute state, for SessionVolumeChanged
+	State    uint32  // New AudioSessionState, for SessionStateChanged
+	FromSelf bool    // True when SoundShift made the change (EventContext)
+}
+
+// SessionPeak is the current peak level of one audio session, identified the same way
+// AudioSession is.
+type SessionPeak struct {
+	ID   string
+	Peak float32 // Peak sample level [0.0 – 1.0] of the last metering period
+}
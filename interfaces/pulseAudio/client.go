@@ -0,0 +1,395 @@
+package pulseAudio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// . Native protocol commands used by SoundShift (from pulsecore/native-common.h)
+const (
+	commandError                = 0
+	commandReply                = 2
+	commandAuth                 = 8
+	commandSetClientName        = 9
+	commandGetServerInfo        = 20
+	commandGetSinkInfo          = 21
+	commandGetSinkInfoList      = 22
+	commandGetSourceInfo        = 23
+	commandGetSourceInfoList    = 24
+	commandGetSinkInputInfo     = 29
+	commandGetSinkInputInfoList = 30
+	commandSubscribe            = 35
+	commandSetSinkVolume        = 36
+	commandSetSinkInputVolume   = 37
+	commandSetSourceVolume      = 38
+	commandSetSinkMute          = 39
+	commandSetSourceMute        = 40
+	commandSetDefaultSink       = 44
+	commandSetDefaultSource     = 45
+	commandSubscribeEvent       = 66
+	commandMoveSinkInput        = 67
+	commandSetSinkInputMute     = 69
+)
+
+const (
+	// protocolVersion is the newest protocol revision the parsers in this package understand;
+	// the connection uses the lower of this and the server's version.
+	protocolVersion = 32
+
+	descriptorSize = 20         // length, channel, offset hi/lo, flags
+	controlChannel = 0xFFFFFFFF // channel of command packets (as opposed to stream data)
+	InvalidIndex   = 0xFFFFFFFF // PA_INVALID_INDEX: no object, or "look up by name"
+	cookieSize     = 256
+	maxPacketSize  = 16 * 1024 * 1024
+	requestTimeout = 5 * time.Second
+)
+
+// . Subscription masks (PA_SUBSCRIPTION_MASK_*)
+const (
+	SubscribeSink      uint32 = 0x0001
+	SubscribeSource    uint32 = 0x0002
+	SubscribeSinkInput uint32 = 0x0004
+	SubscribeServer    uint32 = 0x0080
+)
+
+// . Event facilities and types (PA_SUBSCRIPTION_EVENT_*)
+const (
+	FacilitySink      uint32 = 0x00
+	FacilitySource    uint32 = 0x01
+	FacilitySinkInput uint32 = 0x02
+	FacilityServer    uint32 = 0x07
+
+	EventNew    uint32 = 0x00
+	EventChange uint32 = 0x10
+	EventRemove uint32 = 0x20
+
+	facilityMask = 0x0F
+	typeMask     = 0x30
+)
+
+// . Event is a subscription event: an object of some facility was created, changed or removed
+type Event struct {
+	Facility uint32 // FacilitySink, FacilitySource, FacilitySinkInput or FacilityServer
+	Type     uint32 // EventNew, EventChange or EventRemove
+	Index    uint32 // Index of the object the event refers to
+}
+
+// . ServerError is an error reply from the server (a PA_ERR_* code)
+type ServerError uint32
+
+const errNoEntity ServerError = 5 // PA_ERR_NOENTITY
+
+func (e ServerError) Error() string {
+	if e == errNoEntity {
+		return "pulseaudio: no such entity"
+	}
+	return fmt.Sprintf("pulseaudio: server error %d", uint32(e))
+}
+
+// . Client is one connection to a PulseAudio (or PipeWire-pulse) server. Requests may be
+// issued from any goroutine, including from an event callback.
+type Client struct {
+	conn    net.Conn
+	version uint32
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextTag uint32
+	pending map[uint32]chan reply
+	err     error // set once the connection is gone
+
+	// Subscription events are queued by the read loop and delivered in order by a
+	// separate goroutine, so callbacks can make requests without stalling replies
+	events   []Event
+	eventsCh chan struct{}
+	onEvent  func(Event)
+	done     chan struct{}
+}
+
+type reply struct {
+	r   *tagReader
+	err error
+}
+
+// . Dial connects to the user's PulseAudio server. onEvent, when non-nil, receives
+// subscription events once Subscribe has been called.
+func Dial(onEvent func(Event)) (*Client, error) {
+	path, err := socketPath()
+	if err != nil {
+		return nil, err
+	}
+	return DialPath(path, onEvent)
+}
+
+// . DialPath connects to the server listening on the given unix socket
+func DialPath(path string, onEvent func(Event)) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, requestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", path, err)
+	}
+
+	c := &Client{
+		conn:     conn,
+		version:  protocolVersion,
+		pending:  make(map[uint32]chan reply),
+		eventsCh: make(chan struct{}, 1),
+		onEvent:  onEvent,
+		done:     make(chan struct{}),
+	}
+	go c.readLoop()
+	go c.dispatchEvents()
+
+	if err := c.handshake(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// . socketPath finds the server socket: $PULSE_SERVER (unix only), then the per-user runtime dir
+func socketPath() (string, error) {
+	if server := os.Getenv("PULSE_SERVER"); server != "" {
+		for _, candidate := range strings.Fields(server) {
+			candidate = strings.TrimPrefix(candidate, "unix:")
+			if strings.HasPrefix(candidate, "/") {
+				return candidate, nil
+			}
+		}
+		return "", fmt.Errorf("PULSE_SERVER %q has no unix socket", server)
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "pulse", "native"), nil
+	}
+	return fmt.Sprintf("/run/user/%d/pulse/native", os.Getuid()), nil
+}
+
+// . readCookie returns the auth cookie, or zeros when there is none: servers on a local
+// socket authenticate same-user clients by their socket credentials instead
+func readCookie() []byte {
+	var candidates []string
+	if path := os.Getenv("PULSE_COOKIE"); path != "" {
+		candidates = append(candidates, path)
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(configDir, "pulse", "cookie"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".pulse-cookie"))
+	}
+	for _, path := range candidates {
+		if data, err := os.ReadFile(path); err == nil && len(data) >= cookieSize {
+			return data[:cookieSize]
+		}
+	}
+	return make([]byte, cookieSize)
+}
+
+// . handshake authenticates, negotiates the protocol version and names the client
+func (c *Client) handshake() error {
+	r, err := c.request(commandAuth, func(w *tagWriter) {
+		w.putU32(protocolVersion)
+		w.putArbitrary(readCookie())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	// The upper bits of the reply carry shm/memfd flags
+	if serverVersion := r.u32() & 0xFFFF; serverVersion < c.version {
+		c.version = serverVersion
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if c.version < 13 {
+		return fmt.Errorf("server protocol version %d is too old", c.version)
+	}
+
+	_, err = c.request(commandSetClientName, func(w *tagWriter) {
+		w.putPropList(map[string]string{"application.name": "SoundShift"})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set client name: %w", err)
+	}
+	return nil
+}
+
+// . Subscribe asks the server for events of the facilities in mask (Subscribe* constants)
+func (c *Client) Subscribe(mask uint32) error {
+	_, err := c.request(commandSubscribe, func(w *tagWriter) {
+		w.putU32(mask)
+	})
+	return err
+}
+
+// . Err reports why the connection stopped, or nil while it is usable
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// . Close closes the connection; pending requests fail and no further events are delivered
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// . request sends a command and waits for its reply. args may be nil.
+func (c *Client) request(command uint32, args func(*tagWriter)) (*tagReader, error) {
+	ch := make(chan reply, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	tag := c.nextTag
+	c.nextTag++
+	c.pending[tag] = ch
+	c.mu.Unlock()
+
+	w := &tagWriter{}
+	w.putU32(command)
+	w.putU32(tag)
+	if args != nil {
+		args(w)
+	}
+	if err := c.writePacket(w.buf); err != nil {
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case rep := <-ch:
+		return rep.r, rep.err
+	case <-time.After(requestTimeout):
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("pulseaudio: command %d timed out", command)
+	}
+}
+
+func (c *Client) writePacket(payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writePacket(c.conn, payload)
+}
+
+// . writePacket frames payload as one control packet
+func writePacket(w io.Writer, payload []byte) error {
+	packet := make([]byte, descriptorSize, descriptorSize+len(payload))
+	binary.BigEndian.PutUint32(packet[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(packet[4:], controlChannel)
+	packet = append(packet, payload...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// . readPacket reads one packet and returns its channel and payload
+func readPacket(r io.Reader) (uint32, []byte, error) {
+	var descriptor [descriptorSize]byte
+	if _, err := io.ReadFull(r, descriptor[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(descriptor[0:])
+	if length > maxPacketSize {
+		return 0, nil, fmt.Errorf("pulseaudio: packet of %d bytes is too large", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(descriptor[4:]), payload, nil
+}
+
+// . readLoop routes replies to their waiting requests and queues subscription events
+func (c *Client) readLoop() {
+	var err error
+	for {
+		var channel uint32
+		var payload []byte
+		channel, payload, err = readPacket(c.conn)
+		if err != nil {
+			break
+		}
+		if channel != controlChannel {
+			continue // no streams are ever created, so no data is expected
+		}
+
+		r := &tagReader{buf: payload}
+		command, tag := r.u32(), r.u32()
+		if r.err != nil {
+			continue
+		}
+
+		switch command {
+		case commandReply, commandError:
+			rep := reply{r: r}
+			if command == commandError {
+				rep = reply{err: ServerError(r.u32())}
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[tag]
+			delete(c.pending, tag)
+			c.mu.Unlock()
+			if ok {
+				ch <- rep
+			}
+		case commandSubscribeEvent:
+			event, index := r.u32(), r.u32()
+			if r.err != nil {
+				continue
+			}
+			c.mu.Lock()
+			c.events = append(c.events, Event{Facility: event & facilityMask, Type: event & typeMask, Index: index})
+			c.mu.Unlock()
+			select {
+			case c.eventsCh <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	//* The connection is gone: fail everything still waiting
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		err = fmt.Errorf("pulseaudio: connection closed")
+	}
+	c.mu.Lock()
+	c.err = err
+	for tag, ch := range c.pending {
+		ch <- reply{err: err}
+		delete(c.pending, tag)
+	}
+	c.mu.Unlock()
+	close(c.eventsCh)
+}
+
+// . dispatchEvents delivers queued events to onEvent in arrival order
+func (c *Client) dispatchEvents() {
+	defer close(c.done)
+	for range c.eventsCh {
+		c.mu.Lock()
+		events := c.events
+		c.events = nil
+		c.mu.Unlock()
+		if c.onEvent == nil {
+			continue
+		}
+		for _, ev := range events {
+			c.onEvent(ev)
+		}
+	}
+}
@@ -0,0 +1,559 @@
+package pulseAudio
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// errCommand is PA_ERR_COMMAND, the reply to a command the fake does not implement
+const errCommand ServerError = 2
+
+// . FakeServer serves the native protocol on a unix socket from in-memory state, so the
+// client and the backend built on it can be tested without a sound server. Commands
+// from clients change the state and raise the subscription events a real server
+// would; the scripting methods (AddSink, UpdateSinkInput, ...) do the same.
+type FakeServer struct {
+	listener net.Listener
+
+	mu            sync.Mutex
+	version       uint32 // Protocol version announced to clients
+	defaultSink   string
+	defaultSource string
+	sinks         []Sink
+	sources       []Source
+	inputs        []SinkInput
+	conns         map[*fakeConn]bool
+	wg            sync.WaitGroup
+}
+
+type fakeConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	version uint32 // negotiated
+	mask    uint32 // subscription mask
+}
+
+// . NewFakeServer starts a fake server listening on socketPath
+func NewFakeServer(socketPath string) (*FakeServer, error) {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &FakeServer{version: protocolVersion, listener: listener, conns: make(map[*fakeConn]bool)}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// . Path returns the socket path to pass to DialPath
+func (s *FakeServer) Path() string {
+	return s.listener.Addr().String()
+}
+
+// . Close stops the server and drops every client connection
+func (s *FakeServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for fc := range s.conns {
+		fc.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// Scripting
+// ---------------------------------------------------------------------------
+
+// . SetVersion changes the protocol version announced to clients that connect afterwards
+func (s *FakeServer) SetVersion(version uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// . SetDefaults sets the default sink and source by name
+func (s *FakeServer) SetDefaults(sink, source string) {
+	s.mu.Lock()
+	s.defaultSink, s.defaultSource = sink, source
+	s.mu.Unlock()
+	s.emit(FacilityServer, EventChange, InvalidIndex)
+}
+
+func (s *FakeServer) AddSink(sink Sink) {
+	s.mu.Lock()
+	s.sinks = append(s.sinks, sink)
+	s.mu.Unlock()
+	s.emit(FacilitySink, EventNew, sink.Index)
+}
+
+func (s *FakeServer) RemoveSink(index uint32) {
+	s.mu.Lock()
+	for i := range s.sinks {
+		if s.sinks[i].Index == index {
+			s.sinks = append(s.sinks[:i], s.sinks[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.emit(FacilitySink, EventRemove, index)
+}
+
+// . UpdateSink replaces the sink with the same index
+func (s *FakeServer) UpdateSink(sink Sink) {
+	s.mu.Lock()
+	if d := s.findSink(sink.Index); d != nil {
+		*d = sink
+	}
+	s.mu.Unlock()
+	s.emit(FacilitySink, EventChange, sink.Index)
+}
+
+func (s *FakeServer) AddSource(source Source) {
+	s.mu.Lock()
+	s.sources = append(s.sources, source)
+	s.mu.Unlock()
+	s.emit(FacilitySource, EventNew, source.Index)
+}
+
+func (s *FakeServer) AddSinkInput(in SinkInput) {
+	s.mu.Lock()
+	s.inputs = append(s.inputs, in)
+	s.mu.Unlock()
+	s.emit(FacilitySinkInput, EventNew, in.Index)
+}
+
+func (s *FakeServer) RemoveSinkInput(index uint32) {
+	s.mu.Lock()
+	for i := range s.inputs {
+		if s.inputs[i].Index == index {
+			s.inputs = append(s.inputs[:i], s.inputs[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.emit(FacilitySinkInput, EventRemove, index)
+}
+
+// . UpdateSinkInput replaces the sink input with the same index
+func (s *FakeServer) UpdateSinkInput(in SinkInput) {
+	s.mu.Lock()
+	if existing := s.findInput(in.Index); existing != nil {
+		*existing = in
+	}
+	s.mu.Unlock()
+	s.emit(FacilitySinkInput, EventChange, in.Index)
+}
+
+func (s *FakeServer) DefaultSink() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.defaultSink
+}
+
+func (s *FakeServer) DefaultSource() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.defaultSource
+}
+
+func (s *FakeServer) SinkByName(name string) (Sink, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sink := range s.sinks {
+		if sink.Name == name {
+			return sink, true
+		}
+	}
+	return Sink{}, false
+}
+
+func (s *FakeServer) SourceByName(name string) (Source, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range s.sources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+func (s *FakeServer) SinkInputByIndex(index uint32) (SinkInput, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if in := s.findInput(index); in != nil {
+		return *in, true
+	}
+	return SinkInput{}, false
+}
+
+// ---------------------------------------------------------------------------
+// Protocol
+// ---------------------------------------------------------------------------
+
+func (s *FakeServer) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		fc := &fakeConn{conn: conn, version: s.version}
+		s.conns[fc] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(fc)
+	}
+}
+
+func (s *FakeServer) serve(fc *fakeConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, fc)
+		s.mu.Unlock()
+		fc.conn.Close()
+	}()
+
+	for {
+		channel, payload, err := readPacket(fc.conn)
+		if err != nil {
+			return
+		}
+		if channel != controlChannel {
+			continue
+		}
+		r := &tagReader{buf: payload}
+		command, tag := r.u32(), r.u32()
+		reply, events, err := s.handle(fc, command, r)
+		if err == nil && r.err != nil {
+			err = ServerError(3) // PA_ERR_PROTOCOL
+		}
+
+		w := &tagWriter{}
+		var serverErr ServerError
+		if errors.As(err, &serverErr) {
+			w.putU32(commandError)
+			w.putU32(tag)
+			w.putU32(uint32(serverErr))
+		} else {
+			w.putU32(commandReply)
+			w.putU32(tag)
+			if reply != nil {
+				reply(w)
+			}
+		}
+		fc.write(w.buf)
+
+		for _, ev := range events {
+			s.emit(ev.Facility, ev.Type, ev.Index)
+		}
+	}
+}
+
+func (fc *fakeConn) write(payload []byte) {
+	fc.writeMu.Lock()
+	defer fc.writeMu.Unlock()
+	writePacket(fc.conn, payload)
+}
+
+// . emit sends a subscription event to every client subscribed to its facility
+func (s *FakeServer) emit(facility, eventType, index uint32) {
+	w := &tagWriter{}
+	w.putU32(commandSubscribeEvent)
+	w.putU32(InvalidIndex)
+	w.putU32(facility | eventType)
+	w.putU32(index)
+
+	s.mu.Lock()
+	var targets []*fakeConn
+	for fc := range s.conns {
+		if fc.mask&(1<<facility) != 0 {
+			targets = append(targets, fc)
+		}
+	}
+	s.mu.Unlock()
+	for _, fc := range targets {
+		fc.write(w.buf)
+	}
+}
+
+// . handle executes one command. It returns the reply body and the events to raise
+// once the reply has been sent.
+func (s *FakeServer) handle(fc *fakeConn, command uint32, r *tagReader) (func(*tagWriter), []Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := fc.version
+
+	switch command {
+	case commandAuth:
+		if clientVersion := r.u32() & 0xFFFF; clientVersion < fc.version {
+			fc.version = clientVersion
+		}
+		r.arbitrary()
+		serverVersion := s.version
+		return func(w *tagWriter) { w.putU32(serverVersion) }, nil, nil
+
+	case commandSetClientName:
+		r.propList()
+		return func(w *tagWriter) { w.putU32(0) }, nil, nil
+
+	case commandSubscribe:
+		fc.mask = r.u32()
+		return nil, nil, nil
+
+	case commandGetServerInfo:
+		defaultSink, defaultSource := s.defaultSink, s.defaultSource
+		return func(w *tagWriter) {
+			w.putString("pulseaudio")
+			w.putString("fake")
+			w.putString("user")
+			w.putString("host")
+			w.putSampleSpec(3, 2, 48000)
+			w.putString(defaultSink)
+			w.putString(defaultSource)
+			w.putU32(0) // cookie
+			if v >= 15 {
+				w.putChannelMap([]uint8{1, 2})
+			}
+		}, nil, nil
+
+	case commandGetSinkInfoList:
+		sinks := append([]Sink(nil), s.sinks...)
+		return func(w *tagWriter) {
+			for _, sink := range sinks {
+				writeDevice(w, v, sink, InvalidIndex, false)
+			}
+		}, nil, nil
+
+	case commandGetSinkInfo:
+		sink := s.lookupSink(r)
+		if sink == nil {
+			return nil, nil, errNoEntity
+		}
+		d := *sink
+		return func(w *tagWriter) { writeDevice(w, v, d, InvalidIndex, false) }, nil, nil
+
+	case commandGetSourceInfoList:
+		sources := append([]Source(nil), s.sources...)
+		return func(w *tagWriter) {
+			for _, source := range sources {
+				writeDevice(w, v, source.Sink, source.MonitorOfSink, true)
+			}
+		}, nil, nil
+
+	case commandGetSourceInfo:
+		source := s.lookupSource(r)
+		if source == nil {
+			return nil, nil, errNoEntity
+		}
+		d := *source
+		return func(w *tagWriter) { writeDevice(w, v, d.Sink, d.MonitorOfSink, true) }, nil, nil
+
+	case commandGetSinkInputInfoList:
+		inputs := append([]SinkInput(nil), s.inputs...)
+		return func(w *tagWriter) {
+			for _, in := range inputs {
+				writeSinkInput(w, v, in)
+			}
+		}, nil, nil
+
+	case commandGetSinkInputInfo:
+		in := s.findInput(r.u32())
+		if in == nil {
+			return nil, nil, errNoEntity
+		}
+		entry := *in
+		return func(w *tagWriter) { writeSinkInput(w, v, entry) }, nil, nil
+
+	case commandSetSinkVolume, commandSetSinkMute:
+		sink := s.lookupSink(r)
+		if sink == nil {
+			return nil, nil, errNoEntity
+		}
+		if command == commandSetSinkVolume {
+			sink.Volume = r.cvolume()
+		} else {
+			sink.Muted = r.bool()
+		}
+		return nil, []Event{{FacilitySink, EventChange, sink.Index}}, nil
+
+	case commandSetSourceVolume, commandSetSourceMute:
+		source := s.lookupSource(r)
+		if source == nil {
+			return nil, nil, errNoEntity
+		}
+		if command == commandSetSourceVolume {
+			source.Volume = r.cvolume()
+		} else {
+			source.Muted = r.bool()
+		}
+		return nil, []Event{{FacilitySource, EventChange, source.Index}}, nil
+
+	case commandSetSinkInputVolume, commandSetSinkInputMute:
+		in := s.findInput(r.u32())
+		if in == nil {
+			return nil, nil, errNoEntity
+		}
+		if command == commandSetSinkInputVolume {
+			in.Volume = r.cvolume()
+		} else {
+			in.Muted = r.bool()
+		}
+		return nil, []Event{{FacilitySinkInput, EventChange, in.Index}}, nil
+
+	case commandMoveSinkInput:
+		in := s.findInput(r.u32())
+		sink := s.lookupSink(r)
+		if in == nil || sink == nil {
+			return nil, nil, errNoEntity
+		}
+		in.Sink = sink.Index
+		return nil, []Event{{FacilitySinkInput, EventChange, in.Index}}, nil
+
+	case commandSetDefaultSink:
+		name := r.string()
+		found := false
+		for _, sink := range s.sinks {
+			found = found || sink.Name == name
+		}
+		if !found {
+			return nil, nil, errNoEntity
+		}
+		s.defaultSink = name
+		return nil, []Event{{FacilityServer, EventChange, InvalidIndex}}, nil
+
+	case commandSetDefaultSource:
+		name := r.string()
+		found := false
+		for _, source := range s.sources {
+			found = found || source.Name == name
+		}
+		if !found {
+			return nil, nil, errNoEntity
+		}
+		s.defaultSource = name
+		return nil, []Event{{FacilityServer, EventChange, InvalidIndex}}, nil
+	}
+	return nil, nil, errCommand
+}
+
+// . lookupSink reads an (index, name) pair and finds the sink it names. Callers hold s.mu.
+func (s *FakeServer) lookupSink(r *tagReader) *Sink {
+	index, name := r.u32(), r.string()
+	for i := range s.sinks {
+		if (index != InvalidIndex && s.sinks[i].Index == index) || (index == InvalidIndex && s.sinks[i].Name == name) {
+			return &s.sinks[i]
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) lookupSource(r *tagReader) *Source {
+	index, name := r.u32(), r.string()
+	for i := range s.sources {
+		if (index != InvalidIndex && s.sources[i].Index == index) || (index == InvalidIndex && s.sources[i].Name == name) {
+			return &s.sources[i]
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) findSink(index uint32) *Sink {
+	for i := range s.sinks {
+		if s.sinks[i].Index == index {
+			return &s.sinks[i]
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) findInput(index uint32) *SinkInput {
+	for i := range s.inputs {
+		if s.inputs[i].Index == index {
+			return &s.inputs[i]
+		}
+	}
+	return nil
+}
+
+// . writeDevice writes a sink or source entry the way protocol-native.c lays it out
+// for protocol version v
+func writeDevice(w *tagWriter, v uint32, d Sink, monitor uint32, isSource bool) {
+	channels := uint8(max(len(d.Volume), 1))
+	spec := d.Spec
+	if spec.Rate == 0 {
+		spec = SampleSpec{Format: SampleS16LE, Channels: channels, Rate: 48000}
+	}
+	w.putU32(d.Index)
+	w.putString(d.Name)
+	w.putString(d.Description)
+	w.putSampleSpec(spec.Format, spec.Channels, spec.Rate)
+	w.putChannelMap(make([]uint8, channels))
+	w.putU32(InvalidIndex) // owner module
+	w.putCvolume(d.Volume)
+	w.putBool(d.Muted)
+	w.putU32(monitor)
+	w.putNullString()
+	w.putUsec(0)
+	w.putString("fake")
+	w.putU32(0) // flags
+	w.putPropList(map[string]string{"device.description": d.Description})
+	w.putUsec(0)
+	if v >= 15 {
+		w.putVolume(volumeNorm)
+		w.putU32(0)
+		w.putU32(volumeNorm + 1)
+		w.putU32(InvalidIndex)
+	}
+	if v >= 16 {
+		w.putU32(1)
+		w.putString("analog")
+		w.putString("Analog")
+		w.putU32(100)
+		if v >= 24 {
+			w.putU32(0)
+		}
+		if v >= 34 {
+			w.putNullString()
+			w.putU32(0)
+		}
+		w.putString("analog")
+	}
+	if (!isSource && v >= 21) || (isSource && v >= 22) {
+		w.putU8(1)
+		w.putFormatInfo(1, map[string]string{})
+	}
+}
+
+func writeSinkInput(w *tagWriter, v uint32, in SinkInput) {
+	channels := uint8(max(len(in.Volume), 1))
+	w.putU32(in.Index)
+	w.putString(in.Name)
+	w.putU32(InvalidIndex) // owner module
+	w.putU32(0)            // client
+	w.putU32(in.Sink)
+	w.putSampleSpec(3, channels, 48000)
+	w.putChannelMap(make([]uint8, channels))
+	w.putCvolume(in.Volume)
+	w.putUsec(0)
+	w.putUsec(0)
+	w.putNullString()
+	w.putString("protocol-native.c")
+	w.putBool(in.Muted)
+	w.putPropList(in.Properties)
+	if v >= 19 {
+		w.putBool(in.Corked)
+	}
+	if v >= 20 {
+		w.putBool(true)
+		w.putBool(true)
+	}
+	if v >= 21 {
+		w.putFormatInfo(1, map[string]string{})
+	}
+}
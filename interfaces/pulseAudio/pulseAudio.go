@@ -0,0 +1,747 @@
+package pulseAudio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"strconv"
+)
+
+// volumeNorm is PA_VOLUME_NORM, the raw volume of 100% (0 dB)
+const volumeNorm = 0x10000
+
+// . ServerInfo is the subset of the server information SoundShift uses
+type ServerInfo struct {
+	DefaultSink   string
+	DefaultSource string
+}
+
+// . Sink is a playback device, Source a recording device (or the monitor of a sink)
+type Sink struct {
+	Index       uint32
+	Name        string // Stable identifier, used as the device ID
+	Description string // Human-readable name
+	Spec        SampleSpec
+	Volume      []uint32
+	Muted       bool
+}
+
+// . SampleSpec is a pa_sample_spec: the sample format, channel count and rate a device runs at
+type SampleSpec struct {
+	Format   uint8 // One of the Sample* formats
+	Channels uint8
+	Rate     uint32
+}
+
+// . Sample formats (pa_sample_format_t) that map onto a DeviceFormat
+const (
+	SampleS16LE     = 3
+	SampleFloat32LE = 5
+	SampleS32LE     = 7
+	SampleS24LE     = 9
+	SampleS24in32LE = 11
+)
+
+type Source struct {
+	Sink
+	MonitorOfSink uint32 // InvalidIndex unless this source records what a sink plays
+}
+
+// . SinkInput is one playback stream, the equivalent of a WASAPI audio session
+type SinkInput struct {
+	Index      uint32
+	Name       string
+	Sink       uint32
+	Volume     []uint32
+	Muted      bool
+	Corked     bool
+	Properties map[string]string
+}
+
+// ---------------------------------------------------------------------------
+// Queries
+// ---------------------------------------------------------------------------
+
+func (c *Client) ServerInfo() (ServerInfo, error) {
+	r, err := c.request(commandGetServerInfo, nil)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	r.string() // package name
+	r.string() // package version
+	r.string() // user name
+	r.string() // host name
+	r.sampleSpec()
+	info := ServerInfo{DefaultSink: r.string(), DefaultSource: r.string()}
+	if r.err != nil {
+		return ServerInfo{}, fmt.Errorf("failed to parse server info: %w", r.err)
+	}
+	return info, nil
+}
+
+func (c *Client) Sinks() ([]Sink, error) {
+	r, err := c.request(commandGetSinkInfoList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var sinks []Sink
+	for !r.eof() {
+		sink, _ := c.readDevice(r, false)
+		sinks = append(sinks, sink)
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to parse sink list: %w", r.err)
+	}
+	return sinks, nil
+}
+
+func (c *Client) Sink(index uint32) (Sink, error) {
+	r, err := c.request(commandGetSinkInfo, func(w *tagWriter) {
+		w.putU32(index)
+		w.putNullString()
+	})
+	if err != nil {
+		return Sink{}, err
+	}
+	sink, _ := c.readDevice(r, false)
+	if r.err != nil {
+		return Sink{}, fmt.Errorf("failed to parse sink %d: %w", index, r.err)
+	}
+	return sink, nil
+}
+
+func (c *Client) Sources() ([]Source, error) {
+	r, err := c.request(commandGetSourceInfoList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for !r.eof() {
+		source, monitorOf := c.readDevice(r, true)
+		sources = append(sources, Source{Sink: source, MonitorOfSink: monitorOf})
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to parse source list: %w", r.err)
+	}
+	return sources, nil
+}
+
+func (c *Client) Source(index uint32) (Source, error) {
+	r, err := c.request(commandGetSourceInfo, func(w *tagWriter) {
+		w.putU32(index)
+		w.putNullString()
+	})
+	if err != nil {
+		return Source{}, err
+	}
+	source, monitorOf := c.readDevice(r, true)
+	if r.err != nil {
+		return Source{}, fmt.Errorf("failed to parse source %d: %w", index, r.err)
+	}
+	return Source{Sink: source, MonitorOfSink: monitorOf}, nil
+}
+
+// . readDevice reads one sink or source entry. Both share a layout; the monitor fields
+// differ in meaning, and for sources the second return value is the monitored sink.
+func (c *Client) readDevice(r *tagReader, isSource bool) (Sink, uint32) {
+	var d Sink
+	d.Index = r.u32()
+	d.Name = r.string()
+	d.Description = r.string()
+	d.Spec.Format, d.Spec.Channels, d.Spec.Rate = r.sampleSpec()
+	r.channelMap()
+	r.u32() // owner module
+	d.Volume = r.cvolume()
+	d.Muted = r.bool()
+	monitor := r.u32() // sinks: monitor source; sources: monitored sink
+	r.string()         // name of the above
+	r.usec()           // latency
+	r.string()         // driver
+	r.u32()            // flags
+	r.propList()
+	r.usec() // configured latency
+	if c.version >= 15 {
+		r.volume() // base volume
+		r.u32()    // state
+		r.u32()    // volume steps
+		r.u32()    // card
+	}
+	if c.version >= 16 {
+		ports := r.u32()
+		for i := uint32(0); i < ports && r.err == nil; i++ {
+			r.string() // name
+			r.string() // description
+			r.u32()    // priority
+			if c.version >= 24 {
+				r.u32() // availability
+			}
+			if c.version >= 34 {
+				r.string() // availability group
+				r.u32()    // type
+			}
+		}
+		r.string() // active port
+	}
+	if (!isSource && c.version >= 21) || (isSource && c.version >= 22) {
+		formats := r.u8()
+		for i := uint8(0); i < formats && r.err == nil; i++ {
+			r.formatInfo()
+		}
+	}
+	return d, monitor
+}
+
+func (c *Client) SinkInputs() ([]SinkInput, error) {
+	r, err := c.request(commandGetSinkInputInfoList, nil)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []SinkInput
+	for !r.eof() {
+		inputs = append(inputs, c.readSinkInput(r))
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to parse sink input list: %w", r.err)
+	}
+	return inputs, nil
+}
+
+func (c *Client) SinkInput(index uint32) (SinkInput, error) {
+	r, err := c.request(commandGetSinkInputInfo, func(w *tagWriter) {
+		w.putU32(index)
+	})
+	if err != nil {
+		return SinkInput{}, err
+	}
+	input := c.readSinkInput(r)
+	if r.err != nil {
+		return SinkInput{}, fmt.Errorf("failed to parse sink input %d: %w", index, r.err)
+	}
+	return input, nil
+}
+
+func (c *Client) readSinkInput(r *tagReader) SinkInput {
+	var in SinkInput
+	in.Index = r.u32()
+	in.Name = r.string()
+	r.u32() // owner module
+	r.u32() // client
+	in.Sink = r.u32()
+	r.sampleSpec()
+	r.channelMap()
+	in.Volume = r.cvolume()
+	r.usec()   // buffer latency
+	r.usec()   // sink latency
+	r.string() // resample method
+	r.string() // driver
+	in.Muted = r.bool()
+	in.Properties = r.propList()
+	if c.version >= 19 {
+		in.Corked = r.bool()
+	}
+	if c.version >= 20 {
+		r.bool() // has volume
+		r.bool() // volume writable
+	}
+	if c.version >= 21 {
+		r.formatInfo()
+	}
+	return in
+}
+
+// ---------------------------------------------------------------------------
+// Commands
+// ---------------------------------------------------------------------------
+
+func (c *Client) SetDefaultSink(name string) error {
+	_, err := c.request(commandSetDefaultSink, func(w *tagWriter) { w.putString(name) })
+	return err
+}
+
+func (c *Client) SetDefaultSource(name string) error {
+	_, err := c.request(commandSetDefaultSource, func(w *tagWriter) { w.putString(name) })
+	return err
+}
+
+func (c *Client) SetSinkVolume(index uint32, volume []uint32) error {
+	return c.setDeviceVolume(commandSetSinkVolume, index, volume)
+}
+
+func (c *Client) SetSourceVolume(index uint32, volume []uint32) error {
+	return c.setDeviceVolume(commandSetSourceVolume, index, volume)
+}
+
+func (c *Client) setDeviceVolume(command, index uint32, volume []uint32) error {
+	_, err := c.request(command, func(w *tagWriter) {
+		w.putU32(index)
+		w.putNullString()
+		w.putCvolume(volume)
+	})
+	return err
+}
+
+func (c *Client) SetSinkMute(index uint32, muted bool) error {
+	return c.setDeviceMute(commandSetSinkMute, index, muted)
+}
+
+func (c *Client) SetSourceMute(index uint32, muted bool) error {
+	return c.setDeviceMute(commandSetSourceMute, index, muted)
+}
+
+func (c *Client) setDeviceMute(command, index uint32, muted bool) error {
+	_, err := c.request(command, func(w *tagWriter) {
+		w.putU32(index)
+		w.putNullString()
+		w.putBool(muted)
+	})
+	return err
+}
+
+func (c *Client) SetSinkInputVolume(index uint32, volume []uint32) error {
+	_, err := c.request(commandSetSinkInputVolume, func(w *tagWriter) {
+		w.putU32(index)
+		w.putCvolume(volume)
+	})
+	return err
+}
+
+func (c *Client) SetSinkInputMute(index uint32, muted bool) error {
+	_, err := c.request(commandSetSinkInputMute, func(w *tagWriter) {
+		w.putU32(index)
+		w.putBool(muted)
+	})
+	return err
+}
+
+// . MoveSinkInput moves a stream to the named sink. module-stream-restore remembers the
+// move for later streams of the same application.
+func (c *Client) MoveSinkInput(index uint32, sinkName string) error {
+	_, err := c.request(commandMoveSinkInput, func(w *tagWriter) {
+		w.putU32(index)
+		w.putU32(InvalidIndex)
+		w.putString(sinkName)
+	})
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// Mapping onto the shared device and session shapes
+// ---------------------------------------------------------------------------
+
+// . GetDevices lists the sinks as output devices. PulseAudio has a single default sink,
+// so it counts as the default for every role.
+func (c *Client) GetDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	info, err := c.ServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := c.Sinks()
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]mmDeviceEnumerator.AudioDevice, 0, len(sinks))
+	for _, sink := range sinks {
+		devices = append(devices, toAudioDevice(sink, info.DefaultSink, false))
+	}
+	return devices, nil
+}
+
+// . GetCaptureDevices lists the sources, leaving out the monitors of sinks
+func (c *Client) GetCaptureDevices() ([]mmDeviceEnumerator.AudioDevice, error) {
+	info, err := c.ServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	sources, err := c.Sources()
+	if err != nil {
+		return nil, err
+	}
+	var devices []mmDeviceEnumerator.AudioDevice
+	for _, source := range sources {
+		if source.MonitorOfSink != InvalidIndex {
+			continue
+		}
+		devices = append(devices, toAudioDevice(source.Sink, info.DefaultSource, true))
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no capture devices")
+	}
+	return devices, nil
+}
+
+func toAudioDevice(d Sink, defaultName string, capture bool) mmDeviceEnumerator.AudioDevice {
+	name := d.Description
+	if name == "" {
+		name = d.Name
+	}
+	isDefault := d.Name == defaultName
+	return mmDeviceEnumerator.AudioDevice{
+		Name:                    name,
+		Id:                      d.Name,
+		IsDefault:               isDefault,
+		IsDefaultMultimedia:     isDefault,
+		IsDefaultCommunications: isDefault,
+		IsCapture:               capture,
+	}
+}
+
+// . FindDevice looks a sink or source up by name (the device ID)
+func (c *Client) FindDevice(deviceID string) (device Sink, isSource bool, err error) {
+	sinks, err := c.Sinks()
+	if err != nil {
+		return Sink{}, false, err
+	}
+	for _, sink := range sinks {
+		if sink.Name == deviceID {
+			return sink, false, nil
+		}
+	}
+	sources, err := c.Sources()
+	if err != nil {
+		return Sink{}, false, err
+	}
+	for _, source := range sources {
+		if source.Name == deviceID && source.MonitorOfSink == InvalidIndex {
+			return source.Sink, true, nil
+		}
+	}
+	return Sink{}, false, fmt.Errorf("device with ID %s not found", deviceID)
+}
+
+// . SetDefaultDevice makes a sink or source the default. Roles other than console and
+// multimedia have no PulseAudio equivalent; asking only for those is an error.
+func (c *Client) SetDefaultDevice(deviceID string, roles ...uint32) error {
+	supported := len(roles) == 0
+	for _, role := range roles {
+		if role == mmDeviceEnumerator.RoleConsole || role == mmDeviceEnumerator.RoleMultimedia {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("pulseaudio has no separate communications device")
+	}
+
+	_, isSource, err := c.FindDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	if isSource {
+		return c.SetDefaultSource(deviceID)
+	}
+	return c.SetDefaultSink(deviceID)
+}
+
+func (c *Client) GetVolume(deviceID string) (float32, error) {
+	device, _, err := c.FindDevice(deviceID)
+	if err != nil {
+		return 0, err
+	}
+	return VolumeScalar(device.Volume), nil
+}
+
+func (c *Client) SetVolume(deviceID string, level float32) error {
+	device, isSource, err := c.FindDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	volume := ScaleVolume(device.Volume, level)
+	if isSource {
+		return c.SetSourceVolume(device.Index, volume)
+	}
+	return c.SetSinkVolume(device.Index, volume)
+}
+
+func (c *Client) GetMute(deviceID string) (bool, error) {
+	device, _, err := c.FindDevice(deviceID)
+	if err != nil {
+		return false, err
+	}
+	return device.Muted, nil
+}
+
+func (c *Client) SetMute(deviceID string, muted bool) error {
+	device, isSource, err := c.FindDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	if isSource {
+		return c.SetSourceMute(device.Index, muted)
+	}
+	return c.SetSinkMute(device.Index, muted)
+}
+
+// . GetDeviceFormat returns the sample spec a device runs at as a DeviceFormat
+func (c *Client) GetDeviceFormat(deviceID string) (mmDeviceEnumerator.DeviceFormat, error) {
+	device, _, err := c.FindDevice(deviceID)
+	if err != nil {
+		return mmDeviceEnumerator.DeviceFormat{}, err
+	}
+	return toDeviceFormat(device.Spec)
+}
+
+// . toDeviceFormat converts a sample spec; big-endian and companded formats have no
+// DeviceFormat equivalent
+func toDeviceFormat(spec SampleSpec) (mmDeviceEnumerator.DeviceFormat, error) {
+	f := mmDeviceEnumerator.DeviceFormat{SampleRate: spec.Rate, Channels: uint16(spec.Channels)}
+	switch spec.Format {
+	case SampleS16LE:
+		f.BitsPerSample, f.ContainerBits = 16, 16
+	case SampleS24LE:
+		f.BitsPerSample, f.ContainerBits = 24, 24
+	case SampleS24in32LE:
+		f.BitsPerSample, f.ContainerBits = 24, 32
+	case SampleS32LE:
+		f.BitsPerSample, f.ContainerBits = 32, 32
+	case SampleFloat32LE:
+		f.BitsPerSample, f.ContainerBits, f.Float = 32, 32, true
+	default:
+		return mmDeviceEnumerator.DeviceFormat{}, fmt.Errorf("unsupported sample format %d", spec.Format)
+	}
+	return f, nil
+}
+
+// . GetChannelVolumes returns the volume scalar of every channel of a device, in the
+// device's channel map order. Boosted channels read as 1.
+func (c *Client) GetChannelVolumes(deviceID string) ([]float32, error) {
+	device, _, err := c.FindDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]float32, len(device.Volume))
+	for i, v := range device.Volume {
+		levels[i] = min(float32(v)/volumeNorm, 1)
+	}
+	return levels, nil
+}
+
+// . SetChannelVolume sets the volume scalar of one channel of a device, leaving the others
+func (c *Client) SetChannelVolume(deviceID string, channel uint32, level float32) error {
+	device, isSource, err := c.FindDevice(deviceID)
+	if err != nil {
+		return err
+	}
+	if int(channel) >= len(device.Volume) {
+		return fmt.Errorf("device %s has no channel %d", deviceID, channel)
+	}
+	volume := append([]uint32(nil), device.Volume...)
+	volume[channel] = uint32(max(0, min(level, 1)) * volumeNorm)
+	if isSource {
+		return c.SetSourceVolume(device.Index, volume)
+	}
+	return c.SetSinkVolume(device.Index, volume)
+}
+
+// . VolumeScalar converts a channel volume to the 0.0 – 1.0 scalar of the loudest channel,
+// the way the Windows master volume scalar reads. Boosted volumes read as 1.
+func VolumeScalar(volume []uint32) float32 {
+	var loudest uint32
+	for _, v := range volume {
+		loudest = max(loudest, v)
+	}
+	return min(float32(loudest)/volumeNorm, 1)
+}
+
+// . ScaleVolume returns volume with its loudest channel at level, keeping the balance
+// between channels
+func ScaleVolume(volume []uint32, level float32) []uint32 {
+	level = max(0, min(level, 1))
+	target := uint32(level * volumeNorm)
+	if len(volume) == 0 {
+		return []uint32{target, target}
+	}
+	var loudest uint32
+	for _, v := range volume {
+		loudest = max(loudest, v)
+	}
+	scaled := make([]uint32, len(volume))
+	for i, v := range volume {
+		if loudest == 0 {
+			scaled[i] = target
+		} else {
+			scaled[i] = uint32(uint64(v) * uint64(target) / uint64(loudest))
+		}
+	}
+	return scaled
+}
+
+// . GetSessions returns the streams playing to any sink, tagged with their sink. Event
+// sounds (media.role "event") are reported as system sounds sessions.
+func (c *Client) GetSessions() ([]policyConfig.AudioSession, error) {
+	sinks, err := c.Sinks()
+	if err != nil {
+		return nil, err
+	}
+	sinkNames := make(map[uint32]string, len(sinks))
+	for _, sink := range sinks {
+		sinkNames[sink.Index] = sink.Name
+	}
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]policyConfig.AudioSession, 0, len(inputs))
+	for _, in := range inputs {
+		session := ToAudioSession(in)
+		session.DeviceID = sinkNames[in.Sink]
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// . ToAudioSession maps a sink input onto the shape policyConfig produces on Windows. The
+// sink input index is the session ID; the binary (or application name) is its AppID.
+func ToAudioSession(in SinkInput) policyConfig.AudioSession {
+	pid, isSystem := SessionOwner(in)
+	if isSystem {
+		return policyConfig.AudioSession{
+			ID:       SessionID(in.Index),
+			AppID:    "system",
+			Name:     "System Sounds",
+			Volume:   VolumeScalar(in.Volume),
+			Muted:    in.Muted,
+			Active:   !in.Corked,
+			IsSystem: true,
+		}
+	}
+
+	exePath := in.Properties["application.process.binary"]
+	if pid != 0 {
+		if target, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+			exePath = target
+		}
+	}
+	name := in.Properties["application.name"]
+	if name == "" {
+		name = in.Name
+	}
+	if name == "" && exePath != "" {
+		name = filepath.Base(exePath)
+	}
+
+	appID := in.Properties["application.process.binary"]
+	if appID == "" {
+		appID = name
+	}
+
+	return policyConfig.AudioSession{
+		ID:      SessionID(in.Index),
+		AppID:   appID,
+		Name:    name,
+		PID:     pid,
+		Volume:  VolumeScalar(in.Volume),
+		Muted:   in.Muted,
+		Active:  !in.Corked,
+		ExePath: exePath,
+	}
+}
+
+// . SessionID returns the session ID of a sink input
+func SessionID(index uint32) string {
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// . SessionOwner returns the PID and system flag a sink input is addressed by
+func SessionOwner(in SinkInput) (pid uint32, isSystem bool) {
+	if in.Properties["media.role"] == "event" {
+		return 0, true
+	}
+	if v, err := strconv.ParseUint(in.Properties["application.process.id"], 10, 32); err == nil {
+		pid = uint32(v)
+	}
+	return pid, false
+}
+
+// . SetSessionVolume sets the volume of the stream with the given session ID, like
+// policyConfig.SetSessionVolume
+func (c *Client) SetSessionVolume(id string, level float32) error {
+	in, err := c.sessionInput(id)
+	if err != nil {
+		return err
+	}
+	return c.SetSinkInputVolume(in.Index, ScaleVolume(in.Volume, level))
+}
+
+func (c *Client) SetSessionMute(id string, muted bool) error {
+	in, err := c.sessionInput(id)
+	if err != nil {
+		return err
+	}
+	return c.SetSinkInputMute(in.Index, muted)
+}
+
+// . sessionInput returns the sink input a session ID refers to
+func (c *Client) sessionInput(id string) (SinkInput, error) {
+	index, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return SinkInput{}, fmt.Errorf("invalid session ID %q", id)
+	}
+	in, err := c.SinkInput(uint32(index))
+	if err != nil {
+		return SinkInput{}, fmt.Errorf("no audio session with ID %s: %w", id, err)
+	}
+	return in, nil
+}
+
+// . GetSessionDevice returns the sink the streams of pid play to, or "" when they play
+// to the default sink (or pid has no stream)
+func (c *Client) GetSessionDevice(pid uint32) (string, error) {
+	info, err := c.ServerInfo()
+	if err != nil {
+		return "", err
+	}
+	sinks, err := c.Sinks()
+	if err != nil {
+		return "", err
+	}
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		return "", err
+	}
+	for _, in := range inputs {
+		if inPID, isSystem := SessionOwner(in); inPID != pid || isSystem {
+			continue
+		}
+		for _, sink := range sinks {
+			if sink.Index == in.Sink && sink.Name != info.DefaultSink {
+				return sink.Name, nil
+			}
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// . SetSessionDevice moves every stream of pid to the sink deviceID, or to the default
+// sink when deviceID is ""
+func (c *Client) SetSessionDevice(pid uint32, deviceID string) error {
+	if pid == 0 {
+		return fmt.Errorf("invalid process ID provided")
+	}
+	if deviceID == "" {
+		info, err := c.ServerInfo()
+		if err != nil {
+			return err
+		}
+		deviceID = info.DefaultSink
+	}
+	inputs, err := c.SinkInputs()
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, in := range inputs {
+		if inPID, isSystem := SessionOwner(in); inPID != pid || isSystem {
+			continue
+		}
+		matched = true
+		if err := c.MoveSinkInput(in.Index, deviceID); err != nil {
+			return fmt.Errorf("failed to move sink input %d: %w", in.Index, err)
+		}
+	}
+	if !matched {
+		return fmt.Errorf("no session matched PID %d", pid)
+	}
+	return nil
+}
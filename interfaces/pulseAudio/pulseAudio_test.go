@@ -0,0 +1,349 @@
+package pulseAudio
+
+import (
+	"errors"
+	"path/filepath"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"testing"
+	"time"
+)
+
+// newTestServer starts a fake server with two sinks, a microphone and the monitor of the
+// first sink, plus a browser stream, a music stream and an event sound on the default sink.
+func newTestServer(t *testing.T) *FakeServer {
+	t.Helper()
+	s, err := NewFakeServer(filepath.Join(t.TempDir(), "native"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	s.AddSink(Sink{Index: 0, Name: "alsa_output.speakers", Description: "Speakers", Volume: []uint32{volumeNorm / 2, volumeNorm / 2}})
+	s.AddSink(Sink{Index: 1, Name: "bluez_sink.headset", Description: "Headset", Volume: []uint32{volumeNorm, volumeNorm}, Muted: true})
+	s.AddSource(Source{Sink: Sink{Index: 0, Name: "alsa_output.speakers.monitor", Description: "Monitor of Speakers"}, MonitorOfSink: 0})
+	s.AddSource(Source{Sink: Sink{Index: 1, Name: "alsa_input.mic", Description: "Microphone", Volume: []uint32{volumeNorm}}, MonitorOfSink: InvalidIndex})
+	s.SetDefaults("alsa_output.speakers", "alsa_input.mic")
+
+	s.AddSinkInput(SinkInput{Index: 10, Name: "Playback", Sink: 0, Volume: []uint32{volumeNorm, volumeNorm / 2}, Properties: map[string]string{
+		"application.name":           "Firefox",
+		"application.process.id":     "4242",
+		"application.process.binary": "firefox",
+	}})
+	s.AddSinkInput(SinkInput{Index: 11, Name: "Music", Sink: 1, Volume: []uint32{volumeNorm}, Properties: map[string]string{
+		"application.name":       "Spotify",
+		"application.process.id": "5151",
+	}})
+	s.AddSinkInput(SinkInput{Index: 12, Name: "bell", Sink: 0, Volume: []uint32{volumeNorm}, Properties: map[string]string{
+		"media.role": "event",
+	}})
+	return s
+}
+
+func dialTest(t *testing.T, s *FakeServer, onEvent func(Event)) *Client {
+	t.Helper()
+	c, err := DialPath(s.Path(), onEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGetDevicesMapsSinks(t *testing.T) {
+	c := dialTest(t, newTestServer(t), nil)
+
+	devices, err := c.GetDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mmDeviceEnumerator.AudioDevice{
+		{Name: "Speakers", Id: "alsa_output.speakers", IsDefault: true, IsDefaultMultimedia: true, IsDefaultCommunications: true},
+		{Name: "Headset", Id: "bluez_sink.headset"},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("GetDevices = %+v, want %+v", devices, want)
+	}
+	for i := range want {
+		if devices[i] != want[i] {
+			t.Errorf("device %d = %+v, want %+v", i, devices[i], want[i])
+		}
+	}
+}
+
+func TestGetCaptureDevicesSkipsMonitors(t *testing.T) {
+	c := dialTest(t, newTestServer(t), nil)
+
+	devices, err := c.GetCaptureDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Id != "alsa_input.mic" || !devices[0].IsDefault || !devices[0].IsCapture {
+		t.Errorf("GetCaptureDevices = %+v, want only the default microphone", devices)
+	}
+}
+
+func TestOlderProtocolVersions(t *testing.T) {
+	for _, version := range []uint32{13, 15, 16, 21, 22, 24} {
+		s := newTestServer(t)
+		s.SetVersion(version)
+		c := dialTest(t, s, nil)
+
+		devices, err := c.GetDevices()
+		if err != nil || len(devices) != 2 {
+			t.Errorf("version %d: GetDevices = %+v, %v", version, devices, err)
+		}
+		capture, err := c.GetCaptureDevices()
+		if err != nil || len(capture) != 1 {
+			t.Errorf("version %d: GetCaptureDevices = %+v, %v", version, capture, err)
+		}
+		sessions, err := c.GetSessions()
+		if err != nil || len(sessions) != 3 {
+			t.Errorf("version %d: GetSessions = %+v, %v", version, sessions, err)
+		}
+	}
+}
+
+func TestSetDefaultDevice(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+
+	if err := c.SetDefaultDevice("bluez_sink.headset", mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.DefaultSink(); got != "bluez_sink.headset" {
+		t.Errorf("default sink = %q, want the headset", got)
+	}
+
+	if err := c.SetDefaultDevice("bluez_sink.headset", mmDeviceEnumerator.RoleCommunications); err == nil {
+		t.Error("a communications-only switch should fail: PulseAudio has no such role")
+	}
+	if err := c.SetDefaultDevice("alsa_output.speakers.monitor"); err == nil {
+		t.Error("a monitor source must not be selectable as a device")
+	}
+	if err := c.SetDefaultDevice("missing"); err == nil {
+		t.Error("switching to an unknown device should fail")
+	}
+}
+
+func TestVolumeAndMute(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+
+	if level, err := c.GetVolume("alsa_output.speakers"); err != nil || level != 0.5 {
+		t.Errorf("GetVolume = %v, %v; want 0.5", level, err)
+	}
+	if muted, err := c.GetMute("bluez_sink.headset"); err != nil || !muted {
+		t.Errorf("GetMute = %v, %v; want true", muted, err)
+	}
+
+	if err := c.SetVolume("alsa_output.speakers", 0.25); err != nil {
+		t.Fatal(err)
+	}
+	sink, _ := s.SinkByName("alsa_output.speakers")
+	if sink.Volume[0] != volumeNorm/4 || sink.Volume[1] != volumeNorm/4 {
+		t.Errorf("sink volume = %v, want both channels at 25%%", sink.Volume)
+	}
+
+	if err := c.SetVolume("alsa_input.mic", 0.75); err != nil {
+		t.Fatal(err)
+	}
+	if source, _ := s.SourceByName("alsa_input.mic"); source.Volume[0] != volumeNorm*3/4 {
+		t.Errorf("source volume = %v, want 75%%", source.Volume)
+	}
+
+	if err := c.SetMute("alsa_output.speakers", true); err != nil {
+		t.Fatal(err)
+	}
+	if sink, _ := s.SinkByName("alsa_output.speakers"); !sink.Muted || sink.Volume[0] != volumeNorm/4 {
+		t.Errorf("sink = %+v, want muted with its volume kept", sink)
+	}
+
+	if _, err := c.GetVolume("missing"); err == nil {
+		t.Error("GetVolume of an unknown device should fail")
+	}
+}
+
+func TestChannelVolumes(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+
+	if err := c.SetChannelVolume("alsa_output.speakers", 1, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	levels, err := c.GetChannelVolumes("alsa_output.speakers")
+	if err != nil || len(levels) != 2 || levels[0] != 0.5 || levels[1] != 0.25 {
+		t.Errorf("GetChannelVolumes = %v, %v; want [0.5 0.25]", levels, err)
+	}
+	if err := c.SetChannelVolume("alsa_input.mic", 1, 0.5); err == nil {
+		t.Error("setting a channel a mono source does not have should fail")
+	}
+}
+
+func TestDeviceFormat(t *testing.T) {
+	s := newTestServer(t)
+	s.UpdateSink(Sink{Index: 0, Name: "alsa_output.speakers", Description: "Speakers", Spec: SampleSpec{Format: SampleS24in32LE, Channels: 2, Rate: 96000}, Volume: []uint32{volumeNorm, volumeNorm}})
+	c := dialTest(t, s, nil)
+
+	format, err := c.GetDeviceFormat("alsa_output.speakers")
+	if err != nil || format.String() != "24 bit, 96000 Hz" || format.ContainerBits != 32 || format.Channels != 2 {
+		t.Errorf("GetDeviceFormat = %+v, %v; want 24 bit in 32, 96 kHz stereo", format, err)
+	}
+	if _, err := toDeviceFormat(SampleSpec{Format: 2, Channels: 1, Rate: 8000}); err == nil {
+		t.Error("a u-law sink has no device format")
+	}
+}
+
+func TestScaleVolumeKeepsBalance(t *testing.T) {
+	got := ScaleVolume([]uint32{volumeNorm, volumeNorm / 2}, 0.5)
+	if got[0] != volumeNorm/2 || got[1] != volumeNorm/4 {
+		t.Errorf("ScaleVolume = %v, want the loudest channel at 50%% and the balance kept", got)
+	}
+	if got := ScaleVolume([]uint32{0, 0}, 0.4); got[0] != got[1] || VolumeScalar(got) < 0.39 {
+		t.Errorf("ScaleVolume of silence = %v, want both channels at 40%%", got)
+	}
+	if got := VolumeScalar([]uint32{volumeNorm * 3 / 2}); got != 1 {
+		t.Errorf("VolumeScalar of a boosted channel = %v, want 1", got)
+	}
+}
+
+func TestGetSessionsMapsSinkInputs(t *testing.T) {
+	c := dialTest(t, newTestServer(t), nil)
+
+	sessions, err := c.GetSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("GetSessions = %+v, want the streams of both sinks", sessions)
+	}
+	firefox, spotify, system := sessions[0], sessions[1], sessions[2]
+	if firefox.Name != "Firefox" || firefox.PID != 4242 || firefox.Volume != 1 || firefox.IsSystem || firefox.ID != "10" || firefox.DeviceID != "alsa_output.speakers" {
+		t.Errorf("browser session = %+v", firefox)
+	}
+	if firefox.ExePath == "" {
+		t.Error("ExePath should fall back to application.process.binary")
+	}
+	if spotify.DeviceID != "bluez_sink.headset" {
+		t.Errorf("Spotify session device = %q, want the headset it plays on", spotify.DeviceID)
+	}
+	if !system.IsSystem || system.Name != "System Sounds" || system.PID != 0 {
+		t.Errorf("event sound session = %+v, want System Sounds", system)
+	}
+}
+
+func TestSetSessionVolumeAndMute(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+
+	if err := c.SetSessionVolume("10", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	in, _ := s.SinkInputByIndex(10)
+	if in.Volume[0] != volumeNorm/2 || in.Volume[1] != volumeNorm/4 {
+		t.Errorf("stream volume = %v, want scaled to 50%%", in.Volume)
+	}
+
+	if err := c.SetSessionMute("12", true); err != nil {
+		t.Fatal(err)
+	}
+	if in, _ := s.SinkInputByIndex(12); !in.Muted {
+		t.Error("system sounds were not muted")
+	}
+
+	if err := c.SetSessionVolume("99", 0.5); err == nil {
+		t.Error("an unknown session ID should fail")
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	s := newTestServer(t)
+	events := make(chan Event, 16)
+	c := dialTest(t, s, func(ev Event) { events <- ev })
+	if err := c.Subscribe(SubscribeSinkInput | SubscribeServer); err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for an event")
+			return Event{}
+		}
+	}
+
+	// Changes made through a client raise events like outside changes do
+	if err := c.SetSessionMute("10", true); err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(); ev != (Event{Facility: FacilitySinkInput, Type: EventChange, Index: 10}) {
+		t.Errorf("event = %+v, want a change of sink input 10", ev)
+	}
+
+	s.RemoveSinkInput(12)
+	if ev := next(); ev != (Event{Facility: FacilitySinkInput, Type: EventRemove, Index: 12}) {
+		t.Errorf("event = %+v, want the removal of sink input 12", ev)
+	}
+
+	// Sink events are not subscribed to
+	s.UpdateSink(Sink{Index: 0, Name: "alsa_output.speakers", Description: "Speakers", Volume: []uint32{0, 0}})
+	s.SetDefaults("bluez_sink.headset", "alsa_input.mic")
+	if ev := next(); ev.Facility != FacilityServer {
+		t.Errorf("event = %+v, want the server change", ev)
+	}
+}
+
+func TestRequestsFailAfterServerCloses(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+	s.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Err() == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.Err() == nil {
+		t.Fatal("Err should report the lost connection")
+	}
+	if _, err := c.GetDevices(); err == nil {
+		t.Error("requests on a closed connection should fail")
+	}
+}
+
+func TestServerErrorReply(t *testing.T) {
+	c := dialTest(t, newTestServer(t), nil)
+
+	_, err := c.SinkInput(99)
+	var serverErr ServerError
+	if !errors.As(err, &serverErr) || serverErr != errNoEntity {
+		t.Errorf("SinkInput(99) error = %v, want no such entity", err)
+	}
+}
+
+func TestSetSessionDeviceMovesStreams(t *testing.T) {
+	s := newTestServer(t)
+	c := dialTest(t, s, nil)
+
+	if err := c.SetSessionDevice(4242, "bluez_sink.headset"); err != nil {
+		t.Fatal(err)
+	}
+	if in, _ := s.SinkInputByIndex(10); in.Sink != 1 {
+		t.Errorf("stream is on sink %d, want the headset", in.Sink)
+	}
+	if deviceID, err := c.GetSessionDevice(4242); err != nil || deviceID != "bluez_sink.headset" {
+		t.Errorf("GetSessionDevice = %q, %v; want the headset", deviceID, err)
+	}
+
+	if err := c.SetSessionDevice(4242, ""); err != nil {
+		t.Fatal(err)
+	}
+	if deviceID, err := c.GetSessionDevice(4242); err != nil || deviceID != "" {
+		t.Errorf("GetSessionDevice = %q, %v; want the default sink", deviceID, err)
+	}
+
+	if err := c.SetSessionDevice(4242, "missing"); err == nil {
+		t.Error("moving to an unknown sink should fail")
+	}
+}
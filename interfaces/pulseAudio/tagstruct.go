@@ -0,0 +1,301 @@
+package pulseAudio
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// . Tagstruct value tags. Every value in a native protocol message is prefixed by one of
+// these bytes; multi-byte integers are big-endian.
+const (
+	tagString     = 't'
+	tagStringNull = 'N'
+	tagU32        = 'L'
+	tagU8         = 'B'
+	tagU64        = 'R'
+	tagS64        = 'r'
+	tagSampleSpec = 'a'
+	tagArbitrary  = 'x'
+	tagBoolTrue   = '1'
+	tagBoolFalse  = '0'
+	tagTimeval    = 'T'
+	tagUsec       = 'U'
+	tagChannelMap = 'm'
+	tagCvolume    = 'v'
+	tagPropList   = 'P'
+	tagVolume     = 'V'
+	tagFormatInfo = 'f'
+)
+
+// . tagWriter builds a tagstruct
+type tagWriter struct {
+	buf []byte
+}
+
+func (w *tagWriter) putU32(v uint32) {
+	w.buf = append(w.buf, tagU32)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *tagWriter) putU8(v uint8) {
+	w.buf = append(w.buf, tagU8, v)
+}
+
+func (w *tagWriter) putUsec(v uint64) {
+	w.buf = append(w.buf, tagUsec)
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+func (w *tagWriter) putString(s string) {
+	w.buf = append(w.buf, tagString)
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+}
+
+func (w *tagWriter) putNullString() {
+	w.buf = append(w.buf, tagStringNull)
+}
+
+func (w *tagWriter) putBool(v bool) {
+	if v {
+		w.buf = append(w.buf, tagBoolTrue)
+	} else {
+		w.buf = append(w.buf, tagBoolFalse)
+	}
+}
+
+func (w *tagWriter) putArbitrary(data []byte) {
+	w.buf = append(w.buf, tagArbitrary)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(len(data)))
+	w.buf = append(w.buf, data...)
+}
+
+func (w *tagWriter) putSampleSpec(format, channels uint8, rate uint32) {
+	w.buf = append(w.buf, tagSampleSpec, format, channels)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, rate)
+}
+
+func (w *tagWriter) putChannelMap(positions []uint8) {
+	w.buf = append(w.buf, tagChannelMap, uint8(len(positions)))
+	w.buf = append(w.buf, positions...)
+}
+
+func (w *tagWriter) putCvolume(volumes []uint32) {
+	w.buf = append(w.buf, tagCvolume, uint8(len(volumes)))
+	for _, v := range volumes {
+		w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+	}
+}
+
+func (w *tagWriter) putVolume(v uint32) {
+	w.buf = append(w.buf, tagVolume)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+// . putPropList writes string properties; values carry the trailing NUL libpulse expects
+func (w *tagWriter) putPropList(props map[string]string) {
+	w.buf = append(w.buf, tagPropList)
+	for key, value := range props {
+		w.putString(key)
+		w.putU32(uint32(len(value) + 1))
+		w.putArbitrary(append([]byte(value), 0))
+	}
+	w.putNullString()
+}
+
+func (w *tagWriter) putFormatInfo(encoding uint8, props map[string]string) {
+	w.buf = append(w.buf, tagFormatInfo)
+	w.putU8(encoding)
+	w.putPropList(props)
+}
+
+// . tagReader reads a tagstruct. The first error is sticky: later reads return zero
+// values and err reports what went wrong.
+type tagReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *tagReader) eof() bool {
+	return r.err != nil || r.pos >= len(r.buf)
+}
+
+func (r *tagReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("tagstruct at offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+// . take consumes n bytes, or fails if fewer remain
+func (r *tagReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.fail("truncated (need %d bytes)", n)
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// . expect consumes the next tag byte and checks it against one of the wanted tags
+func (r *tagReader) expect(tags ...byte) byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	for _, t := range tags {
+		if b[0] == t {
+			return t
+		}
+	}
+	r.pos--
+	r.fail("unexpected tag %q, want %q", b[0], tags)
+	return 0
+}
+
+func (r *tagReader) u32() uint32 {
+	if r.expect(tagU32) == 0 {
+		return 0
+	}
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *tagReader) u8() uint8 {
+	if r.expect(tagU8) == 0 {
+		return 0
+	}
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *tagReader) usec() uint64 {
+	if r.expect(tagUsec) == 0 {
+		return 0
+	}
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// . string reads a string; a NULL string reads as ""
+func (r *tagReader) string() string {
+	if r.expect(tagString, tagStringNull) != tagString {
+		return ""
+	}
+	rest := r.buf[r.pos:]
+	for i, c := range rest {
+		if c == 0 {
+			r.pos += i + 1
+			return string(rest[:i])
+		}
+	}
+	r.fail("unterminated string")
+	return ""
+}
+
+func (r *tagReader) bool() bool {
+	return r.expect(tagBoolTrue, tagBoolFalse) == tagBoolTrue
+}
+
+func (r *tagReader) arbitrary() []byte {
+	if r.expect(tagArbitrary) == 0 {
+		return nil
+	}
+	b := r.take(4)
+	if b == nil {
+		return nil
+	}
+	return r.take(int(binary.BigEndian.Uint32(b)))
+}
+
+func (r *tagReader) sampleSpec() (format, channels uint8, rate uint32) {
+	if r.expect(tagSampleSpec) == 0 {
+		return 0, 0, 0
+	}
+	if b := r.take(6); b != nil {
+		return b[0], b[1], binary.BigEndian.Uint32(b[2:])
+	}
+	return 0, 0, 0
+}
+
+func (r *tagReader) channelMap() []uint8 {
+	if r.expect(tagChannelMap) == 0 {
+		return nil
+	}
+	n := r.take(1)
+	if n == nil {
+		return nil
+	}
+	return append([]uint8(nil), r.take(int(n[0]))...)
+}
+
+func (r *tagReader) cvolume() []uint32 {
+	if r.expect(tagCvolume) == 0 {
+		return nil
+	}
+	n := r.take(1)
+	if n == nil {
+		return nil
+	}
+	volumes := make([]uint32, n[0])
+	for i := range volumes {
+		b := r.take(4)
+		if b == nil {
+			return nil
+		}
+		volumes[i] = binary.BigEndian.Uint32(b)
+	}
+	return volumes
+}
+
+func (r *tagReader) volume() uint32 {
+	if r.expect(tagVolume) == 0 {
+		return 0
+	}
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// . propList reads a property list; values are returned without their trailing NUL
+func (r *tagReader) propList() map[string]string {
+	if r.expect(tagPropList) == 0 {
+		return nil
+	}
+	props := make(map[string]string)
+	for r.err == nil {
+		if r.pos < len(r.buf) && r.buf[r.pos] == tagStringNull {
+			r.pos++
+			return props
+		}
+		key := r.string()
+		size := r.u32()
+		value := r.arbitrary()
+		if r.err == nil && uint32(len(value)) != size {
+			r.fail("property %q length mismatch", key)
+		}
+		for len(value) > 0 && value[len(value)-1] == 0 {
+			value = value[:len(value)-1]
+		}
+		props[key] = string(value)
+	}
+	return nil
+}
+
+func (r *tagReader) formatInfo() (encoding uint8, props map[string]string) {
+	if r.expect(tagFormatInfo) == 0 {
+		return 0, nil
+	}
+	return r.u8(), r.propList()
+}
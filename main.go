@@ -1,21 +1,23 @@
+//go:build windows
+
 package main
 
 import (
 	"bytes"
 	_ "embed"
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
 	"os"
-	"regexp"
 	"runtime"
+	"slices"
 	"soundshift/file"
 	"soundshift/fyneCustom"
 	"soundshift/fyneTheme"
 	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
 	"soundshift/interfaces/mmDeviceEnumerator"
 	"soundshift/interfaces/policyConfig"
 	"soundshift/winapi"
@@ -43,40 +45,20 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-// . Structs for application configuration and device settings
-type DeviceConfig struct {
-	Name         string
-	IsShown      bool
-	OriginalName string
-}
-
-type AppSettings struct {
-	HideAfterSelection     bool
-	RememberScrollPosition bool
-	HiddenApps             map[string]bool // key = lowercase exe name (e.g. "firefox")
-	DeviceNames            map[string]DeviceConfig
-}
-
 // . Global variables for application state and configuration
-var lastHideTime atomic.Int64    // unix-nano timestamp of last hideMainWindow call
-var configWindowOpen atomic.Bool // replaces plain bool; safe for concurrent read from goroutines
-var settings AppSettings
-var currentDeviceID string
-var audioDevices []mmDeviceEnumerator.AudioDevice
+var lastHideTime atomic.Int64 // unix-nano timestamp of last hideMainWindow call
 var windowPadding = 20
 var screenWidth = int(win.GetSystemMetrics(win.SM_CXSCREEN))
 var screenHeight = int(win.GetSystemMetrics(win.SM_CYSCREEN))
 var taskbarHeight = winapi.GetTaskbarHeight()
 var hwnd windows.HWND
 var configHwnd windows.HWND
-var deviceVboxPlaceholder = container.New(&fyneCustom.CustomVBoxLayout{FixedWidth: 150})
 var placementAreaMu sync.RWMutex
 var placementArea winapi.RECT
 var placementAreaSet bool
 
-// . mu protects audioDevices and currentDeviceID which are accessed from multiple goroutines.
-// Rule: never hold mu while calling fyne.Do.
-var mu sync.Mutex
+// . backend is the audio stack behind every device, volume and mixer call
+var backend audioBackend.AudioBackend = audioBackend.WASAPI{}
 
 // . Slide animation state: slideGen invalidates any in-flight animation when a
 // new show/hide starts; hiding guards against overlapping slide-out sequences.
@@ -144,6 +126,11 @@ func waitForHWNDByTitle(pid uint32, title string, timeout time.Duration) (window
 	return 0, fmt.Errorf("timeout acquiring hwnd for %q", title)
 }
 
+// . isMainWindowVisible reports whether the flyout is currently shown
+func isMainWindowVisible() bool {
+	return winapi.IsWindowVisible(hwnd)
+}
+
 func hideMainWindow() {
 	if hwnd == 0 || !winapi.IsWindowVisible(hwnd) {
 		if hwnd != 0 {
@@ -183,7 +170,7 @@ func showMainWindow() {
 	}
 
 	// Use the cached background session snapshot for an instant refresh on window show.
-	// If background polling hasn't run yet, fall back to a live fetch.
+	// If monitorMixer hasn't published a snapshot yet, fall back to a live fetch.
 	cachedSessionsMu.Lock()
 	snapshot := cachedSessions
 	cachedSessionsMu.Unlock()
@@ -242,6 +229,7 @@ func showMainWindow() {
 		close(shown)
 	})
 	<-shown
+	signal(windowShown)
 
 	if posErr == nil {
 		if animateWindowY(finalX, finalY+slideOffset, finalY, 200*time.Millisecond, gen, easeOutBack) {
@@ -355,9 +343,27 @@ func toggleWindow() {
 	}
 }
 
+// . foregroundApp returns the process of the foreground window and its executable path
+func foregroundApp() (pid uint32, exePath string) {
+	fg := winapi.GetForegroundWindow()
+	if fg == 0 {
+		return 0, ""
+	}
+	if _, err := windows.GetWindowThreadProcessId(fg, &pid); err != nil {
+		return 0, ""
+	}
+	return pid, policyConfig.ExePathForPID(pid)
+}
+
 // . cleanExit performs proper cleanup before exiting
 func cleanExit() {
 	general.LogError("CLEAN_EXIT", nil)
+	//* Fades are finished, and background and ducked apps restored, so nothing stays
+	//* turned down once SoundShift is gone
+	fader.Finish()
+	releaseSolo()
+	restoreBackgroundSessions()
+	duck.restore()
 	mouse.Uninstall()
 	systray.Quit()
 	fyne.Do(func() {
@@ -372,79 +378,16 @@ var App fyne.App = app.New()
 var Win fyne.Window = App.NewWindow(title)
 var configWin fyne.Window = App.NewWindow("Configure")
 
-// * Top section: device selector + master volume
-var topSection = container.NewCenter(
-	container.NewVBox(
-		deviceVboxPlaceholder,
-		&canvas.Line{StrokeColor: color.NRGBA{R: 0x30, G: 0x30, B: 0x30, A: 0xCC}, StrokeWidth: 1},
-		configButton,
-		container.NewPadded(volumeSlider),
-	),
-)
-
-// * Mixer section: per-app volume sliders
-var mixerVbox = container.NewVBox()
-var mixerSection = container.NewVBox() // populated when sessions exist
-
-// * Inner content: everything that can be scrolled
-var mainViewInner = container.NewPadded(
-	container.NewVBox(
-		topSection,
-		mixerSection,
-	),
-)
-
-// * Main view: scrollable wrapper
-var mainView = container.NewVScroll(mainViewInner)
-
-// * Configure button to open settings window
-var configButton = &widget.Button{Text: "Configure"}
-
-// * Scrollable volume slider control
-var volumeSlider = fyneCustom.NewScrollableSlider(0, 100)
-
 // . Initialization function for setting up UI interactions
 func init() {
-	//* Set up volume slider callback to adjust volume when changed
-	volumeSlider.OnChanged = func(f float64) {
-		volumeScalar := float32(f / 100.0)
-
-		mu.Lock()
-		devID := currentDeviceID
-		devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
-		copy(devices, audioDevices)
-		mu.Unlock()
-
-		if devID == "" {
-			return
-		}
-
-		// Skip setting volume for disabled slider (inaccessible Remote Audio)
-		if volumeSlider.Disabled {
-			return
-		}
-
-		// Check if this is Remote Audio and test accessibility before setting volume
-		for _, device := range devices {
-			if device.Id == devID && device.Name == "Remote Audio" {
-				_, err := policyConfig.GetVolume(devID)
-				if err != nil {
-					return
-				}
-				break
-			}
-		}
-
-		if err := policyConfig.SetVolume(devID, volumeScalar); err != nil {
-			fmt.Println("Error setting volume:", err)
-			general.LogError("Error setting volume:", err)
-		}
-	}
-
 	//* Configure the behavior of the config window and button
 	configWin = fyne.CurrentApp().NewWindow("Configure")
 	configButton.OnTapped = func() {
 		if !configWindowOpen.Load() {
+			//* Build the form afresh so it shows the devices and settings as they are now
+			if form := genConfigForm(); form != nil {
+				configWin.SetContent(form)
+			}
 			configWin.Show()
 			configWin.CenterOnScreen()
 			configWindowOpen.Store(true)
@@ -466,6 +409,7 @@ func init() {
 		configWin.Hide()
 		configWindowOpen.Store(false)
 		configButton.Enable()
+		requestDeviceRefresh() // device changes are deferred while the config window is open
 	})
 }
 
@@ -613,6 +557,10 @@ func main() {
 
 	//* Load saved settings for audio devices
 	loadSettings()
+	applyForegroundMode()
+	applyDucking()
+	applyVolumeCaps()
+	renderProfiles()
 
 	//* Retrieve the current process ID for identifying application windows
 	pid := windows.GetCurrentProcessId()
@@ -639,7 +587,6 @@ func main() {
 
 	//* Configure config window properties and layout
 	configWin.SetIcon(fyne.NewStaticResource("icon", icon))
-	configWin.SetContent(genConfigForm())
 	configWin.Resize(fyne.NewSize(600, 500))
 	configWin.SetOnClosed(func() {
 		configButton.Enable()
@@ -692,334 +639,42 @@ func main() {
 		withRecovery("hideOnClick", hideOnClick)
 		withRecovery("monitorFocusLoss", monitorFocusLoss)
 		withRecovery("updateDevices", updateDevices)
-		withRecovery("monitorDeviceChanges", monitorDeviceChanges)
+		withRecovery("monitorMasterVolume", monitorMasterVolume)
 		withRecovery("monitorMixer", monitorMixer)
+		withRecovery("monitorMeters", monitorMeters)
+		withRecovery("monitorForeground", monitorForeground)
+		withRecovery("monitorDucking", monitorDucking)
 	})
 
 	//* Run the application event loop (this performs the one and only startup show)
 	Win.ShowAndRun()
 }
 
-// . filterValidDevices filters out inaccessible devices while always including Remote Audio.
-func filterValidDevices(devices []mmDeviceEnumerator.AudioDevice) []mmDeviceEnumerator.AudioDevice {
-	valid := make([]mmDeviceEnumerator.AudioDevice, 0, len(devices))
-	var remoteAudio *mmDeviceEnumerator.AudioDevice
-	for _, device := range devices {
-		if device.Name == "Remote Audio" {
-			copy := device
-			remoteAudio = &copy
-			continue
-		}
-		if _, err := policyConfig.GetVolume(device.Id); err == nil {
-			valid = append(valid, device)
-		}
-	}
-	if remoteAudio != nil {
-		valid = append(valid, *remoteAudio)
-	}
-	return valid
-}
-
-// . checkAndUpdateDevices checks for changes in the list of audio devices and updates the UI if changes are detected
-func checkAndUpdateDevices() {
-	//* Retrieve the current list of audio devices
-	newAudioDevices, err := mmDeviceEnumerator.GetDevices()
-	if err != nil || newAudioDevices == nil {
-		fmt.Println("Error getting audio devices:", err)
-		general.LogError("Error getting audio devices:", err)
-		return
-	}
-
-	validDevices := filterValidDevices(newAudioDevices)
-
-	//* Check for changes and whether config window is open — hold lock briefly
-	mu.Lock()
-	changed := !audioDevicesEqual(audioDevices, validDevices)
-	open := configWindowOpen.Load()
-	if changed && !open {
-		audioDevices = validDevices
-		currentDeviceID = ""
-	}
-	mu.Unlock()
-
-	if changed && !open {
-		loadSettings()
-		fyne.Do(func() {
-			renderButtons()
-			if winapi.IsWindowVisible(hwnd) {
-				resizeOnUI()
-			}
-		})
-	}
-}
-
-// . updateDevices continuously checks for audio device changes at regular intervals
-func updateDevices() {
-	// Force an immediate fresh device list retrieval on startup
-	freshDevices, err := mmDeviceEnumerator.GetDevices()
-	if err == nil && freshDevices != nil {
-		validDevices := filterValidDevices(freshDevices)
-
-		mu.Lock()
-		audioDevices = validDevices
-		mu.Unlock()
-
-		fyne.Do(func() {
-			renderButtons()
-			if winapi.IsWindowVisible(hwnd) {
-				resizeOnUI()
-			}
-		})
-	}
-
-	// Set up the ticker for subsequent device updates
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		checkAndUpdateDevices()
-	}
+// . configDeviceRow holds the widgets of one device in the config form
+type configDeviceRow struct {
+	device  mmDeviceEnumerator.AudioDevice
+	name    *widget.Entry
+	shown   *widget.Check
+	enabled *widget.Check
+	format  *formatPicker
 }
 
-// . renderButtons dynamically creates and updates buttons for each audio device in the UI.
-// Must be called on the Fyne goroutine (directly or inside fyne.Do).
-func renderButtons() {
-	//* Snapshot shared state under the lock so we don't hold it during UI work
-	mu.Lock()
-	devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
-	copy(devices, audioDevices)
-	prevDeviceID := currentDeviceID
-	mu.Unlock()
-
-	newDeviceVbox := container.New(&fyneCustom.CustomVBoxLayout{FixedWidth: 150})
-
-	// Track the new device ID and slider state we will commit at the end
-	var newDeviceID string
-	newSliderDisabled := false
-	newSliderValue := float64(100)
-
-	//* Create a button for each audio device
-	for _, device := range devices {
-		//* Retrieve device configuration (use defaults if config does not exist)
-		config, exists := settings.DeviceNames[device.Id]
-		if !exists {
-			config = DeviceConfig{Name: device.Name, IsShown: true}
-		}
-
-		//* Skip device if it is marked as hidden
-		if !config.IsShown {
-			continue
-		}
-
-		//* Get a truncated version of the device name for display
-		deviceName := general.EllipticalTruncate(config.Name, 15)
-
-		//* Create the button tap handler for selecting a device
-		onTapped := createDeviceButtonHandler(device.Id)
-
-		//* Add button for the device to newDeviceVbox
-		if device.IsDefault {
-			if device.Name == "Remote Audio" {
-				newDeviceVbox.Add(widget.NewButtonWithIcon(deviceName+" (RDP)", theme.VolumeUpIcon(), func() {
-					fyne.CurrentApp().SendNotification(&fyne.Notification{
-						Title:   "Remote Audio",
-						Content: "Remote Audio device may not support volume/mute control over RDP.",
-					})
-					onTapped()
-				}))
-				volume, err := policyConfig.GetVolume(device.Id)
-				if err == nil {
-					newDeviceID = device.Id
-					newSliderDisabled = false
-					newSliderValue = float64(volume * 100)
-					muted, err := policyConfig.GetMute(device.Id)
-					if err == nil && muted {
-						newSliderValue = 0
-					}
-				} else {
-					newDeviceID = device.Id
-					newSliderDisabled = true
-					newSliderValue = 100
-				}
-			} else {
-				newDeviceVbox.Add(widget.NewButtonWithIcon(deviceName, theme.VolumeUpIcon(), onTapped))
-				volume, err := policyConfig.GetVolume(device.Id)
-				if err != nil {
-					fmt.Printf("Error getting volume for device %s: %v\n", device.Id, err)
-				} else {
-					newDeviceID = device.Id
-					newSliderDisabled = false
-					newSliderValue = float64(volume * 100)
-					muted, err := policyConfig.GetMute(device.Id)
-					if err != nil {
-						fmt.Printf("Error getting mute state for device %s: %v\n", device.Id, err)
-					} else if muted {
-						newSliderValue = 0
-					}
-				}
-			}
-		} else {
-			if device.Name == "Remote Audio" {
-				newDeviceVbox.Add(widget.NewButton(deviceName+" (RDP)", func() {
-					fyne.CurrentApp().SendNotification(&fyne.Notification{
-						Title:   "Remote Audio",
-						Content: "Remote Audio device may not support volume/mute control over RDP.",
-					})
-					onTapped()
-				}))
-				// If Remote Audio was the previously selected device, keep slider disabled
-				if prevDeviceID == device.Id {
-					newSliderDisabled = true
-					newSliderValue = 100
-				}
-			} else {
-				newDeviceVbox.Add(widget.NewButton(deviceName, onTapped))
-			}
-		}
-	}
-
-	//* Commit the new device ID under the lock
-	mu.Lock()
-	currentDeviceID = newDeviceID
-	mu.Unlock()
-
-	//* Apply slider state
-	volumeSlider.Disabled = newSliderDisabled
-	if newSliderDisabled {
-		volumeSlider.Disable()
-	} else {
-		volumeSlider.Enable()
-	}
-	volumeSlider.SetValue(newSliderValue)
-
-	//* Refresh the container only once after adding all buttons
-	newDeviceVbox.Refresh()
-
-	//* Replace the old deviceVbox with the new one
-	deviceVboxPlaceholder.Objects = []fyne.CanvasObject{newDeviceVbox}
-	deviceVboxPlaceholder.Refresh()
-}
-
-// . loadSettings loads application settings from a JSON file, initializing defaults if the file doesn't exist
-func loadSettings() {
-	settingsPath := file.RoamingDir() + "/soundshift/settings.json"
-
-	//* Initialize settings with default values
-	newSettings := AppSettings{
-		HideAfterSelection:     false,
-		RememberScrollPosition: false,
-		HiddenApps:             make(map[string]bool),
-		DeviceNames:            make(map[string]DeviceConfig),
-	}
-
-	//* Attempt to read the settings file from disk
-	fileData, err := os.ReadFile(settingsPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			settings = newSettings
-			saveSettings()
-		}
-		return
-	}
-
-	//* Parse settings from JSON file data
-	json.Unmarshal(fileData, &newSettings)
-
-	//* Ensure DeviceNames map is initialized even if missing from file
-	if newSettings.DeviceNames == nil {
-		newSettings.DeviceNames = make(map[string]DeviceConfig)
-	}
-	if newSettings.HiddenApps == nil {
-		newSettings.HiddenApps = make(map[string]bool)
-	}
-
-	//* Retrieve the list of currently connected audio devices
-	currentDevices, err := mmDeviceEnumerator.GetDevices()
-	if err != nil {
-		fmt.Println("Error getting current devices:", err)
-		general.LogError("Error getting current devices:", err)
-		return
-	}
-
-	//* Track which saved IDs are currently active so name-based ID migration
-	//* never steals the config of a device that is still connected
-	activeIDs := make(map[string]bool, len(currentDevices))
-	for _, device := range currentDevices {
-		activeIDs[device.Id] = true
-	}
-
-	//* Map normalized original names to saved IDs of devices that are NOT
-	//* currently active — these are migration candidates for when Windows
-	//* regenerates an endpoint GUID (e.g. after a GPU/audio driver reinstall)
-	nameToStaleID := make(map[string]string)
-	for id, config := range newSettings.DeviceNames {
-		if key := normalizeDeviceName(config.OriginalName); key != "" && !activeIDs[id] {
-			nameToStaleID[key] = id
-		}
-	}
-
-	//* Merge current devices into the saved settings. Entries for devices that
-	//* are disconnected right now are deliberately preserved, so a hidden
-	//* device stays hidden when it comes back (monitor sleep, unplug, etc.)
-	for _, device := range currentDevices {
-		if _, exists := newSettings.DeviceNames[device.Id]; exists {
-			continue
-		}
-		nameKey := normalizeDeviceName(device.Name)
-		if oldID, found := nameToStaleID[nameKey]; found {
-			config := newSettings.DeviceNames[oldID]
-			config.OriginalName = device.Name
-			newSettings.DeviceNames[device.Id] = config
-			delete(newSettings.DeviceNames, oldID)
-			delete(nameToStaleID, nameKey) // each stale entry migrates at most once
-			general.LogError(fmt.Sprintf("Migrated device ID for %s from %s to %s", device.Name, oldID, device.Id), nil)
-		} else {
-			newSettings.DeviceNames[device.Id] = DeviceConfig{
-				Name:         device.Name,
-				IsShown:      true,
-				OriginalName: device.Name,
-			}
-		}
-	}
-
-	//* Commit the fully built settings atomically
-	settings = newSettings
-}
-
-// . reEnumPrefix matches the "N- " prefix Windows inserts into device names on
-// re-enumeration, e.g. "Speakers (2- USB Audio Device)"
-var reEnumPrefix = regexp.MustCompile(`\(\d+- `)
-
-// . normalizeDeviceName canonicalizes a device friendly name for matching:
-// case-insensitive, whitespace-trimmed, with re-enumeration prefixes removed
-func normalizeDeviceName(name string) string {
-	return strings.ToLower(strings.TrimSpace(reEnumPrefix.ReplaceAllString(name, "(")))
-}
-
-// . saveSettings saves the current settings to a JSON file in the user's roaming directory
-func saveSettings() {
-	fileData, _ := json.MarshalIndent(settings, "", "    ")
-
-	//* Ensure the settings directory exists
-	os.MkdirAll(file.RoamingDir()+"/soundshift", os.ModePerm)
-
-	//* Write the settings file to disk
-	os.WriteFile(file.RoamingDir()+"/soundshift/settings.json", fileData, 0644)
-}
-
-// . genConfigForm generates a configuration form for managing audio device settings and application options
+// . genConfigForm generates a configuration form for managing audio device settings and
+// application options. It is built each time the config window opens.
 func genConfigForm() fyne.CanvasObject {
-	//* Retrieve the current list of audio devices
-	audioDevices, err := mmDeviceEnumerator.GetDevices()
+	//* Retrieve the current list of audio devices, followed by recording devices
+	audioDevices, err := backend.GetDevices()
 	if err != nil || audioDevices == nil {
 		fmt.Println("Error getting audio devices:", err)
 		general.LogError("Error getting audio devices:", err)
 		return nil
 	}
+	audioDevices = append(audioDevices, getCaptureDevices()...)
 
 	//* Initialize a new form for device settings
 	form := &widget.Form{}
-	for _, device := range audioDevices {
+	deviceRows := make([]configDeviceRow, len(audioDevices))
+	for i, device := range audioDevices {
 		//* Retrieve or initialize device configuration
 		config, exists := settings.DeviceNames[device.Id]
 		if !exists {
@@ -1048,9 +703,29 @@ func genConfigForm() fyne.CanvasObject {
 			Checked: config.IsShown,
 		}
 
-		//* Add device entry and visibility checkbox to the form
-		form.Append(device.Name, newNameEntry)
+		//* Create a checkbox to enable/disable the device for every application, not just SoundShift
+		enabledCheckbox := &widget.Check{
+			Text:    "Enabled",
+			Checked: !device.IsDisabled,
+		}
+
+		//* Add device entry and visibility checkboxes to the form
+		label := device.Name
+		if device.IsCapture {
+			label += " (Input)"
+		}
+		if device.IsDisabled {
+			label += " (Disabled)"
+		}
+		form.Append(label, newNameEntry)
 		form.Append("", showHideCheckbox)
+		form.Append("", enabledCheckbox)
+
+		//* Dropdown for the shared-mode default format (sample rate and bit depth)
+		picker := newFormatPicker(device.Id)
+		form.Append("", picker.Select)
+
+		deviceRows[i] = configDeviceRow{device: device, name: newNameEntry, shown: showHideCheckbox, enabled: enabledCheckbox, format: picker}
 	}
 
 	//* Checkbox for hiding the application window after selecting a device
@@ -1059,6 +734,12 @@ func genConfigForm() fyne.CanvasObject {
 		Checked: settings.HideAfterSelection,
 	}
 
+	//* Checkbox for leaving the communications device alone when switching devices
+	keepCommunicationsCheckbox := &widget.Check{
+		Text:    "Keep communication device when switching",
+		Checked: settings.KeepCommunicationsDevice,
+	}
+
 	//* Checkbox for remembering scroll position on show
 	rememberScrollCheckbox := &widget.Check{
 		Text:    "Remember scroll position on show",
@@ -1071,74 +752,118 @@ func genConfigForm() fyne.CanvasObject {
 		Checked: file.Exists(file.RoamingDir() + "/Microsoft/Windows/Start Menu/Programs/Startup/soundshift.lnk"),
 	}
 
-	//* Hidden apps section — gather known app names from current sessions + saved hidden apps
-	knownApps := make(map[string]bool) // lowercase name → true
-	for name := range settings.HiddenApps {
-		knownApps[strings.ToLower(name)] = true
+	//* Foreground-only audio: how far background apps are turned down and which stay audible
+	foregroundCheckbox := &widget.Check{
+		Text:    "Foreground-only audio",
+		Checked: settings.ForegroundMode.Enabled,
+	}
+	attenuationSelect := widget.NewSelect(attenuationLabels, nil)
+	attenuationSelect.SetSelected(attenuationLabel(settings.ForegroundMode.Attenuation))
+	allowlistEntry := widget.NewEntry()
+	allowlistEntry.SetPlaceHolder("Always audible, e.g. Spotify, foobar2000")
+	allowlistEntry.SetText(strings.Join(settings.ForegroundMode.Allowlist, ", "))
+	foregroundRow := container.NewBorder(nil, nil, foregroundCheckbox, nil, attenuationSelect)
+
+	//* Ducking: which apps trigger it, how far the others go down and for how long
+	duckingCheckbox := &widget.Check{
+		Text:    "Duck others while these play:",
+		Checked: settings.Ducking.Enabled,
+	}
+	triggersEntry := widget.NewEntry()
+	triggersEntry.SetPlaceHolder("e.g. Discord, Teams")
+	triggersEntry.SetText(strings.Join(settings.Ducking.Triggers, ", "))
+	var amountLabels, holdLabels []string
+	for _, amount := range duckAmounts {
+		amountLabels = append(amountLabels, duckAmountLabel(amount))
+	}
+	for _, hold := range duckHolds {
+		holdLabels = append(holdLabels, duckHoldLabel(hold))
+	}
+	duckAmountSelect := widget.NewSelect(amountLabels, nil)
+	duckAmountSelect.SetSelected(duckAmountLabel(settings.Ducking.Amount))
+	duckHoldSelect := widget.NewSelect(holdLabels, nil)
+	duckHoldSelect.SetSelected(duckHoldLabel(settings.Ducking.HoldSeconds))
+	duckingRows := container.NewVBox(
+		container.NewBorder(nil, nil, duckingCheckbox, nil, triggersEntry),
+		container.NewGridWithColumns(2, duckAmountSelect, duckHoldSelect),
+	)
+
+	//* Dropdown for how long volume changes, mutes and device switches fade
+	var fadeLabels []string
+	for _, ms := range fadeChoices {
+		fadeLabels = append(fadeLabels, fadeLabel(ms))
 	}
-	if currentSessions, err := policyConfig.GetAudioSessions(); err == nil {
+	fadeSelect := widget.NewSelect(fadeLabels, nil)
+	fadeSelect.SetSelected(fadeLabel(settings.FadeMilliseconds))
+
+	//* Mixer rules section — the names of the current sessions are offered as patterns
+	var appNames []string
+	if currentSessions, err := backend.GetSessions(); err == nil {
 		for _, s := range currentSessions {
-			knownApps[strings.ToLower(s.Name)] = true
-		}
-	}
-	// Build sorted list and checkboxes
-	type hiddenAppEntry struct {
-		name     string
-		checkbox *widget.Check
-	}
-	var hiddenAppEntries []hiddenAppEntry
-	for name := range knownApps {
-		displayName := name
-		// Capitalize first letter for display
-		if len(displayName) > 0 {
-			displayName = strings.ToUpper(displayName[:1]) + displayName[1:]
-		}
-		isHidden := settings.HiddenApps[name]
-		cb := &widget.Check{
-			Text:    displayName,
-			Checked: isHidden,
-		}
-		hiddenAppEntries = append(hiddenAppEntries, hiddenAppEntry{name: name, checkbox: cb})
-	}
-	// Sort alphabetically
-	for i := 0; i < len(hiddenAppEntries); i++ {
-		for j := i + 1; j < len(hiddenAppEntries); j++ {
-			if hiddenAppEntries[i].name > hiddenAppEntries[j].name {
-				hiddenAppEntries[i], hiddenAppEntries[j] = hiddenAppEntries[j], hiddenAppEntries[i]
+			if !slices.Contains(appNames, s.Name) {
+				appNames = append(appNames, s.Name)
 			}
 		}
+		slices.Sort(appNames)
 	}
-	hiddenAppsBox := container.NewVBox()
-	for _, entry := range hiddenAppEntries {
-		hiddenAppsBox.Add(entry.checkbox)
-	}
+	rulesEditor := newMixerRulesEditor(settings.MixerRules, appNames)
+	capsEditor := newVolumeCapsEditor(settings.VolumeCaps, appNames)
+	profilesEditor := newProfilesEditor(settings.Profiles)
 
 	//* Save button to apply and persist settings
 	saveButton := widget.NewButton("     Save     ", func() {
-		for i := 0; i < len(audioDevices); i++ {
+		for _, row := range deviceRows {
 			//* Update settings based on form inputs
-			newNameEntry := form.Items[i*2].Widget.(*widget.Entry)
-			showHideCheckbox := form.Items[i*2+1].Widget.(*widget.Check)
+			row.format.apply()
+			if enabled := row.enabled.Checked; enabled == row.device.IsDisabled {
+				setDeviceEnabled(row.device.Id, enabled)
+			}
 
-			settings.DeviceNames[audioDevices[i].Id] = DeviceConfig{
-				Name:         newNameEntry.Text,
-				IsShown:      showHideCheckbox.Checked,
-				OriginalName: audioDevices[i].Name,
+			settings.DeviceNames[row.device.Id] = DeviceConfig{
+				Name:         row.name.Text,
+				IsShown:      row.shown.Checked,
+				OriginalName: row.device.Name,
 			}
 		}
 
 		//* Apply global settings based on checkbox states
 		settings.HideAfterSelection = hideAfterSelectionCheckbox.Checked
 		settings.RememberScrollPosition = rememberScrollCheckbox.Checked
+		settings.KeepCommunicationsDevice = keepCommunicationsCheckbox.Checked
+		if i := slices.Index(fadeLabels, fadeSelect.Selected); i >= 0 {
+			settings.FadeMilliseconds = fadeChoices[i]
+		}
 
-		//* Update hidden apps from checkboxes
-		newHiddenApps := make(map[string]bool)
-		for _, entry := range hiddenAppEntries {
-			if entry.checkbox.Checked {
-				newHiddenApps[entry.name] = true
-			}
+		//* Update the mixer rules from the editor
+		settings.MixerRules = rulesEditor.rules()
+
+		//* Update foreground-only audio and hand it to its monitor
+		settings.ForegroundMode = ForegroundMode{
+			Enabled:     foregroundCheckbox.Checked,
+			Attenuation: attenuationPercent(attenuationSelect.Selected),
+			Allowlist:   splitList(allowlistEntry.Text),
+		}
+		applyForegroundMode()
+
+		//* Update ducking and hand it to its monitor
+		settings.Ducking.Enabled = duckingCheckbox.Checked
+		settings.Ducking.Triggers = splitList(triggersEntry.Text)
+		if i := slices.Index(amountLabels, duckAmountSelect.Selected); i >= 0 {
+			settings.Ducking.Amount = duckAmounts[i]
 		}
-		settings.HiddenApps = newHiddenApps
+		if i := slices.Index(holdLabels, duckHoldSelect.Selected); i >= 0 {
+			settings.Ducking.HoldSeconds = duckHolds[i]
+		}
+		applyDucking()
+
+		//* Update the volume caps and pull apps above a new cap down
+		settings.VolumeCaps = capsEditor.caps()
+		applyVolumeCaps()
+
+		//* Update the profiles and the flyout and tray menus that offer them
+		settings.Profiles = profilesEditor.profiles
+		renderProfiles()
+		refreshTrayMenu()
 
 		//* Manage application startup with Windows based on checkbox state
 		startupPath := file.RoamingDir() + "/Microsoft/Windows/Start Menu/Programs/Startup/soundshift.lnk"
@@ -1158,10 +883,12 @@ func genConfigForm() fyne.CanvasObject {
 		configWindowOpen.Store(false)
 		configButton.Enable()
 
-		//* Refresh the main UI to reflect updated settings
+		//* Refresh the main UI to reflect updated settings, then pick up any
+		//* device changes that were deferred while the window was open
 		renderButtons()
+		requestDeviceRefresh()
 
-		//* Force-rebuild the mixer so hidden-app changes take effect immediately
+		//* Force-rebuild the mixer so rule changes take effect immediately
 		mixerSessionKeys = nil
 		refreshMixer()
 
@@ -1178,24 +905,27 @@ func genConfigForm() fyne.CanvasObject {
 
 	//* Layout for save button and checkboxes
 	saveButtonContainer := container.New(layout.NewCenterLayout(), saveButton)
-	checkboxAndButtonVBox := container.NewVBox(hideAfterSelectionCheckbox, rememberScrollCheckbox, startWithWindowsCheckbox)
-	if len(hiddenAppEntries) > 0 {
-		hiddenAppsLabel := canvas.NewText("Hide from mixer:", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xb0})
-		hiddenAppsLabel.TextSize = 12
-		checkboxAndButtonVBox.Add(widget.NewSeparator())
-		checkboxAndButtonVBox.Add(hiddenAppsLabel)
-
-		//* Cap the app list height; anything beyond scrolls. The label stays
-		//* fixed above the scroll region.
-		const maxHiddenAppsHeight float32 = 160
-		appsScroll := container.NewVScroll(hiddenAppsBox)
-		appsSize := hiddenAppsBox.MinSize()
-		if appsSize.Height > maxHiddenAppsHeight {
-			appsSize.Height = maxHiddenAppsHeight
-		}
-		appsScroll.SetMinSize(appsSize)
-		checkboxAndButtonVBox.Add(appsScroll)
-	}
+	checkboxAndButtonVBox := container.NewVBox(hideAfterSelectionCheckbox, keepCommunicationsCheckbox, rememberScrollCheckbox, startWithWindowsCheckbox, fadeSelect, foregroundRow, allowlistEntry, duckingRows)
+	rulesLabel := canvas.NewText("Mixer rules (last match wins):", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xb0})
+	rulesLabel.TextSize = 12
+	checkboxAndButtonVBox.Add(widget.NewSeparator())
+	checkboxAndButtonVBox.Add(rulesLabel)
+
+	//* The rule and cap lists get a fixed height so added rows scroll instead of
+	//* growing the window. The label stays fixed above the scroll region.
+	const rulesHeight float32 = 160
+	capsLabel := canvas.NewText("Volume caps (lowest match wins):", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xb0})
+	capsLabel.TextSize = 12
+	profilesLabel := canvas.NewText("Profiles:", color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xb0})
+	profilesLabel.TextSize = 12
+	editors := container.NewVBox(
+		rulesEditor.Container,
+		widget.NewSeparator(), capsLabel, capsEditor.Container,
+		widget.NewSeparator(), profilesLabel, profilesEditor.Container,
+	)
+	rulesScroll := container.NewVScroll(editors)
+	rulesScroll.SetMinSize(fyne.NewSize(editors.MinSize().Width, rulesHeight))
+	checkboxAndButtonVBox.Add(rulesScroll)
 	checkboxAndButtonVBox.Add(saveButtonContainer)
 	centeredCheckboxAndButtonContainer := container.New(layout.NewCenterLayout(), checkboxAndButtonVBox)
 
@@ -1223,6 +953,17 @@ func initTray() {
 		toggleWindow()
 	})
 
+	buildTrayMenu()
+}
+
+// . refreshTrayMenu rebuilds the tray menu after the profiles changed
+func refreshTrayMenu() {
+	systray.ResetMenu()
+	buildTrayMenu()
+}
+
+// . buildTrayMenu adds the items of the tray icon's right-click menu
+func buildTrayMenu() {
 	//* Create menu items for right-click context menu
 	mToggle := systray.AddMenuItem("Show / Hide", "Toggle window")
 	mToggle.Click(func() {
@@ -1230,6 +971,33 @@ func initTray() {
 		toggleWindow()
 	})
 
+	//* Toggle foreground-only audio without opening the config window
+	mForeground := systray.AddMenuItemCheckbox("Foreground-only audio", "Turn down apps that are not in the foreground", settings.ForegroundMode.Enabled)
+	mForeground.Click(func() {
+		fyne.Do(func() {
+			settings.ForegroundMode.Enabled = !settings.ForegroundMode.Enabled
+			saveSettings()
+			applyForegroundMode()
+			if settings.ForegroundMode.Enabled {
+				mForeground.Check()
+			} else {
+				mForeground.Uncheck()
+			}
+		})
+	})
+
+	//* Apply a profile without opening the window
+	if len(settings.Profiles) > 0 {
+		mProfiles := systray.AddMenuItem("Profiles", "Apply a saved audio setup")
+		for _, p := range settings.Profiles {
+			name := p.Name
+			mProfiles.AddSubMenuItem(name, "Apply the "+name+" profile").Click(func() {
+				general.LogError("TRAY_PROFILE_CLICKED", nil)
+				fyne.Do(func() { applyProfileNamed(name) })
+			})
+		}
+	}
+
 	//* Add a "Quit" option to the tray menu to allow the user to exit the application
 	mQuit := systray.AddMenuItem("Exit", "Completely exit SoundShift")
 	mQuit.Enable()
@@ -1301,215 +1069,22 @@ func isMouseInTaskbar() bool {
 	return mx < workArea.Left || mx >= workArea.Right || my < workArea.Top || my >= workArea.Bottom
 }
 
-// . audioDevicesEqual performs a fast comparison of AudioDevice slices without reflection
-func audioDevicesEqual(a, b []mmDeviceEnumerator.AudioDevice) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i].Name != b[i].Name ||
-			a[i].Id != b[i].Id ||
-			a[i].IsDefault != b[i].IsDefault {
-			return false
-		}
-	}
-	return true
-}
-
-func monitorDeviceChanges() {
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-
-	var lastVolume float32 = -1
-	var lastMuted bool = false
-	var lastDeviceID string = ""
-	var isRemoteAudioInaccessible bool = false
-
-	for {
-		<-ticker.C
-
-		// Skip monitoring if window is not visible
-		if !winapi.IsWindowVisible(hwnd) {
-			continue
-		}
-
-		// Read shared state under lock
-		mu.Lock()
-		devID := currentDeviceID
-		devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
-		copy(devices, audioDevices)
-		mu.Unlock()
-
-		if devID == "" {
-			continue
-		}
-
-		// Reset cache if device changed
-		if devID != lastDeviceID {
-			lastVolume = -1
-			lastMuted = false
-			lastDeviceID = devID
-			isRemoteAudioInaccessible = false
-		}
-
-		// Validate that the current device still exists in the device list
-		deviceExists := false
-		var currentDevice mmDeviceEnumerator.AudioDevice
-		for _, device := range devices {
-			if device.Id == devID {
-				deviceExists = true
-				currentDevice = device
-				break
-			}
-		}
-
-		// If device no longer exists, reset currentDeviceID and skip monitoring
-		if !deviceExists {
-			fmt.Printf("Device %s no longer exists, resetting current device\n", devID)
-			mu.Lock()
-			if currentDeviceID == devID {
-				currentDeviceID = ""
-			}
-			mu.Unlock()
-			lastDeviceID = ""
-			continue
-		}
-
-		// Skip volume/mute polling for inaccessible Remote Audio devices
-		if currentDevice.Name == "Remote Audio" && !isRemoteAudioInaccessible {
-			_, err := policyConfig.GetVolume(devID)
-			if err != nil {
-				isRemoteAudioInaccessible = true
-				fyne.Do(func() {
-					volumeSlider.Disabled = true
-					volumeSlider.Disable()
-					volumeSlider.SetValue(100)
-				})
-				continue
-			}
-		}
-
-		if currentDevice.Name == "Remote Audio" && isRemoteAudioInaccessible {
-			continue
-		}
-
-		// Retrieve current volume and mute state
-		volume, err := policyConfig.GetVolume(devID)
-		if err != nil {
-			if currentDevice.Name == "Remote Audio" {
-				isRemoteAudioInaccessible = true
-				fyne.Do(func() {
-					volumeSlider.Disabled = true
-					volumeSlider.Disable()
-					volumeSlider.SetValue(100)
-				})
-				continue
-			}
-			fmt.Printf("Error getting volume for device %s: %v\n", devID, err)
-			mu.Lock()
-			if currentDeviceID == devID {
-				currentDeviceID = ""
-			}
-			mu.Unlock()
-			lastDeviceID = ""
-			continue
-		}
-
-		muted, err := policyConfig.GetMute(devID)
-		if err != nil {
-			if currentDevice.Name == "Remote Audio" {
-				isRemoteAudioInaccessible = true
-				fyne.Do(func() {
-					volumeSlider.Disabled = true
-					volumeSlider.Disable()
-					volumeSlider.SetValue(100)
-				})
-				continue
-			}
-			fmt.Printf("Error getting mute state for device %s: %v\n", devID, err)
-			mu.Lock()
-			if currentDeviceID == devID {
-				currentDeviceID = ""
-			}
-			mu.Unlock()
-			lastDeviceID = ""
-			continue
-		}
-
-		// Only update UI if values have actually changed
-		if volume != lastVolume || muted != lastMuted {
-			lastVolume = volume
-			lastMuted = muted
-
-			fyne.Do(func() {
-				// Skip external updates while the user is dragging the slider so the
-				// ticker cannot snap the thumb back mid-drag (which caused the visible
-				// "back and forth" oscillation).
-				if volumeSlider.IsDragging() {
-					return
-				}
-				if muted {
-					volumeSlider.SetValue(0)
-				} else {
-					volumeSlider.SetValue(float64(volume * 100))
-				}
-			})
-		}
-	}
-}
-
-// . createDeviceButtonHandler creates a button tap handler for device selection
-func createDeviceButtonHandler(deviceID string) func() {
-	return func() {
-		if err := policyConfig.SetDefaultEndPoint(deviceID); err != nil {
-			fmt.Println("Error setting default endpoint:", err)
-			general.LogError("Error setting default endpoint:", err)
-			return
-		}
-
-		// Optimistically update IsDefault flags for immediate visual feedback
-		mu.Lock()
-		for i := range audioDevices {
-			audioDevices[i].IsDefault = (audioDevices[i].Id == deviceID)
-		}
-		mu.Unlock()
-		renderButtons()
-
-		// After OS has had time to settle, confirm with a fresh device list
-		go func() {
-			time.Sleep(200 * time.Millisecond)
-			newDevices, err := mmDeviceEnumerator.GetDevices()
-			if err == nil && newDevices != nil {
-				valid := filterValidDevices(newDevices)
-				mu.Lock()
-				audioDevices = valid
-				mu.Unlock()
-				fyne.Do(func() {
-					renderButtons()
-				})
-			}
-			if settings.HideAfterSelection {
-				hideMainWindow()
-			}
-		}()
-	}
-}
-
 // ---------------------------------------------------------------------------
 // Icon extraction from executables (Windows shell32 / gdi32)
 // ---------------------------------------------------------------------------
 
 var (
-	shell32DLL         = windows.NewLazySystemDLL("shell32.dll")
-	gdi32DLL           = windows.NewLazySystemDLL("gdi32.dll")
-	procExtractIconExW = shell32DLL.NewProc("ExtractIconExW")
-	procDestroyIcon    = windows.NewLazySystemDLL("user32.dll").NewProc("DestroyIcon")
-	procGetIconInfo    = windows.NewLazySystemDLL("user32.dll").NewProc("GetIconInfo")
-	procGetDIBits      = gdi32DLL.NewProc("GetDIBits")
-	procCreateCompatDC = gdi32DLL.NewProc("CreateCompatibleDC")
-	procDeleteDC       = gdi32DLL.NewProc("DeleteDC")
-	procDeleteObject   = gdi32DLL.NewProc("DeleteObject")
-	procGetObjectW     = gdi32DLL.NewProc("GetObjectW")
+	shell32DLL                  = windows.NewLazySystemDLL("shell32.dll")
+	gdi32DLL                    = windows.NewLazySystemDLL("gdi32.dll")
+	procExtractIconExW          = shell32DLL.NewProc("ExtractIconExW")
+	procSHCreateItemFromParsing = shell32DLL.NewProc("SHCreateItemFromParsingName")
+	procDestroyIcon             = windows.NewLazySystemDLL("user32.dll").NewProc("DestroyIcon")
+	procGetIconInfo             = windows.NewLazySystemDLL("user32.dll").NewProc("GetIconInfo")
+	procGetDIBits               = gdi32DLL.NewProc("GetDIBits")
+	procCreateCompatDC          = gdi32DLL.NewProc("CreateCompatibleDC")
+	procDeleteDC                = gdi32DLL.NewProc("DeleteDC")
+	procDeleteObject            = gdi32DLL.NewProc("DeleteObject")
+	procGetObjectW              = gdi32DLL.NewProc("GetObjectW")
 )
 
 type bitmapStruct struct {
@@ -1561,21 +1136,99 @@ func extractAppIcon(exePath string) fyne.Resource {
 		return cached.(fyne.Resource)
 	}
 
-	res := doExtractIcon(exePath)
+	res := doExtractIcon(exePath, 0)
 	iconCache.Store(exePath, res)
 	return res
 }
 
-func doExtractIcon(exePath string) fyne.Resource {
-	pathPtr, err := syscall.UTF16PtrFromString(exePath)
+// extractSessionIcon returns the icon of a mixer session: the icon the session set for
+// itself or the logo of its packaged app, falling back to the executable's first icon.
+func extractSessionIcon(iconPath, exePath string) fyne.Resource {
+	if iconPath == "" {
+		return extractAppIcon(exePath)
+	}
+
+	cached, ok := iconCache.Load(iconPath)
+	if !ok {
+		var res fyne.Resource
+		if strings.HasPrefix(iconPath, policyConfig.PackagedAppIconPrefix) {
+			res = shellItemIcon(iconPath)
+		} else {
+			path, index := parseIconLocation(iconPath)
+			res = doExtractIcon(path, index)
+		}
+		iconCache.Store(iconPath, res)
+		cached = res
+	}
+	if cached == nil {
+		return extractAppIcon(exePath)
+	}
+	return cached.(fyne.Resource)
+}
+
+// shellItemImageFactory is the shell's IShellItemImageFactory; it renders the logo of
+// an item such as a packaged app in the AppsFolder
+type shellItemImageFactory struct {
+	ole.IUnknown
+}
+
+type shellItemImageFactoryVtbl struct {
+	ole.IUnknownVtbl
+	GetImage uintptr
+}
+
+// shellItemIcon renders the icon of a shell item, given its parsing name, as a
+// fyne.Resource (PNG). Returns nil on failure.
+func shellItemIcon(parsingName string) fyne.Resource {
+	pathPtr, err := syscall.UTF16PtrFromString(parsingName)
 	if err != nil {
 		return nil
 	}
 
+	iid := ole.NewGUID("BCC18B79-BA16-442F-80C4-8A59C30C463B")
+	var factory *shellItemImageFactory
+	hr, _, _ := procSHCreateItemFromParsing.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		0,
+		uintptr(unsafe.Pointer(iid)),
+		uintptr(unsafe.Pointer(&factory)),
+	)
+	if hr != 0 || factory == nil {
+		return nil
+	}
+	defer factory.Release()
+
+	// GetImage takes its SIZE by value, which fits a single 64-bit argument.
+	var side uintptr = 32
+	const siigbfIconOnly = 0x4
+	var hbm uintptr
+	vtbl := (*shellItemImageFactoryVtbl)(unsafe.Pointer(factory.RawVTable))
+	hr, _, _ = syscall.SyscallN(
+		vtbl.GetImage,
+		uintptr(unsafe.Pointer(factory)),
+		side|side<<32,
+		siigbfIconOnly,
+		uintptr(unsafe.Pointer(&hbm)),
+	)
+	if hr != 0 || hbm == 0 {
+		return nil
+	}
+	defer procDeleteObject.Call(hbm)
+
+	return bitmapResource(parsingName, hbm)
+}
+
+func doExtractIcon(path string, index int) fyne.Resource {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil
+	}
+
+	// A negative index selects the icon by resource ID, as icon locations do.
 	var hIconLarge uintptr
 	ret, _, _ := procExtractIconExW.Call(
 		uintptr(unsafe.Pointer(pathPtr)),
-		0,
+		uintptr(index),
 		uintptr(unsafe.Pointer(&hIconLarge)),
 		0, // no small icon
 		1,
@@ -1599,9 +1252,15 @@ func doExtractIcon(exePath string) fyne.Resource {
 	}
 	defer procDeleteObject.Call(ii.HbmColor)
 
+	return bitmapResource(path, ii.HbmColor)
+}
+
+// bitmapResource converts a 32-bit bitmap to a fyne.Resource (PNG) named name.
+// Returns nil on failure.
+func bitmapResource(name string, hbm uintptr) fyne.Resource {
 	// Get bitmap dimensions.
 	var bm bitmapStruct
-	procGetObjectW.Call(ii.HbmColor, unsafe.Sizeof(bm), uintptr(unsafe.Pointer(&bm)))
+	procGetObjectW.Call(hbm, unsafe.Sizeof(bm), uintptr(unsafe.Pointer(&bm)))
 	if bm.BmWidth == 0 || bm.BmHeight == 0 {
 		return nil
 	}
@@ -1627,7 +1286,7 @@ func doExtractIcon(exePath string) fyne.Resource {
 
 	procGetDIBits.Call(
 		hdc,
-		ii.HbmColor,
+		hbm,
 		0,
 		uintptr(h),
 		uintptr(unsafe.Pointer(&pixels[0])),
@@ -1654,259 +1313,5 @@ func doExtractIcon(exePath string) fyne.Resource {
 		return nil
 	}
 
-	return fyne.NewStaticResource(exePath, buf.Bytes())
-}
-
-// . refreshMixer fetches current audio sessions and rebuilds the mixer UI.
-// Must be called on the Fyne goroutine.
-func refreshMixer() {
-	sessions, err := policyConfig.GetAudioSessions()
-	if err != nil {
-		mixerSection.Objects = nil
-		mixerSection.Refresh()
-		return
-	}
-	refreshMixerWithSessions(sessions)
-}
-
-// . refreshMixerWithSessions rebuilds the per-app volume mixer UI from the
-// supplied session slice. Must be called on the Fyne goroutine.
-func refreshMixerWithSessions(sessions []policyConfig.AudioSession) {
-	if len(sessions) == 0 {
-		mixerSection.Objects = nil
-		mixerSection.Refresh()
-		return
-	}
-
-	// Filter out apps the user has hidden via settings.
-	if len(settings.HiddenApps) > 0 {
-		filtered := make([]policyConfig.AudioSession, 0, len(sessions))
-		for _, s := range sessions {
-			key := strings.ToLower(s.Name)
-			if !settings.HiddenApps[key] {
-				filtered = append(filtered, s)
-			}
-		}
-		sessions = filtered
-	}
-
-	if len(sessions) == 0 {
-		mixerSection.Objects = nil
-		mixerSection.Refresh()
-		return
-	}
-
-	// Build a key→session map for the new snapshot.
-	type sessionKey = struct {
-		pid   uint32
-		name  string
-		isSys bool
-	}
-	newKeys := make([]sessionKey, len(sessions))
-	for i, s := range sessions {
-		newKeys[i] = sessionKey{pid: s.PID, name: s.Name, isSys: s.IsSystem}
-	}
-
-	// Check if the set of sessions changed compared to last time.
-	sessionsChanged := len(newKeys) != len(mixerSessionKeys)
-	if !sessionsChanged {
-		for i := range newKeys {
-			if newKeys[i] != mixerSessionKeys[i] {
-				sessionsChanged = true
-				break
-			}
-		}
-	}
-
-	if sessionsChanged {
-		// Rebuild the entire mixer UI.
-		mixerSessionKeys = newKeys
-		mixerSliders = make([]*fyneCustom.ScrollableSlider, len(sessions))
-		mixerMuteButtons = make([]*fyneCustom.IconButton, len(sessions))
-		mixerMuted = make([]bool, len(sessions))
-		mixerMuteTapped = make([]time.Time, len(sessions))
-
-		newMixer := container.NewVBox()
-
-		for i, sess := range sessions {
-			sessPID := sess.PID
-			sessIsSys := sess.IsSystem
-			sessI := i
-			displayName := general.EllipticalTruncate(sess.Name, 24)
-
-			// --- App icon ---
-			var appIcon *canvas.Image
-			if iconRes := extractAppIcon(sess.ExePath); iconRes != nil {
-				appIcon = canvas.NewImageFromResource(iconRes)
-			} else {
-				// Fallback: use a generic speaker icon for system sounds or unknown apps
-				appIcon = canvas.NewImageFromResource(theme.VolumeUpIcon())
-			}
-			appIcon.FillMode = canvas.ImageFillContain
-			appIcon.SetMinSize(fyne.NewSize(16, 16))
-
-			// --- Name label ---
-			label := canvas.NewText(displayName, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xd0})
-			label.TextSize = 11
-
-			// --- Mute button ---
-			muted := sess.Muted
-			mixerMuted[i] = muted
-			muteBtn := fyneCustom.NewIconButton(theme.VolumeMuteIcon(), nil)
-			muteBtn.SetActive(muted)
-			muteBtn.OnTapped = func() {
-				newMuted := !mixerMuted[sessI]
-				// Optimistic UI update — instant feedback before COM call completes
-				mixerMuted[sessI] = newMuted
-				mixerMuteTapped[sessI] = time.Now()
-				muteBtn.SetActive(newMuted)
-				go func() {
-					if err := policyConfig.SetSessionMuteByPID(sessPID, sessIsSys, newMuted); err != nil {
-						general.LogError("Error setting session mute", err)
-					}
-				}()
-			}
-			mixerMuteButtons[i] = muteBtn
-
-			// --- Slider — always show the real underlying volume, mute is handled separately ---
-			slider := fyneCustom.NewScrollableSlider(0, 100)
-			slider.SetValue(float64(sess.Volume * 100))
-
-			slider.OnChanged = func(f float64) {
-				level := float32(f / 100.0)
-				go func() {
-					if err := policyConfig.SetSessionVolumeByPID(sessPID, sessIsSys, level); err != nil {
-						general.LogError("Error setting session volume", err)
-					}
-				}()
-			}
-
-			mixerSliders[i] = slider
-
-			// Layout: top row = [icon] name ... [muteBtn]
-			//         bottom  = slider (full width)
-			iconContainer := container.NewCenter(appIcon)
-			topRow := container.NewBorder(nil, nil,
-				container.NewHBox(iconContainer, label),
-				muteBtn,
-			)
-			entry := container.NewVBox(topRow, slider)
-			newMixer.Add(entry)
-		}
-
-		mixerSection.Objects = []fyne.CanvasObject{newMixer}
-		mixerSection.Refresh()
-
-		// No reposition passes needed here: the window is sized from topSection
-		// only (the mixer lives below it behind the scroll), so mixer content
-		// changes never alter the target window size. The old delayed passes
-		// caused visible repositioning after show and fought the slide-in
-		// animation.
-	} else {
-		// Sessions haven't changed — just update slider values and mute state in-place.
-		for i, sess := range sessions {
-			if i >= len(mixerSliders) || mixerSliders[i] == nil {
-				continue
-			}
-			// Sync mute button active state if changed externally, but do not override
-			// a recent user tap that is still being processed.
-			if i < len(mixerMuted) && i < len(mixerMuteButtons) && mixerMuteButtons[i] != nil {
-				if sess.Muted != mixerMuted[i] {
-					if time.Since(mixerMuteTapped[i]) > 1500*time.Millisecond {
-						mixerMuted[i] = sess.Muted
-						mixerMuteButtons[i].SetActive(sess.Muted)
-					}
-				}
-			}
-			// Don't override the slider while the user is dragging it.
-			if mixerSliders[i].IsDragging() {
-				continue
-			}
-			// Always track the real underlying volume; mute state is shown separately.
-			target := float64(sess.Volume * 100)
-			if mixerSliders[i].Value != target {
-				mixerSliders[i].SetValue(target)
-			}
-		}
-	}
-}
-
-// mixer state tracking for in-place updates
-type mixerKey struct {
-	pid   uint32
-	name  string
-	isSys bool
-}
-
-var mixerSessionKeys []struct {
-	pid   uint32
-	name  string
-	isSys bool
-}
-var mixerSliders []*fyneCustom.ScrollableSlider
-var mixerMuteButtons []*fyneCustom.IconButton
-var mixerMuted []bool
-var mixerMuteTapped []time.Time
-
-// cachedSessions holds the latest session snapshot from background polling.
-var (
-	cachedSessions   []policyConfig.AudioSession
-	cachedSessionsMu sync.Mutex
-	sessionsDirty    atomic.Bool
-)
-
-// . monitorMixer periodically polls audio sessions and dispatches UI updates.
-// COM enumeration runs on this dedicated OS thread (not on Fyne's thread) for
-// reliability. Uses adaptive intervals: 500ms when visible, 2s when hidden.
-func monitorMixer() {
-	// Lock this goroutine to a single OS thread and initialise COM on it.
-	// Without this, Go's scheduler can migrate the goroutine mid-COM-call,
-	// causing silent failures or stale data.
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
-	ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
-	defer ole.CoUninitialize()
-
-	const visibleInterval = 500 * time.Millisecond
-	const hiddenInterval = 2 * time.Second
-
-	ticker := time.NewTicker(hiddenInterval)
-	defer ticker.Stop()
-	currentInterval := hiddenInterval
-
-	for range ticker.C {
-		visible := winapi.IsWindowVisible(hwnd)
-
-		// Adjust tick rate based on window visibility.
-		desired := hiddenInterval
-		if visible {
-			desired = visibleInterval
-		}
-		if desired != currentInterval {
-			ticker.Reset(desired)
-			currentInterval = desired
-		}
-
-		// Fetch sessions on this goroutine (off the Fyne UI thread).
-		sessions, err := policyConfig.GetAudioSessions()
-		if err != nil {
-			continue
-		}
-
-		// Cache the latest snapshot so showMainWindow can use it immediately.
-		cachedSessionsMu.Lock()
-		cachedSessions = sessions
-		cachedSessionsMu.Unlock()
-
-		if visible {
-			sessionsDirty.Store(false)
-			sessCopy := sessions // capture for closure
-			fyne.Do(func() {
-				refreshMixerWithSessions(sessCopy)
-			})
-		} else {
-			// Mark dirty so the next window-show picks up changes instantly.
-			sessionsDirty.Store(true)
-		}
-	}
+	return fyne.NewStaticResource(name, buf.Bytes())
 }
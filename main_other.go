@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"soundshift/interfaces/audioBackend"
+
+	"fyne.io/fyne/v2"
+)
+
+// . The flyout window, tray icon and icon extraction are Windows-only for now. These
+// stand-ins let the platform-neutral device, settings and mixer code build (and be
+// tested) elsewhere. No backend is set up, since main exits below; the tests install one.
+var backend audioBackend.AudioBackend
+
+func isMainWindowVisible() bool { return false }
+
+func hideMainWindow() {}
+
+func resizeOnUI() {}
+
+func refreshTrayMenu() {}
+
+func foregroundApp() (pid uint32, exePath string) { return 0, "" }
+
+func extractSessionIcon(iconPath, exePath string) fyne.Resource { return nil }
+
+func main() {
+	fmt.Println("SoundShift currently only runs on Windows")
+	os.Exit(1)
+}
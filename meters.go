@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"soundshift/fyneCustom"
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// . Peak meter timing: levels are sampled only while the flyout is visible, and a
+// dropping level falls off gradually instead of flickering between samples
+const (
+	meterInterval = 50 * time.Millisecond
+	meterDecay    = 0.8 // share of the shown level kept per sample while the signal drops
+)
+
+// . masterMeter shows the current device's level under the master volume slider
+var masterMeter = fyneCustom.NewLevelMeter()
+
+// . windowShown is signalled by showMainWindow so monitorMeters can resume sampling
+var windowShown = make(chan struct{}, 1)
+
+// . monitorMeters samples device and session peak levels while the window is visible and
+// sleeps until the next show while it is hidden. It stops for good if the backend cannot meter.
+func monitorMeters() {
+	// Sampling happens on a dedicated backend thread, like monitorMixer.
+	defer backend.BindThread()()
+
+	for {
+		if !isMainWindowVisible() {
+			fyne.Do(resetMeters)
+			<-windowShown
+			continue
+		}
+		if err := sampleMeters(); errors.Is(err, errors.ErrUnsupported) {
+			general.LogError("Peak meters unavailable", err)
+			return
+		}
+		time.Sleep(meterInterval)
+	}
+}
+
+// . sampleMeters reads the current device's peak and every session's peak and pushes
+// them to the meters. Devices or sessions that cannot be read show silence.
+func sampleMeters() error {
+	mu.Lock()
+	devID := currentDeviceID
+	mu.Unlock()
+
+	var master float32
+	if devID != "" {
+		peak, err := backend.GetPeak(devID)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+		master = peak
+	}
+
+	peaks, err := backend.GetSessionPeaks()
+	if errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+
+	fyne.Do(func() { applyMeterLevels(master, peaks) })
+	return nil
+}
+
+// . applyMeterLevels updates the master meter and the meter of every mixer row. An
+// application row shows its loudest session. Must be called on the Fyne goroutine.
+func applyMeterLevels(master float32, peaks []policyConfig.SessionPeak) {
+	masterMeter.SetLevel(max(master, masterMeter.Level*meterDecay))
+
+	byID := make(map[string]float32, len(peaks))
+	for _, p := range peaks {
+		byID[p.ID] = p.Peak
+	}
+	for i, ids := range mixerRowIDs {
+		if i >= len(mixerMeters) || mixerMeters[i] == nil {
+			continue
+		}
+		var level float32
+		for _, id := range ids {
+			level = max(level, byID[id])
+		}
+		mixerMeters[i].SetLevel(max(level, mixerMeters[i].Level*meterDecay))
+	}
+}
+
+// . resetMeters empties every meter so the next show does not start from stale levels.
+// Must be called on the Fyne goroutine.
+func resetMeters() {
+	masterMeter.SetLevel(0)
+	for _, m := range mixerMeters {
+		if m != nil {
+			m.SetLevel(0)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+func TestSampleMetersFeedsMasterAndMixerMeters(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "ff", Name: "Firefox", PID: 10, Volume: 1},
+		policyConfig.AudioSession{ID: "sys", Name: "System Sounds", IsSystem: true, Volume: 1},
+	)
+	checkAndUpdateDevices()
+	refreshMixer()
+	resetMeters()
+
+	fake.SetPeak("spk", 0.5)
+	fake.SetSessionPeak("ff", 0.75)
+	if err := sampleMeters(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the meters to show the sampled levels", func() bool {
+		return masterMeter.Level == 0.5 && mixerMeters[0].Level == 0.75 && mixerMeters[1].Level == 0
+	})
+}
+
+func TestMetersFallOffGradually(t *testing.T) {
+	useFakeBackend(t)
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 1}})
+	resetMeters()
+
+	applyMeterLevels(1, []policyConfig.SessionPeak{{ID: "ff", Peak: 1}})
+	applyMeterLevels(0, nil)
+	if masterMeter.Level != meterDecay || mixerMeters[0].Level != meterDecay {
+		t.Errorf("levels after silence = %v/%v, want both decayed to %v", masterMeter.Level, mixerMeters[0].Level, meterDecay)
+	}
+
+	resetMeters()
+	if masterMeter.Level != 0 || mixerMeters[0].Level != 0 {
+		t.Error("resetMeters should empty every meter")
+	}
+}
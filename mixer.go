@@ -0,0 +1,603 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"regexp"
+	"slices"
+	"soundshift/fyneCustom"
+	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . refreshMixer fetches current audio sessions and rebuilds the mixer UI.
+// Must be called on the Fyne goroutine.
+func refreshMixer() {
+	sessions, err := backend.GetSessions()
+	if err != nil {
+		mixerSection.Objects = nil
+		mixerSection.Refresh()
+		return
+	}
+	refreshMixerWithSessions(sessions)
+}
+
+// . refreshMixerWithSessions rebuilds the per-app volume mixer UI from the
+// supplied session slice. Sessions of the same application share one row.
+// Must be called on the Fyne goroutine.
+func refreshMixerWithSessions(sessions []policyConfig.AudioSession) {
+	mixerLastSessions = sessions
+	if len(sessions) == 0 {
+		mixerSection.Objects = nil
+		mixerSection.Refresh()
+		return
+	}
+
+	// Filter out apps the user's mixer rules hide.
+	sessions = filterSessions(settings.MixerRules, sessions)
+
+	if len(sessions) == 0 {
+		mixerSection.Objects = nil
+		mixerSection.Refresh()
+		return
+	}
+
+	deviceOrder, deviceNames := mixerDevices()
+	rows := buildMixerRows(sessions, deviceOrder)
+
+	// Label the rows of each device once the mixer spans more than one.
+	multiDevice := false
+	for _, row := range rows {
+		if row.key.device != rows[0].key.device {
+			multiDevice = true
+			break
+		}
+	}
+
+	// Check if the rows or the sessions behind them changed compared to last time.
+	rowsChanged := len(rows) != len(mixerSessionKeys)
+	if !rowsChanged {
+		for i := range rows {
+			if rows[i].key != mixerSessionKeys[i] || !slices.Equal(rows[i].ids, mixerRowIDs[i]) {
+				rowsChanged = true
+				break
+			}
+		}
+	}
+
+	if rowsChanged {
+		// Rebuild the entire mixer UI.
+		mixerSessionKeys = make([]mixerKey, len(rows))
+		mixerRowIDs = make([][]string, len(rows))
+		mixerSliders = make([]*fyneCustom.ScrollableSlider, len(rows))
+		mixerMuteButtons = make([]*fyneCustom.IconButton, len(rows))
+		mixerSoloButtons = make([]*fyneCustom.IconButton, len(rows))
+		mixerMeters = make([]*fyneCustom.LevelMeter, len(rows))
+		mixerMuted = make([]bool, len(rows))
+		mixerMuteTapped = make([]time.Time, len(rows))
+
+		newMixer := container.NewVBox()
+
+		for i, row := range rows {
+			if multiDevice && (i == 0 || row.key.device != rows[i-1].key.device) {
+				newMixer.Add(mixerDeviceHeader(row.key.device, deviceNames))
+			}
+
+			mixerSessionKeys[i] = row.key
+			mixerRowIDs[i] = row.ids
+			rowIDs := row.ids
+			rowI := i
+			displayName := general.EllipticalTruncate(row.name, 24)
+
+			// --- App icon ---
+			var appIcon *canvas.Image
+			if iconRes := extractSessionIcon(row.icon, row.exePath); iconRes != nil {
+				appIcon = canvas.NewImageFromResource(iconRes)
+			} else {
+				// Fallback: use a generic speaker icon for system sounds or unknown apps
+				appIcon = canvas.NewImageFromResource(theme.VolumeUpIcon())
+			}
+			appIcon.FillMode = canvas.ImageFillContain
+			appIcon.SetMinSize(fyne.NewSize(16, 16))
+
+			// --- Name label ---
+			label := canvas.NewText(displayName, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xd0})
+			label.TextSize = 11
+
+			// --- Mute button ---
+			// Volume and mute set here are remembered per executable; system sounds have none.
+			rowExe := row.exePath
+			if row.isSys {
+				rowExe = ""
+			}
+			muted := row.muted
+			mixerMuted[i] = muted
+			muteBtn := fyneCustom.NewIconButton(theme.VolumeMuteIcon(), nil)
+			muteBtn.SetActive(muted)
+			muteBtn.OnTapped = func() {
+				newMuted := !mixerMuted[rowI]
+				// Optimistic UI update — instant feedback before COM call completes
+				mixerMuted[rowI] = newMuted
+				mixerMuteTapped[rowI] = time.Now()
+				muteBtn.SetActive(newMuted)
+				rowLevel, d := float32(mixerSliders[rowI].Value/100), fadeDuration()
+				rememberAppVolume(rowExe, rowLevel, newMuted)
+				go func() {
+					for _, id := range rowIDs {
+						setBackgroundMute(id, newMuted)
+						fadeMute(audioBackend.Session(id), newMuted, cachedSessionVolume(id, rowLevel), d, func(muted bool) error {
+							return backend.SetSessionMute(id, muted)
+						}, func(err error) {
+							general.LogError("Error setting session mute", err)
+						})
+					}
+				}()
+			}
+			mixerMuteButtons[i] = muteBtn
+
+			// --- Solo button: mutes every other session until it is released ---
+			// Soloing an application also covers the sessions it opens later; soloing one
+			// session of an expanded application does not.
+			soloExe := rowExe
+			if row.child {
+				soloExe = ""
+			}
+			soloBtn := fyneCustom.NewIconButton(fyneCustom.SoloIcon(), nil)
+			soloBtn.SetActive(soloedRow(rowIDs))
+			soloBtn.OnTapped = func() {
+				soloBtn.SetActive(!soloBtn.Active)
+				toggleSolo(rowIDs, soloExe)
+			}
+			mixerSoloButtons[i] = soloBtn
+
+			// --- Slider — always show the real underlying volume, mute is handled separately ---
+			slider := fyneCustom.NewScrollableSlider(0, 100)
+			slider.SetValue(float64(row.volume * 100))
+
+			// The slider cannot go past the app's volume cap, which it marks on its track.
+			var rowCap float32 = 1
+			if !row.isSys {
+				rowCap, _ = volumeCap(settings.VolumeCaps, policyConfig.AudioSession{Name: row.name, ExePath: row.exePath})
+			}
+			slider.OnChanged = func(f float64) {
+				if f > float64(rowCap*100) {
+					slider.SetValue(float64(rowCap * 100))
+					return
+				}
+				// An outside change the slider follows is already in effect, and writing it
+				// back would cancel a fade still heading elsewhere.
+				if mixerSyncing {
+					return
+				}
+				level := float32(f / 100.0)
+				rememberAppVolume(rowExe, level, mixerMuted[rowI])
+				d := fadeDuration()
+				go func() {
+					for _, id := range rowIDs {
+						setBackgroundVolume(id, level)
+						duck.userVolume(id, level)
+						fader.Fade(audioBackend.Session(id), cachedSessionVolume(id, level), level, d, func(err error) {
+							if err != nil {
+								general.LogError("Error setting session volume", err)
+							}
+						})
+					}
+				}()
+			}
+
+			mixerSliders[i] = slider
+
+			// --- Output device picker — system sounds always follow the default device,
+			// and the sessions of an expanded application are routed from its row ---
+			controls := container.NewHBox(soloBtn, muteBtn)
+			if !row.isSys && !row.child {
+				rowPIDs := row.pids
+				routeBtn := fyneCustom.NewIconButton(theme.MenuDropDownIcon(), nil)
+				routeBtn.OnTapped = func() { showSessionDeviceMenu(routeBtn, rowPIDs) }
+				go func() {
+					if deviceID, err := backend.GetSessionDevice(rowPIDs[0]); err == nil && deviceID != "" {
+						fyne.Do(func() { routeBtn.SetActive(true) })
+					}
+				}()
+				controls = container.NewHBox(routeBtn, soloBtn, muteBtn)
+			}
+
+			// --- Lock button: keeps the app at its remembered volume ---
+			if rowExe != "" && !row.child {
+				lockBtn := fyneCustom.NewIconButton(fyneCustom.LockIcon(), nil)
+				lockBtn.SetActive(appVolumeLocked(rowExe))
+				lockBtn.OnTapped = func() {
+					locked := !appVolumeLocked(rowExe)
+					lockAppVolume(rowExe, locked, float32(mixerSliders[rowI].Value/100), mixerMuted[rowI])
+					lockBtn.SetActive(locked)
+				}
+				controls = container.NewHBox(append([]fyne.CanvasObject{lockBtn}, controls.Objects...)...)
+			}
+
+			// --- Expand button for applications with several sessions ---
+			if row.members > 1 {
+				key := row.key
+				expandIcon := theme.MenuExpandIcon()
+				if mixerExpanded[key] {
+					expandIcon = theme.MenuDropDownIcon()
+				}
+				expandBtn := fyneCustom.NewIconButton(expandIcon, func() {
+					mixerExpanded[key] = !mixerExpanded[key]
+					refreshMixerWithSessions(mixerLastSessions)
+				})
+				expandBtn.SetActive(mixerExpanded[key])
+				controls = container.NewHBox(append([]fyne.CanvasObject{expandBtn}, controls.Objects...)...)
+			}
+
+			// --- Peak meter, fed by monitorMeters while the window is visible ---
+			meter := fyneCustom.NewLevelMeter()
+			mixerMeters[i] = meter
+
+			// Layout: top row = [icon] name ... [expandBtn][lockBtn][routeBtn][soloBtn][muteBtn]
+			//         bottom  = slider and meter (full width)
+			iconContainer := container.NewCenter(appIcon)
+			topRow := container.NewBorder(nil, nil,
+				container.NewHBox(iconContainer, label),
+				controls,
+			)
+			var sliderArea fyne.CanvasObject = slider
+			if rowCap < 1 {
+				sliderArea = container.NewStack(fyneCustom.NewSliderMarker(rowCap), slider)
+			}
+			var entry fyne.CanvasObject = container.NewVBox(topRow, sliderArea, meter)
+			if row.child {
+				// Indent the sessions of an expanded application under its row
+				indent := canvas.NewRectangle(color.Transparent)
+				indent.SetMinSize(fyne.NewSize(16, 0))
+				entry = container.NewBorder(nil, nil, indent, nil, entry)
+			}
+			newMixer.Add(entry)
+		}
+
+		mixerSection.Objects = []fyne.CanvasObject{newMixer}
+		mixerSection.Refresh()
+
+		// No reposition passes needed here: the window is sized from topSection
+		// only (the mixer lives below it behind the scroll), so mixer content
+		// changes never alter the target window size. The old delayed passes
+		// caused visible repositioning after show and fought the slide-in
+		// animation.
+	} else {
+		// Rows haven't changed — just update slider values and mute state in-place.
+		for i, row := range rows {
+			if i >= len(mixerSliders) || mixerSliders[i] == nil {
+				continue
+			}
+			// Sync mute button active state if changed externally, but do not override
+			// a recent user tap that is still being processed.
+			if i < len(mixerMuted) && i < len(mixerMuteButtons) && mixerMuteButtons[i] != nil {
+				if row.muted != mixerMuted[i] {
+					if time.Since(mixerMuteTapped[i]) > 1500*time.Millisecond {
+						mixerMuted[i] = row.muted
+						mixerMuteButtons[i].SetActive(row.muted)
+					}
+				}
+			}
+			if i < len(mixerSoloButtons) && mixerSoloButtons[i] != nil {
+				mixerSoloButtons[i].SetActive(soloedRow(row.ids))
+			}
+			// Don't override the slider while the user is dragging it.
+			if mixerSliders[i].IsDragging() {
+				continue
+			}
+			// Always track the real underlying volume; mute state is shown separately.
+			target := float64(row.volume * 100)
+			if mixerSliders[i].Value != target {
+				mixerSyncing = true
+				mixerSliders[i].SetValue(target)
+				mixerSyncing = false
+			}
+		}
+	}
+}
+
+// . mixerDeviceHeader labels the rows of one device in a mixer that spans several
+func mixerDeviceHeader(deviceID string, names map[string]string) fyne.CanvasObject {
+	name, ok := names[deviceID]
+	if !ok {
+		name = "Other device"
+	}
+	header := canvas.NewText(general.EllipticalTruncate(name, 30), color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x90})
+	header.TextSize = 10
+	header.TextStyle = fyne.TextStyle{Bold: true}
+	return header
+}
+
+// . envReference matches a %NAME% environment variable reference in an icon location
+var envReference = regexp.MustCompile(`%([^%]+)%`)
+
+// . parseIconLocation splits an icon location such as "@%SystemRoot%\System32\x.dll,-101"
+// into the file, with environment variables expanded, and the icon index. A negative
+// index is a resource ID.
+func parseIconLocation(location string) (path string, index int) {
+	location = strings.TrimPrefix(strings.TrimSpace(location), "@")
+	path = location
+	if i := strings.LastIndex(location, ","); i >= 0 {
+		if n, err := strconv.Atoi(strings.TrimSpace(location[i+1:])); err == nil {
+			path, index = location[:i], n
+		}
+	}
+	path = envReference.ReplaceAllStringFunc(path, func(ref string) string {
+		if value, ok := os.LookupEnv(ref[1 : len(ref)-1]); ok {
+			return value
+		}
+		return ref
+	})
+	return path, index
+}
+
+// . showSessionDeviceMenu looks up where an app is routed and pops up the output device
+// picker below its button. An app with several processes is routed as a whole; the
+// first one stands for the rest. The lookup runs off the Fyne goroutine.
+func showSessionDeviceMenu(btn *fyneCustom.IconButton, pids []uint32) {
+	go func() {
+		current, err := backend.GetSessionDevice(pids[0])
+		if err != nil {
+			general.LogError("Error getting session output device", err)
+		}
+		fyne.Do(func() {
+			c := fyne.CurrentApp().Driver().CanvasForObject(btn)
+			if c == nil {
+				return
+			}
+			pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(btn).AddXY(0, btn.Size().Height)
+			widget.ShowPopUpMenuAtPosition(sessionDeviceMenu(btn, pids, current), c, pos)
+		})
+	}()
+}
+
+// . sessionDeviceMenu lists "Follow default" and every shown output device, checking the
+// one the app is routed to. Choosing an entry routes the app and updates btn's state.
+func sessionDeviceMenu(btn *fyneCustom.IconButton, pids []uint32, current string) *fyne.Menu {
+	route := func(deviceID string) func() {
+		return func() {
+			btn.SetActive(deviceID != "")
+			go func() {
+				for _, pid := range pids {
+					if err := backend.SetSessionDevice(pid, deviceID); err != nil {
+						general.LogError("Error setting session output device", err)
+						fyne.Do(func() { btn.SetActive(current != "") })
+						return
+					}
+				}
+			}()
+		}
+	}
+
+	followItem := fyne.NewMenuItem("Follow default", route(""))
+	followItem.Checked = current == ""
+	items := []*fyne.MenuItem{followItem, fyne.NewMenuItemSeparator()}
+
+	mu.Lock()
+	devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
+	copy(devices, audioDevices)
+	mu.Unlock()
+	for _, device := range devices {
+		config, exists := settings.DeviceNames[device.Id]
+		if !exists {
+			config = DeviceConfig{Name: device.Name, IsShown: true}
+		}
+		if !config.IsShown {
+			continue
+		}
+		item := fyne.NewMenuItem(config.Name, route(device.Id))
+		item.Checked = device.Id == current
+		items = append(items, item)
+	}
+	return fyne.NewMenu("", items...)
+}
+
+// mixer state tracking for in-place updates
+type mixerKey struct {
+	device string // AudioSession.DeviceID the row's sessions play on
+	id     string // grouping key of an application row, AudioSession.ID of a session row
+	name   string
+}
+
+var mixerSessionKeys []mixerKey
+var mixerRowIDs [][]string // session IDs behind each row
+var mixerLastSessions []policyConfig.AudioSession
+var mixerSliders []*fyneCustom.ScrollableSlider
+var mixerMuteButtons []*fyneCustom.IconButton
+var mixerSoloButtons []*fyneCustom.IconButton
+var mixerMeters []*fyneCustom.LevelMeter
+var mixerMuted []bool
+var mixerMuteTapped []time.Time
+var mixerSyncing bool // set while a slider follows an outside change, so it is not remembered as the user's
+
+// cachedSessions holds the latest session snapshot, kept current by monitorMixer from session events.
+var (
+	cachedSessions   []policyConfig.AudioSession
+	cachedSessionsMu sync.Mutex
+	sessionsDirty    atomic.Bool
+)
+
+// . cachedSessionVolume returns the volume of a session in the cached snapshot, or
+// fallback when the snapshot does not have it
+func cachedSessionVolume(id string, fallback float32) float32 {
+	cachedSessionsMu.Lock()
+	defer cachedSessionsMu.Unlock()
+	for _, s := range cachedSessions {
+		if s.ID == id {
+			return s.Volume
+		}
+	}
+	return fallback
+}
+
+// . Mixer wake-up signals: mixerResync when sessions were created, changed state or
+// disconnected (the session list must be re-read), mixerDeviceChanged when an output
+// device came or went or became the default (the session watcher must be re-registered
+// on the current set of devices).
+var mixerResync = make(chan struct{}, 1)
+var mixerDeviceChanged = make(chan struct{}, 1)
+
+// . Mixer refresh timing: session events are the primary trigger, polling is only a
+// safety net for missed events or a watcher that could not be registered.
+const (
+	sessionEventSettle   = 100 * time.Millisecond // let a burst of session events finish before re-enumerating
+	sessionPollFallback  = 15 * time.Second       // safety-net poll while session events are working
+	sessionPollNoWatcher = 2 * time.Second        // poll interval while no session watcher is registered
+)
+
+// . monitorMixer keeps cachedSessions current from session events and dispatches UI updates.
+// COM work runs on this dedicated OS thread (not on Fyne's thread) for reliability.
+// New/expired/disconnected sessions trigger one re-enumeration; volume and mute changes
+// are patched straight into the cached snapshot without touching COM.
+func monitorMixer() {
+	// Bind this goroutine to a single OS thread with COM initialised on it.
+	// Without this, Go's scheduler can migrate the goroutine mid-COM-call,
+	// causing silent failures or stale data.
+	defer backend.BindThread()()
+
+	var watcher audioBackend.SessionWatcher
+	defer func() {
+		if watcher != nil {
+			watcher.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(sessionPollNoWatcher)
+	defer ticker.Stop()
+
+	// startWatcher (re)registers the session watcher on the current output devices
+	// and adjusts the fallback poll to match.
+	startWatcher := func() {
+		if watcher != nil {
+			watcher.Close()
+			watcher = nil
+		}
+		w, err := backend.WatchSessions(onSessionEvent)
+		if err != nil {
+			general.LogError("Session events unavailable, polling instead", err)
+			ticker.Reset(sessionPollNoWatcher)
+			return
+		}
+		watcher = w
+		ticker.Reset(sessionPollFallback)
+	}
+
+	startWatcher()
+	publishSessions()
+
+	for {
+		select {
+		case <-mixerDeviceChanged:
+			startWatcher()
+			publishSessions()
+		case <-mixerResync:
+			time.Sleep(sessionEventSettle)
+			select {
+			case <-mixerResync: // drop a signal raised during the settle delay
+			default:
+			}
+			if watcher != nil {
+				if err := watcher.Refresh(); err != nil {
+					startWatcher()
+				}
+			}
+			publishSessions()
+		case <-ticker.C:
+			if watcher == nil {
+				startWatcher()
+			} else if err := watcher.Refresh(); err != nil {
+				startWatcher()
+			}
+			publishSessions()
+		}
+	}
+}
+
+// . publishSessions re-enumerates sessions, caches the snapshot and updates the mixer
+// if the window is visible. Must run on monitorMixer's COM thread.
+func publishSessions() {
+	sessions, err := backend.GetSessions()
+	if err != nil {
+		return
+	}
+
+	// New sessions of remembered apps, and locked apps that drifted, get their volume back.
+	sessions = restoreAppVolumes(sessions)
+	// Apps that raised themselves above their cap are pulled back down.
+	sessions = enforceVolumeCaps(sessions)
+	// New sessions are muted while another app is soloed, and the solo ends with its app.
+	sessions = updateSolo(sessions)
+
+	// Cache the latest snapshot so showMainWindow can use it immediately.
+	cachedSessionsMu.Lock()
+	cachedSessions = sessions
+	cachedSessionsMu.Unlock()
+
+	pushSessionsToUI(sessions)
+}
+
+// . pushSessionsToUI updates the mixer with a snapshot when the window is visible,
+// otherwise marks the snapshot dirty so the next window-show picks it up.
+func pushSessionsToUI(sessions []policyConfig.AudioSession) {
+	if !isMainWindowVisible() {
+		sessionsDirty.Store(true)
+		return
+	}
+	sessionsDirty.Store(false)
+	fyne.Do(func() {
+		refreshMixerWithSessions(sessions)
+	})
+}
+
+// . onSessionEvent handles a session event. Runs on a Windows audio thread: it
+// never calls into COM and only signals or patches the cached snapshot.
+func onSessionEvent(ev policyConfig.SessionEvent) {
+	if ev.Kind != policyConfig.SessionVolumeChanged {
+		signal(mixerResync)
+		return
+	}
+
+	// Patch volume/mute into a copy of the snapshot; readers may still hold the old slice.
+	cachedSessionsMu.Lock()
+	sessions := make([]policyConfig.AudioSession, len(cachedSessions))
+	copy(sessions, cachedSessions)
+	changed, drifted, capped := false, false, false
+	for i := range sessions {
+		if sessions[i].ID == ev.ID {
+			sessions[i].Volume = ev.Volume
+			sessions[i].Muted = ev.Muted
+			changed = true
+			drifted = !ev.FromSelf && appVolumeDrifted(sessions[i])
+			capped = aboveVolumeCap(sessions[i])
+			break
+		}
+	}
+	if changed {
+		cachedSessions = sessions
+	}
+	cachedSessionsMu.Unlock()
+
+	// A locked app is pulled back to its volume, and an app above its cap down to it, by
+	// the next re-enumeration.
+	if drifted || capped {
+		signal(mixerResync)
+	}
+
+	// Our own slider/mute writes are already reflected in the UI.
+	if changed && !ev.FromSelf {
+		pushSessionsToUI(sessions)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"slices"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+)
+
+// . mixerRow is one row of the mixer: an application with all of its sessions, or one
+// session of an application whose row is expanded
+type mixerRow struct {
+	key     mixerKey
+	ids     []string // AudioSession.IDs the row's slider and mute apply to
+	pids    []uint32 // distinct processes of those sessions, for output routing
+	name    string
+	exePath string
+	icon    string // AudioSession.IconPath
+	isSys   bool
+	volume  float32 // loudest member session
+	muted   bool    // every member session muted
+	members int     // sessions of the application; more than one lets the row expand
+	child   bool    // a single session shown under its expanded application
+}
+
+// . mixerExpanded holds the keys of the application rows expanded to show their
+// sessions. Only touched on the Fyne goroutine.
+var mixerExpanded = make(map[mixerKey]bool)
+
+// . mixerDevices returns the output devices in the order the mixer lists their sessions,
+// the current device first, and the names they are shown under
+func mixerDevices() (order []string, names map[string]string) {
+	mu.Lock()
+	devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
+	copy(devices, audioDevices)
+	current := currentDeviceID
+	mu.Unlock()
+
+	names = make(map[string]string, len(devices))
+	order = append(order, current)
+	for _, device := range devices {
+		names[device.Id] = device.Name
+		if config, ok := settings.DeviceNames[device.Id]; ok && config.Name != "" {
+			names[device.Id] = config.Name
+		}
+		if device.Id != current {
+			order = append(order, device.Id)
+		}
+	}
+	return order, names
+}
+
+// . sessionsByDevice splits sessions by the device they play on, in deviceOrder; devices
+// missing from it follow in the order their first session appears
+func sessionsByDevice(sessions []policyConfig.AudioSession, deviceOrder []string) [][]policyConfig.AudioSession {
+	byDevice := make(map[string][]policyConfig.AudioSession)
+	order := append([]string(nil), deviceOrder...)
+	for _, s := range sessions {
+		if _, ok := byDevice[s.DeviceID]; !ok && !slices.Contains(order, s.DeviceID) {
+			order = append(order, s.DeviceID)
+		}
+		byDevice[s.DeviceID] = append(byDevice[s.DeviceID], s)
+	}
+
+	var split [][]policyConfig.AudioSession
+	for _, deviceID := range order {
+		if len(byDevice[deviceID]) > 0 {
+			split = append(split, byDevice[deviceID])
+			delete(byDevice, deviceID)
+		}
+	}
+	return split
+}
+
+// . groupingKeys returns the keys that put sessions in the same application: the
+// executable path and the grouping parameter the app set
+func groupingKeys(s policyConfig.AudioSession) []string {
+	var keys []string
+	if s.ExePath != "" && !s.IsSystem {
+		keys = append(keys, "exe:"+strings.ToLower(s.ExePath))
+	}
+	if s.GroupID != "" {
+		keys = append(keys, "group:"+s.GroupID)
+	}
+	return keys
+}
+
+// . groupSessions splits sessions into applications. Sessions sharing an executable path
+// or a grouping parameter belong together, transitively; groups keep the order of their
+// first session.
+func groupSessions(sessions []policyConfig.AudioSession) [][]policyConfig.AudioSession {
+	parent := make([]int, len(sessions))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	firstWithKey := make(map[string]int)
+	for i, s := range sessions {
+		parent[i] = i
+		for _, key := range groupingKeys(s) {
+			j, seen := firstWithKey[key]
+			if !seen {
+				firstWithKey[key] = i
+				continue
+			}
+			//* Join under the earlier root so the group keeps its first session's position
+			a, b := find(i), find(j)
+			parent[max(a, b)] = min(a, b)
+		}
+	}
+
+	var groups [][]policyConfig.AudioSession
+	groupOf := make(map[int]int)
+	for i, s := range sessions {
+		root := find(i)
+		g, ok := groupOf[root]
+		if !ok {
+			g = len(groups)
+			groupOf[root] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], s)
+	}
+	return groups
+}
+
+// . buildMixerRows turns sessions into mixer rows, device by device in deviceOrder: one
+// per application, followed by one per session when the application is expanded. The
+// same application on two devices gets a row on each.
+func buildMixerRows(sessions []policyConfig.AudioSession, deviceOrder []string) []mixerRow {
+	var rows []mixerRow
+	for _, deviceSessions := range sessionsByDevice(sessions, deviceOrder) {
+		rows = append(rows, buildDeviceRows(deviceSessions)...)
+	}
+	return rows
+}
+
+// . buildDeviceRows builds the rows of the sessions of one device
+func buildDeviceRows(sessions []policyConfig.AudioSession) []mixerRow {
+	var rows []mixerRow
+	for _, group := range groupSessions(sessions) {
+		first := group[0]
+		id := first.ID
+		if keys := groupingKeys(first); len(keys) > 0 {
+			id = keys[0]
+		}
+		key := mixerKey{device: first.DeviceID, id: id, name: first.Name}
+
+		row := mixerRow{
+			key:     key,
+			name:    first.Name,
+			exePath: first.ExePath,
+			icon:    first.IconPath,
+			isSys:   first.IsSystem,
+			muted:   true,
+			members: len(group),
+		}
+		for _, s := range group {
+			row.ids = append(row.ids, s.ID)
+			if !slices.Contains(row.pids, s.PID) {
+				row.pids = append(row.pids, s.PID)
+			}
+			row.volume = max(row.volume, s.Volume)
+			row.muted = row.muted && s.Muted
+		}
+		rows = append(rows, row)
+
+		if len(group) < 2 || !mixerExpanded[key] {
+			continue
+		}
+		for _, s := range group {
+			rows = append(rows, mixerRow{
+				key:     mixerKey{device: s.DeviceID, id: s.ID, name: s.Name},
+				ids:     []string{s.ID},
+				pids:    []uint32{s.PID},
+				name:    s.Name,
+				exePath: s.ExePath,
+				icon:    s.IconPath,
+				isSys:   s.IsSystem,
+				volume:  s.Volume,
+				muted:   s.Muted,
+				members: 1,
+				child:   true,
+			})
+		}
+	}
+	return rows
+}
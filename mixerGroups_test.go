@@ -0,0 +1,117 @@
+package main
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+)
+
+// browserSessions are three sessions of one browser from different renderer processes.
+var browserSessions = []policyConfig.AudioSession{
+	{ID: "chrome-1", Name: "Chrome", PID: 100, Volume: 0.5, ExePath: `C:\Program Files\Google\Chrome\chrome.exe`},
+	{ID: "sys", Name: "System Sounds", IsSystem: true, Volume: 1},
+	{ID: "chrome-2", Name: "Chrome", PID: 101, Volume: 0.8, ExePath: `C:\Program Files\Google\Chrome\Chrome.exe`},
+	{ID: "chrome-3", Name: "Chrome", PID: 102, Volume: 0.5, ExePath: `C:\Program Files\Google\Chrome\chrome.exe`},
+}
+
+func TestGroupSessionsByExecutableAndGroupingParam(t *testing.T) {
+	groups := groupSessions(browserSessions)
+	if len(groups) != 2 || len(groups[0]) != 3 || !groups[1][0].IsSystem {
+		t.Fatalf("groups = %+v, want the three Chrome sessions together, then System Sounds", groups)
+	}
+
+	// A helper process with another executable joins through the app's grouping parameter
+	groups = groupSessions([]policyConfig.AudioSession{
+		{ID: "a", PID: 1, ExePath: `C:\Discord\Discord.exe`, GroupID: "{G}"},
+		{ID: "b", PID: 2, ExePath: `C:\Discord\helper.exe`},
+		{ID: "c", PID: 3, ExePath: `C:\Discord\helper.exe`, GroupID: "{G}"},
+		{ID: "d", PID: 4, ExePath: `C:\Spotify\Spotify.exe`},
+	})
+	if len(groups) != 2 || len(groups[0]) != 3 || groups[1][0].ID != "d" {
+		t.Errorf("groups = %+v, want a, b and c together, then d", groups)
+	}
+}
+
+func TestGroupRowControlsEveryMemberSession(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(browserSessions...)
+	refreshMixerWithSessions(browserSessions)
+
+	if len(mixerSliders) != 2 {
+		t.Fatalf("mixer has %d rows, want one for Chrome and one for System Sounds", len(mixerSliders))
+	}
+	if mixerSliders[0].Value != 80 {
+		t.Errorf("group slider = %v, want the loudest session's 80", mixerSliders[0].Value)
+	}
+
+	mixerSliders[0].SetValue(30)
+	mixerMuteButtons[0].Tapped(nil)
+	waitFor(t, "every Chrome session to change", func() bool {
+		sessions, _ := fake.GetSessions()
+		for _, s := range sessions {
+			if !s.IsSystem && (s.Volume != 0.3 || !s.Muted) {
+				return false
+			}
+		}
+		return true
+	})
+	if sessions, _ := fake.GetSessions(); sessions[1].Volume != 1 || sessions[1].Muted {
+		t.Error("System Sounds should not follow the Chrome row")
+	}
+}
+
+func TestExpandedGroupShowsItsSessions(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(browserSessions...)
+	refreshMixerWithSessions(browserSessions)
+
+	mixerExpanded[mixerSessionKeys[0]] = true
+	refreshMixerWithSessions(browserSessions)
+
+	if len(mixerSliders) != 5 {
+		t.Fatalf("mixer has %d rows, want Chrome, its 3 sessions and System Sounds", len(mixerSliders))
+	}
+	if mixerRowIDs[2][0] != "chrome-2" || mixerSliders[2].Value != 80 {
+		t.Errorf("second session row = %v at %v, want chrome-2 at 80", mixerRowIDs[2], mixerSliders[2].Value)
+	}
+
+	mixerSliders[2].SetValue(10)
+	waitFor(t, "only chrome-2 to change", func() bool {
+		sessions, _ := fake.GetSessions()
+		return sessions[2].Volume == 0.1 && sessions[0].Volume == 0.5
+	})
+}
+
+func TestMixerSectionsSessionsByDevice(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk"},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs", IsDefault: true},
+	)
+	checkAndUpdateDevices()
+
+	sessions := []policyConfig.AudioSession{
+		{ID: "ff-spk", Name: "Firefox", PID: 10, Volume: 1, ExePath: `C:\firefox.exe`, DeviceID: "spk"},
+		{ID: "ff-hs", Name: "Firefox", PID: 11, Volume: 1, ExePath: `C:\firefox.exe`, DeviceID: "hs"},
+		{ID: "discord", Name: "Discord", PID: 20, Volume: 1, DeviceID: "hs"},
+	}
+	refreshMixerWithSessions(sessions)
+
+	// The current device comes first, and Firefox keeps a row on each device
+	if len(mixerRowIDs) != 3 || mixerRowIDs[0][0] != "ff-hs" || mixerRowIDs[1][0] != "discord" || mixerRowIDs[2][0] != "ff-spk" {
+		t.Fatalf("mixer rows = %v, want [[ff-hs] [discord] [ff-spk]]", mixerRowIDs)
+	}
+
+	var headers []string
+	for _, obj := range mixerSection.Objects[0].(*fyne.Container).Objects {
+		if text, ok := obj.(*canvas.Text); ok {
+			headers = append(headers, text.Text)
+		}
+	}
+	if len(headers) != 2 || headers[0] != "Headset" || headers[1] != "Speakers" {
+		t.Errorf("device headers = %v, want [Headset Speakers]", headers)
+	}
+}
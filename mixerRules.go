@@ -0,0 +1,251 @@
+package main
+
+import (
+	"path"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . RuleMatch is what a mixer rule's pattern is compared with
+type RuleMatch string
+
+const (
+	MatchName RuleMatch = "name" // the app's name or its executable's name, with or without extension
+	MatchGlob RuleMatch = "glob" // a glob over those names and the executable's full path
+	MatchPath RuleMatch = "path" // the executable's full path, or a folder it is in
+)
+
+// . MixerRule hides or shows the mixer sessions it matches. Rules are evaluated in
+// order and the last match decides, so later rules override earlier ones.
+type MixerRule struct {
+	Match          RuleMatch
+	Pattern        string
+	Exclude        bool // hide matching sessions; otherwise show them even if an earlier rule hid them
+	HideWhenSilent bool // hide matching sessions while they are not playing
+}
+
+// . builtinHiddenApps are system host executables that are not meaningful in a per-app
+// mixer. They make up the default rules.
+var builtinHiddenApps = []string{
+	"svchost",
+	"runtimebroker",
+	"backgroundtaskhost",
+	"sihost",
+	"systemsettings",
+	"systemsettingsbroker",
+	"searchhost",
+	"taskhostw",
+	"dllhost",
+	"applicationframehost",
+	"shellexperiencehost",
+	"startmenuexperiencehost",
+	"ctfmon",
+	"conhost",
+}
+
+// . defaultMixerRules returns the rules new settings start with: one hiding each built-in
+// host executable
+func defaultMixerRules() []MixerRule {
+	rules := make([]MixerRule, len(builtinHiddenApps))
+	for i, name := range builtinHiddenApps {
+		rules[i] = MixerRule{Match: MatchName, Pattern: name, Exclude: true}
+	}
+	return rules
+}
+
+// . slashPath lowercases a Windows or Unix path and gives it forward slashes, so paths
+// compare the same way on either system
+func slashPath(p string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(p), `\`, "/"))
+}
+
+// . matches reports whether the rule applies to a session
+func (r MixerRule) matches(s policyConfig.AudioSession) bool {
+	pattern := strings.ToLower(strings.TrimSpace(r.Pattern))
+	if pattern == "" {
+		return false
+	}
+
+	exePath := slashPath(s.ExePath)
+	var names []string
+	if s.Name != "" {
+		names = append(names, strings.ToLower(s.Name))
+	}
+	if exePath != "" {
+		file := path.Base(exePath)
+		names = append(names, file, strings.TrimSuffix(file, path.Ext(file)))
+	}
+
+	switch r.Match {
+	case MatchPath:
+		pattern = strings.TrimSuffix(slashPath(pattern), "/")
+		return exePath != "" && (exePath == pattern || strings.HasPrefix(exePath, pattern+"/"))
+	case MatchGlob:
+		if exePath != "" {
+			names = append(names, exePath)
+		}
+		pattern = slashPath(pattern)
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, name := range names {
+			if name == pattern {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// . sessionShown reports whether the mixer lists a session under the given rules. A
+// session no rule matches is shown.
+func sessionShown(rules []MixerRule, s policyConfig.AudioSession) bool {
+	shown := true
+	for _, rule := range rules {
+		if rule.matches(s) {
+			shown = !rule.Exclude && !(rule.HideWhenSilent && !s.Active)
+		}
+	}
+	return shown
+}
+
+// . filterSessions returns the sessions the rules let the mixer show
+func filterSessions(rules []MixerRule, sessions []policyConfig.AudioSession) []policyConfig.AudioSession {
+	if len(rules) == 0 {
+		return sessions
+	}
+	shown := make([]policyConfig.AudioSession, 0, len(sessions))
+	for _, s := range sessions {
+		if sessionShown(rules, s) {
+			shown = append(shown, s)
+		}
+	}
+	return shown
+}
+
+// . Labels of the rule editor's dropdowns
+var (
+	ruleActionLabels = []string{"Hide", "Show"}
+	ruleMatchLabels  = map[RuleMatch]string{MatchName: "Name", MatchGlob: "Glob", MatchPath: "Path"}
+)
+
+// . mixerRulesEditor is the mixer rule list of the config window: one row per rule and
+// buttons to add a rule or go back to the defaults
+type mixerRulesEditor struct {
+	Container *fyne.Container
+	list      *fyne.Container
+	rows      []*mixerRuleRow
+	appNames  []string // names of the current sessions, offered as patterns
+}
+
+// . mixerRuleRow holds the widgets of one rule
+type mixerRuleRow struct {
+	action  *widget.Select
+	match   *widget.Select
+	pattern *widget.SelectEntry
+	silent  *widget.Check
+	object  fyne.CanvasObject
+}
+
+// . newMixerRulesEditor creates an editor showing rules. appNames are offered in each
+// rule's pattern dropdown.
+func newMixerRulesEditor(rules []MixerRule, appNames []string) *mixerRulesEditor {
+	e := &mixerRulesEditor{list: container.NewVBox(), appNames: appNames}
+	for _, rule := range rules {
+		e.add(rule)
+	}
+
+	add := widget.NewButtonWithIcon("Add rule", theme.ContentAddIcon(), func() {
+		e.add(MixerRule{Match: MatchName, Exclude: true})
+	})
+	reset := widget.NewButton("Restore defaults", func() {
+		e.list.Objects = nil
+		e.rows = nil
+		for _, rule := range defaultMixerRules() {
+			e.add(rule)
+		}
+		e.list.Refresh()
+	})
+	e.Container = container.NewVBox(e.list, container.NewHBox(add, reset))
+	return e
+}
+
+// . add appends a row for rule
+func (e *mixerRulesEditor) add(rule MixerRule) {
+	r := &mixerRuleRow{}
+
+	r.action = widget.NewSelect(ruleActionLabels, nil)
+	r.action.SetSelected(ruleActionLabels[0])
+	if !rule.Exclude {
+		r.action.SetSelected(ruleActionLabels[1])
+	}
+
+	matchOptions := []string{ruleMatchLabels[MatchName], ruleMatchLabels[MatchGlob], ruleMatchLabels[MatchPath]}
+	r.match = widget.NewSelect(matchOptions, nil)
+	r.match.SetSelected(ruleMatchLabels[MatchName])
+	if label, ok := ruleMatchLabels[rule.Match]; ok {
+		r.match.SetSelected(label)
+	}
+
+	r.pattern = widget.NewSelectEntry(e.appNames)
+	r.pattern.SetText(rule.Pattern)
+	r.pattern.SetPlaceHolder("App, *glob* or C:\\path")
+
+	r.silent = widget.NewCheck("Hide when silent", nil)
+	r.silent.SetChecked(rule.HideWhenSilent)
+
+	remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() { e.remove(r) })
+	r.object = container.NewBorder(nil, nil,
+		container.NewHBox(r.action, r.match),
+		container.NewHBox(r.silent, remove),
+		r.pattern,
+	)
+
+	e.rows = append(e.rows, r)
+	e.list.Add(r.object)
+}
+
+// . remove drops the row r
+func (e *mixerRulesEditor) remove(r *mixerRuleRow) {
+	for i, row := range e.rows {
+		if row == r {
+			e.rows = append(e.rows[:i], e.rows[i+1:]...)
+			break
+		}
+	}
+	e.list.Remove(r.object)
+}
+
+// . rules returns the edited rules, skipping rows without a pattern. The result is never
+// nil, so an emptied list is saved as such instead of falling back to the defaults.
+func (e *mixerRulesEditor) rules() []MixerRule {
+	rules := make([]MixerRule, 0, len(e.rows))
+	for _, r := range e.rows {
+		pattern := strings.TrimSpace(r.pattern.Text)
+		if pattern == "" {
+			continue
+		}
+		match := MatchName
+		for m, label := range ruleMatchLabels {
+			if label == r.match.Selected {
+				match = m
+			}
+		}
+		rules = append(rules, MixerRule{
+			Match:          match,
+			Pattern:        pattern,
+			Exclude:        r.action.Selected == ruleActionLabels[0],
+			HideWhenSilent: r.silent.Checked,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+func TestMixerRuleMatches(t *testing.T) {
+	game := policyConfig.AudioSession{Name: "Space Game", ExePath: `C:\Games\Space\space.exe`}
+	tests := []struct {
+		rule MixerRule
+		want bool
+	}{
+		{MixerRule{Match: MatchName, Pattern: "space game"}, true},
+		{MixerRule{Match: MatchName, Pattern: "Space"}, true},
+		{MixerRule{Match: MatchName, Pattern: "space.exe"}, true},
+		{MixerRule{Match: MatchName, Pattern: "spa"}, false},
+		{MixerRule{Match: MatchGlob, Pattern: "spa*"}, true},
+		{MixerRule{Match: MatchGlob, Pattern: `c:\games\*\*.exe`}, true},
+		{MixerRule{Match: MatchGlob, Pattern: "*host"}, false},
+		{MixerRule{Match: MatchPath, Pattern: `C:\Games\`}, true},
+		{MixerRule{Match: MatchPath, Pattern: `c:\games\space\space.exe`}, true},
+		{MixerRule{Match: MatchPath, Pattern: `C:\Gam`}, false},
+		{MixerRule{Match: MatchName, Pattern: "  "}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.matches(game); got != tt.want {
+			t.Errorf("%s rule %q matches = %v, want %v", tt.rule.Match, tt.rule.Pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSessionShownLastMatchingRuleWins(t *testing.T) {
+	host := policyConfig.AudioSession{Name: "Host Process for Windows Services", ExePath: `C:\Windows\System32\svchost.exe`}
+	if sessionShown(defaultMixerRules(), host) {
+		t.Error("built-in rules should hide svchost")
+	}
+
+	rules := append(defaultMixerRules(), MixerRule{Match: MatchPath, Pattern: `C:\Windows\System32\svchost.exe`})
+	if !sessionShown(rules, host) {
+		t.Error("a later include rule should show svchost again")
+	}
+
+	chat := policyConfig.AudioSession{Name: "Discord", ExePath: `C:\Discord\Discord.exe`}
+	rules = []MixerRule{{Match: MatchName, Pattern: "discord", HideWhenSilent: true}}
+	if sessionShown(rules, chat) {
+		t.Error("a silent session should be hidden by a hide-when-silent rule")
+	}
+	chat.Active = true
+	if !sessionShown(rules, chat) {
+		t.Error("a playing session should be shown by a hide-when-silent rule")
+	}
+}
+
+func TestMixerRulesEditorRoundTrip(t *testing.T) {
+	useFakeBackend(t)
+	rules := []MixerRule{
+		{Match: MatchGlob, Pattern: "*host", Exclude: true},
+		{Match: MatchPath, Pattern: `C:\Games`, HideWhenSilent: true},
+	}
+
+	e := newMixerRulesEditor(rules, []string{"Firefox"})
+	e.add(MixerRule{Match: MatchName, Exclude: true}) // a row left empty is dropped
+	got := e.rules()
+	if len(got) != 2 || got[0] != rules[0] || got[1] != rules[1] {
+		t.Fatalf("rules() = %+v, want %+v", got, rules)
+	}
+
+	// Only the empty row is left; the emptied list must not read as "no rules saved"
+	e.remove(e.rows[0])
+	e.remove(e.rows[0])
+	if got := e.rules(); got == nil || len(got) != 0 {
+		t.Errorf("after removing both rules rules() = %#v, want an empty list", got)
+	}
+}
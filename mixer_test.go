@@ -0,0 +1,237 @@
+package main
+
+import (
+	"soundshift/fyneCustom"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a second has passed; mixer writes run on goroutines.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRefreshMixerWithSessionsEmptyClearsMixer(t *testing.T) {
+	useFakeBackend(t)
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 1}})
+
+	refreshMixerWithSessions(nil)
+
+	if len(mixerSection.Objects) != 0 {
+		t.Errorf("mixer section holds %d objects, want none", len(mixerSection.Objects))
+	}
+}
+
+func TestRefreshMixerWithSessionsBuildsRows(t *testing.T) {
+	useFakeBackend(t)
+
+	refreshMixerWithSessions([]policyConfig.AudioSession{
+		{ID: "sys", Name: "System Sounds", IsSystem: true, Volume: 1},
+		{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5, Muted: true},
+	})
+
+	if len(mixerSliders) != 2 {
+		t.Fatalf("mixer has %d sliders, want 2", len(mixerSliders))
+	}
+	if mixerSliders[0].Value != 100 || mixerSliders[1].Value != 50 {
+		t.Errorf("slider values = %v, %v; want 100, 50", mixerSliders[0].Value, mixerSliders[1].Value)
+	}
+	if mixerMuteButtons[0].Active || !mixerMuteButtons[1].Active {
+		t.Error("mute buttons do not reflect the session mute states")
+	}
+}
+
+func TestRefreshMixerWithSessionsFiltersHiddenApps(t *testing.T) {
+	useFakeBackend(t)
+	settings.MixerRules = []MixerRule{{Match: MatchName, Pattern: "discord", Exclude: true}}
+
+	refreshMixerWithSessions([]policyConfig.AudioSession{
+		{ID: "dc", Name: "Discord", PID: 20, Volume: 1},
+		{ID: "ff", Name: "Firefox", PID: 10, Volume: 1},
+	})
+
+	if len(mixerSessionKeys) != 1 || mixerSessionKeys[0].name != "Firefox" {
+		t.Errorf("mixer rows = %+v, want only Firefox", mixerSessionKeys)
+	}
+
+	// Hiding every session removes the mixer entirely
+	settings.MixerRules = append(settings.MixerRules, MixerRule{Match: MatchGlob, Pattern: "fire*", Exclude: true})
+	refreshMixerWithSessions([]policyConfig.AudioSession{
+		{ID: "dc", Name: "Discord", PID: 20, Volume: 1},
+		{ID: "ff", Name: "Firefox", PID: 10, Volume: 1},
+	})
+	if len(mixerSection.Objects) != 0 {
+		t.Error("mixer section should be empty when every session is hidden")
+	}
+}
+
+func TestRefreshMixerWithSessionsUpdatesInPlace(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(policyConfig.AudioSession{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}) // the slider writes through
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}})
+	slider, muteBtn := mixerSliders[0], mixerMuteButtons[0]
+
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.8, Muted: true}})
+
+	if mixerSliders[0] != slider || mixerMuteButtons[0] != muteBtn {
+		t.Fatal("an unchanged session set must not rebuild the rows")
+	}
+	if slider.Value != 80 {
+		t.Errorf("slider = %v, want 80", slider.Value)
+	}
+	if !muteBtn.Active {
+		t.Error("external mute was not applied to the mute button")
+	}
+}
+
+func TestRefreshMixerWithSessionsRebuildsOnNewSession(t *testing.T) {
+	useFakeBackend(t)
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}})
+	slider := mixerSliders[0]
+
+	refreshMixerWithSessions([]policyConfig.AudioSession{
+		{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5},
+		{ID: "sp", Name: "Spotify", PID: 30, Volume: 0.7},
+	})
+
+	if len(mixerSliders) != 2 || mixerSliders[0] == slider {
+		t.Error("a changed session set must rebuild the rows")
+	}
+}
+
+func TestRefreshMixerWithSessionsKeepsRecentMuteTap(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(policyConfig.AudioSession{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5})
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}})
+
+	mixerMuteButtons[0].Tapped(nil)
+	// A snapshot taken before the tap reached the backend must not undo it
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}})
+
+	if !mixerMuteButtons[0].Active {
+		t.Error("a stale snapshot overrode a recent mute tap")
+	}
+	waitFor(t, "the mute to reach the backend", func() bool {
+		sessions, _ := fake.GetSessions()
+		return sessions[0].Muted
+	})
+}
+
+func TestMixerSliderSetsSessionVolume(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(policyConfig.AudioSession{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5})
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "ff", Name: "Firefox", PID: 10, Volume: 0.5}})
+
+	mixerSliders[0].SetValue(25)
+
+	waitFor(t, "the session volume to reach the backend", func() bool {
+		sessions, _ := fake.GetSessions()
+		return sessions[0].Volume == 0.25
+	})
+}
+
+func TestSessionDeviceMenuRoutesApp(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headset", Id: "hs"},
+		mmDeviceEnumerator.AudioDevice{Name: "Monitor", Id: "mon"},
+	)
+	settings.DeviceNames = map[string]DeviceConfig{"mon": {Name: "Monitor", IsShown: false, OriginalName: "Monitor"}}
+	saveSettings()
+	checkAndUpdateDevices()
+	fake.SetSessionDevice(10, "hs")
+
+	btn := fyneCustom.NewIconButton(nil, nil)
+	menu := sessionDeviceMenu(btn, []uint32{10}, "hs")
+
+	var labels []string
+	for _, item := range menu.Items {
+		if !item.IsSeparator {
+			labels = append(labels, item.Label)
+		}
+	}
+	if len(labels) != 3 || labels[0] != "Follow default" || labels[1] != "Speakers" || labels[2] != "Headset" {
+		t.Fatalf("menu = %v, want [Follow default Speakers Headset]", labels)
+	}
+	if menu.Items[0].Checked || !menu.Items[3].Checked {
+		t.Error("the device the app is routed to should be checked")
+	}
+
+	menu.Items[2].Action()
+	if !btn.Active {
+		t.Error("the picker should show an app routed to a specific device as active")
+	}
+	waitFor(t, "the app to be routed to the speakers", func() bool {
+		deviceID, _ := fake.GetSessionDevice(10)
+		return deviceID == "spk"
+	})
+
+	menu.Items[0].Action()
+	if btn.Active {
+		t.Error("the picker should not be active for an app following the default")
+	}
+	waitFor(t, "the app to follow the default again", func() bool {
+		deviceID, _ := fake.GetSessionDevice(10)
+		return deviceID == ""
+	})
+}
+
+func TestMixerKeepsSessionsOfOneProcessApart(t *testing.T) {
+	fake := useFakeBackend(t)
+	tabs := []policyConfig.AudioSession{
+		{ID: "tab-1", Name: "Firefox", PID: 10, Volume: 0.5},
+		{ID: "tab-2", Name: "Firefox", PID: 10, Volume: 0.5},
+	}
+	fake.SetSessions(tabs...)
+	refreshMixerWithSessions(tabs)
+
+	mixerSliders[1].SetValue(25)
+	waitFor(t, "the second session's volume to reach the backend", func() bool {
+		sessions, _ := fake.GetSessions()
+		return sessions[1].Volume == 0.25
+	})
+	if sessions, _ := fake.GetSessions(); sessions[0].Volume != 0.5 {
+		t.Errorf("first session volume = %v, want it untouched at 0.5", sessions[0].Volume)
+	}
+
+	// An outside change is patched into the one session it happened on
+	cachedSessionsMu.Lock()
+	cachedSessions = tabs
+	cachedSessionsMu.Unlock()
+	onSessionEvent(policyConfig.SessionEvent{Kind: policyConfig.SessionVolumeChanged, ID: "tab-1", PID: 10, Volume: 1})
+	cachedSessionsMu.Lock()
+	got := []float32{cachedSessions[0].Volume, cachedSessions[1].Volume}
+	cachedSessionsMu.Unlock()
+	if got[0] != 1 || got[1] != 0.5 {
+		t.Errorf("cached volumes after an event on tab-1 = %v, want [1 0.5]", got)
+	}
+}
+
+func TestParseIconLocation(t *testing.T) {
+	t.Setenv("SystemRoot", `C:\Windows`)
+	for _, tc := range []struct {
+		location string
+		path     string
+		index    int
+	}{
+		{`@%SystemRoot%\System32\AudioSrv.Dll,-203`, `C:\Windows\System32\AudioSrv.Dll`, -203},
+		{`C:\Games\game.exe,2`, `C:\Games\game.exe`, 2},
+		{`C:\Apps\app.ico`, `C:\Apps\app.ico`, 0},
+		{`C:\Some, Folder\app.exe`, `C:\Some, Folder\app.exe`, 0},
+	} {
+		path, index := parseIconLocation(tc.location)
+		if path != tc.path || index != tc.index {
+			t.Errorf("parseIconLocation(%q) = %q, %d; want %q, %d", tc.location, path, index, tc.path, tc.index)
+		}
+	}
+}
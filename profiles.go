@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . Profile is a saved audio setup applied in one click from the flyout or the tray: the
+// default devices, their volume and mute, and the volume of each app
+type Profile struct {
+	Name           string
+	Output         ProfileDevice        // default output device
+	Communications ProfileDevice        // default output device for voice chat
+	Input          ProfileDevice        // default recording device
+	Apps           map[string]AppVolume // key = lowercase exe path, as in AppVolumes; Locked is not used
+}
+
+// . ProfileDevice is one device of a profile. It is found by ID, or by its normalized
+// name when Windows re-created the endpoint under a new ID.
+type ProfileDevice struct {
+	ID       string
+	Name     string
+	Volume   float32
+	Muted    bool
+	NoVolume bool // the device had no volume control when captured, so its level is left alone
+}
+
+// . captureProfile records the current default devices, their levels and the volume of
+// every app playing now as a profile called name
+func captureProfile(name string) (Profile, error) {
+	outputs, err := backend.GetDevices()
+	if err != nil {
+		return Profile{}, fmt.Errorf("listing output devices: %w", err)
+	}
+	inputs := getCaptureDevices()
+	sessions, err := backend.GetSessions()
+	if err != nil {
+		return Profile{}, fmt.Errorf("listing sessions: %w", err)
+	}
+
+	p := Profile{Name: name, Apps: make(map[string]AppVolume)}
+	for _, device := range outputs {
+		if device.IsDefault {
+			p.Output = captureProfileDevice(device)
+		}
+		if device.IsDefaultCommunications {
+			p.Communications = captureProfileDevice(device)
+		}
+	}
+	for _, device := range inputs {
+		if device.IsDefault {
+			p.Input = captureProfileDevice(device)
+		}
+	}
+
+	//* An app with several sessions is recorded with the first one, as the mixer row shows it
+	for _, s := range sessions {
+		key := appVolumeKey(s)
+		if _, ok := p.Apps[key]; key != "" && !ok {
+			volume, muted := ownLevel(s)
+			p.Apps[key] = AppVolume{Volume: volume, Muted: muted}
+		}
+	}
+	return p, nil
+}
+
+// . ownLevel returns the volume and mute of a session as the user left them: while
+// ducking, the foreground mode or solo holds it down, the state they will give it back
+func ownLevel(s policyConfig.AudioSession) (float32, bool) {
+	volume, muted := s.Volume, s.Muted
+	if original, down := backgroundOriginal(s.ID); down {
+		volume, muted = original.volume, original.muted
+	}
+	if original, ducked := duck.original(s.ID); ducked {
+		volume = original
+	}
+	if original, held := soloOriginal(s.ID); held {
+		muted = original
+	}
+	return volume, muted
+}
+
+// . captureProfileDevice records a device and its current level
+func captureProfileDevice(device mmDeviceEnumerator.AudioDevice) ProfileDevice {
+	pd := ProfileDevice{ID: device.Id, Name: device.Name}
+	volume, err := backend.GetVolume(device.Id)
+	if err != nil {
+		pd.NoVolume = true
+		return pd
+	}
+	muted, err := backend.GetMute(device.Id)
+	pd.Volume, pd.Muted = volume, err == nil && muted
+	return pd
+}
+
+// . matchProfileDevice finds the device of a profile among devices: by ID, or else by
+// normalized name. Disabled devices are never matched.
+func matchProfileDevice(pd ProfileDevice, devices []mmDeviceEnumerator.AudioDevice) (string, bool) {
+	if pd.ID == "" {
+		return "", false
+	}
+	for _, device := range devices {
+		if device.Id == pd.ID && !device.IsDisabled {
+			return device.Id, true
+		}
+	}
+	key := normalizeDeviceName(pd.Name)
+	if key == "" {
+		return "", false
+	}
+	for _, device := range devices {
+		if normalizeDeviceName(device.Name) == key && !device.IsDisabled {
+			return device.Id, true
+		}
+	}
+	return "", false
+}
+
+// . applyProfileNamed applies the profile called name, if there is one. Must be called on
+// the Fyne goroutine.
+func applyProfileNamed(name string) {
+	i := slices.IndexFunc(settings.Profiles, func(p Profile) bool { return p.Name == name })
+	if i < 0 {
+		return
+	}
+	applyProfile(settings.Profiles[i])
+}
+
+// . applyProfile switches to a profile's devices and levels. The apps' levels are also
+// remembered, so their new sessions, and locked apps, follow the profile. Must be called
+// on the Fyne goroutine.
+func applyProfile(p Profile) {
+	for exePath, v := range p.Apps {
+		rememberAppVolume(exePath, v.Volume, v.Muted)
+	}
+
+	d := fadeDuration()
+	go func() {
+		defer backend.BindThread()()
+		applyProfileDevices(p, d)
+		applyProfileApps(p, d)
+
+		//* Pick up the new defaults and levels in the flyout and the mixer
+		requestDeviceRefresh()
+		signal(mixerResync)
+	}()
+}
+
+// . applyProfileDevices makes a profile's devices the defaults and gives them its levels.
+// Devices that cannot be found are skipped.
+func applyProfileDevices(p Profile, d time.Duration) {
+	outputs, err := backend.GetDevices()
+	if err != nil {
+		general.LogError("Error listing output devices for profile "+p.Name, err)
+		return
+	}
+	inputs := getCaptureDevices()
+
+	apply := func(pd ProfileDevice, devices []mmDeviceEnumerator.AudioDevice, roles ...uint32) {
+		id, ok := matchProfileDevice(pd, devices)
+		if !ok {
+			return
+		}
+		if err := backend.SetDefaultDevice(id, roles...); err != nil {
+			general.LogError("Error setting default device for profile "+p.Name, err)
+			return
+		}
+		if pd.NoVolume {
+			return
+		}
+		if err := backend.SetMute(id, pd.Muted); err != nil {
+			general.LogError("Error setting mute for profile "+p.Name, err)
+		}
+		from := pd.Volume
+		if volume, err := backend.GetVolume(id); err == nil {
+			from = volume
+		}
+		fader.Fade(audioBackend.Endpoint(id), from, pd.Volume, d, logFadeError)
+	}
+
+	apply(p.Output, outputs, mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia)
+	apply(p.Communications, outputs, mmDeviceEnumerator.RoleCommunications)
+	apply(p.Input, inputs, mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia)
+}
+
+// . applyProfileApps gives the sessions of a profile's apps its levels, within their caps
+func applyProfileApps(p Profile, d time.Duration) {
+	sessions, err := backend.GetSessions()
+	if err != nil {
+		general.LogError("Error listing sessions for profile "+p.Name, err)
+		return
+	}
+	for _, s := range sessions {
+		v, ok := p.Apps[appVolumeKey(s)]
+		if !ok {
+			continue
+		}
+		if err := backend.SetSessionMute(s.ID, v.Muted); err != nil {
+			general.LogError("Error setting mute of "+s.Name+" for profile "+p.Name, err)
+		}
+		fader.Fade(audioBackend.Session(s.ID), s.Volume, cappedVolume(s, v.Volume), d, logFadeError)
+	}
+}
+
+// . profileSection holds the flyout's profile picker while there are profiles
+var profileSection = container.NewVBox()
+
+// . renderProfiles rebuilds the flyout's profile picker. Must be called on the Fyne
+// goroutine.
+func renderProfiles() {
+	if len(settings.Profiles) == 0 {
+		profileSection.Objects = nil
+		profileSection.Refresh()
+		return
+	}
+
+	names := make([]string, len(settings.Profiles))
+	for i, p := range settings.Profiles {
+		names[i] = p.Name
+	}
+	picker := widget.NewSelect(names, nil)
+	picker.PlaceHolder = "Apply profile"
+	picker.OnChanged = func(name string) {
+		if name == "" {
+			return
+		}
+		applyProfileNamed(name)
+		picker.ClearSelected() // a picker, not a state: the same profile can be applied again
+	}
+	profileSection.Objects = []fyne.CanvasObject{picker}
+	profileSection.Refresh()
+}
+
+// . profilesEditor is the profile list of the config window: one row per profile and a
+// row to save the current setup under a name. Changes take effect with the window's Save.
+type profilesEditor struct {
+	Container *fyne.Container
+	list      *fyne.Container
+	profiles  []Profile
+}
+
+// . newProfilesEditor creates an editor showing profiles
+func newProfilesEditor(profiles []Profile) *profilesEditor {
+	e := &profilesEditor{list: container.NewVBox(), profiles: slices.Clone(profiles)}
+	e.render()
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Profile name, e.g. Meeting")
+	save := widget.NewButtonWithIcon("Save current setup", theme.DocumentSaveIcon(), func() {
+		name := strings.TrimSpace(nameEntry.Text)
+		if name == "" {
+			return
+		}
+		nameEntry.SetText("")
+		go func() {
+			defer backend.BindThread()()
+			p, err := captureProfile(name)
+			if err != nil {
+				general.LogError("Error capturing profile "+name, err)
+				return
+			}
+			fyne.Do(func() { e.put(p) })
+		}()
+	})
+	e.Container = container.NewVBox(e.list, container.NewBorder(nil, nil, nil, save, nameEntry))
+	return e
+}
+
+// . put adds a profile, replacing the one with the same name
+func (e *profilesEditor) put(p Profile) {
+	if i := slices.IndexFunc(e.profiles, func(q Profile) bool { return q.Name == p.Name }); i >= 0 {
+		e.profiles[i] = p
+	} else {
+		e.profiles = append(e.profiles, p)
+	}
+	e.render()
+}
+
+// . render rebuilds the rows from e.profiles
+func (e *profilesEditor) render() {
+	e.list.Objects = nil
+	for _, p := range e.profiles {
+		name := p.Name
+		remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			e.profiles = slices.DeleteFunc(e.profiles, func(q Profile) bool { return q.Name == name })
+			e.render()
+		})
+		e.list.Add(container.NewBorder(nil, nil, nil, remove, widget.NewLabel(describeProfile(p))))
+	}
+	e.list.Refresh()
+}
+
+// . describeProfile returns a one-line summary of a profile for the editor
+func describeProfile(p Profile) string {
+	summary := p.Name
+	if p.Output.Name != "" {
+		summary += " — " + p.Output.Name
+	}
+	if n := len(p.Apps); n > 0 {
+		summary += fmt.Sprintf(", %d apps", n)
+	}
+	return summary
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"soundshift/interfaces/policyConfig"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+func TestMatchProfileDevice(t *testing.T) {
+	devices := []mmDeviceEnumerator.AudioDevice{
+		{Id: "new-id", Name: "Speakers (2- USB Audio Device)"},
+		{Id: "hdmi", Name: "HDMI Output", IsDisabled: true},
+	}
+	tests := []struct {
+		name   string
+		pd     ProfileDevice
+		wantID string
+		wantOK bool
+	}{
+		{"by ID", ProfileDevice{ID: "new-id", Name: "Renamed"}, "new-id", true},
+		{"by name after the ID changed", ProfileDevice{ID: "old-id", Name: "Speakers (USB Audio Device)"}, "new-id", true},
+		{"disabled device", ProfileDevice{ID: "hdmi", Name: "HDMI Output"}, "", false},
+		{"not captured", ProfileDevice{}, "", false},
+	}
+	for _, tt := range tests {
+		if id, ok := matchProfileDevice(tt.pd, devices); id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("%s: matchProfileDevice = %q, %v; want %q, %v", tt.name, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestProfileCaptureAndApply(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Id: "spk", Name: "Speakers", IsDefault: true, IsDefaultMultimedia: true, IsDefaultCommunications: true},
+		mmDeviceEnumerator.AudioDevice{Id: "hs", Name: "Headset"},
+	)
+	fake.SetEndpointState("spk", 0.3, false)
+	fake.SetEndpointState("hs", 0.9, true)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 0.25, ExePath: gameExe},
+		policyConfig.AudioSession{ID: "sys", Name: "System Sounds", Volume: 1, IsSystem: true},
+	)
+
+	p, err := captureProfile("Gaming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Output.ID != "spk" || p.Output.Volume != 0.3 || p.Communications.ID != "spk" || p.Input.ID != "" {
+		t.Errorf("captured devices = %+v, %+v, %+v", p.Output, p.Communications, p.Input)
+	}
+	if len(p.Apps) != 1 || p.Apps[`c:\games\game\game.exe`].Volume != 0.25 {
+		t.Errorf("captured apps = %v, want only the game at 0.25", p.Apps)
+	}
+
+	// Move everything away, then apply the profile
+	fake.SetDefaultDevice("hs", mmDeviceEnumerator.RoleConsole, mmDeviceEnumerator.RoleMultimedia, mmDeviceEnumerator.RoleCommunications)
+	fake.SetEndpointState("spk", 1, true)
+	fake.SetSessionVolume("g1", 1)
+	applyProfileDevices(p, 0)
+	applyProfileApps(p, 0)
+
+	devices, _ := fake.GetDevices()
+	if !devices[0].IsDefault || !devices[0].IsDefaultCommunications {
+		t.Errorf("speakers after applying = %+v, want the default again", devices[0])
+	}
+	if v, _ := fake.GetVolume("spk"); v != 0.3 {
+		t.Errorf("speaker volume = %v, want 0.3", v)
+	}
+	if muted, _ := fake.GetMute("spk"); muted {
+		t.Error("speakers still muted after applying")
+	}
+	sessions, _ := fake.GetSessions()
+	if sessions[0].Volume != 0.25 {
+		t.Errorf("game volume = %v, want 0.25", sessions[0].Volume)
+	}
+}
+
+func TestFlyoutProfilePicker(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Id: "spk", Name: "Speakers", IsDefault: true})
+	settings.Profiles = []Profile{{Name: "Music", Output: ProfileDevice{ID: "spk", Name: "Speakers", Volume: 0.6}}}
+
+	renderProfiles()
+	if len(profileSection.Objects) != 1 {
+		t.Fatal("no profile picker in the flyout")
+	}
+	picker := profileSection.Objects[0].(*widget.Select)
+	picker.SetSelected("Music")
+	waitFor(t, "the profile volume", func() bool { return fake.Volume("spk") == 0.6 })
+	if picker.Selected != "" {
+		t.Errorf("picker still shows %q after applying", picker.Selected)
+	}
+
+	settings.Profiles = nil
+	renderProfiles()
+	if len(profileSection.Objects) != 0 {
+		t.Error("profile picker shown without profiles")
+	}
+}
+
+func TestCaptureProfileRecordsLevelsBeforeEnginesChangedThem(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Id: "spk", Name: "Speakers", IsDefault: true})
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "voice", Name: "Discord", PID: 10, Volume: 1, ExePath: `C:\Discord\Discord.exe`},
+		policyConfig.AudioSession{ID: "music", Name: "Spotify", PID: 20, Volume: 0.8, ExePath: `C:\Spotify\Spotify.exe`},
+		policyConfig.AudioSession{ID: "video", Name: "Browser", PID: 30, Volume: 0.6, ExePath: `C:\Browser\browser.exe`},
+	)
+
+	// Spotify is ducked and the browser turned down by the foreground mode
+	sessions, _ := fake.GetSessions()
+	duck.step(Ducking{Enabled: true, Triggers: []string{"discord"}, Amount: 50, HoldSeconds: 1}, time.Now(), sessions, map[string]float32{"voice": 0.5})
+	sessions, _ = fake.GetSessions()
+	updateBackgroundSessions(ForegroundMode{Enabled: true, Attenuation: 100, Allowlist: []string{"spotify"}}, 10, "", sessions)
+
+	p, err := captureProfile("Evening")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := p.Apps[`c:\spotify\spotify.exe`]; v.Volume != 0.8 {
+		t.Errorf("captured Spotify = %+v, want its volume before ducking, 0.8", v)
+	}
+	if v := p.Apps[`c:\browser\browser.exe`]; v.Volume != 0.6 || v.Muted {
+		t.Errorf("captured browser = %+v, want 0.6 and unmuted as before the foreground mode", v)
+	}
+}
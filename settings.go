@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"soundshift/file"
+	"soundshift/general"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// . Structs for application configuration and device settings
+type DeviceConfig struct {
+	Name         string
+	IsShown      bool
+	OriginalName string
+}
+
+type AppSettings struct {
+	HideAfterSelection       bool
+	RememberScrollPosition   bool
+	KeepCommunicationsDevice bool                 // when true, tapping a device leaves the communications default untouched
+	MixerRules               []MixerRule          // which sessions the mixer lists, last matching rule wins
+	AppVolumes               map[string]AppVolume // key = lowercase exe path; guarded by appVolumesMu
+	ForegroundMode           ForegroundMode
+	Ducking                  Ducking
+	VolumeCaps               []VolumeCap // highest volume per app, lowest matching cap wins
+	FadeMilliseconds         int         // length of volume fades; 0 turns them off
+	Profiles                 []Profile   // named setups applied from the flyout and tray
+	DeviceNames              map[string]DeviceConfig
+}
+
+var settings AppSettings
+
+// . loadSettings loads application settings from a JSON file, initializing defaults if the file doesn't exist
+func loadSettings() {
+	settingsPath := file.RoamingDir() + "/soundshift/settings.json"
+
+	//* Initialize settings with default values
+	newSettings := AppSettings{
+		HideAfterSelection:       false,
+		RememberScrollPosition:   false,
+		KeepCommunicationsDevice: false,
+		MixerRules:               defaultMixerRules(),
+		AppVolumes:               make(map[string]AppVolume),
+		ForegroundMode:           ForegroundMode{Attenuation: 100},
+		Ducking:                  Ducking{Amount: 50, HoldSeconds: 1},
+		DeviceNames:              make(map[string]DeviceConfig),
+	}
+
+	//* Attempt to read the settings file from disk
+	fileData, err := os.ReadFile(settingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			settings = newSettings
+			saveSettings()
+		}
+		return
+	}
+
+	//* Parse settings from JSON file data
+	json.Unmarshal(fileData, &newSettings)
+
+	//* Ensure DeviceNames map is initialized even if missing from file
+	if newSettings.DeviceNames == nil {
+		newSettings.DeviceNames = make(map[string]DeviceConfig)
+	}
+	if newSettings.AppVolumes == nil {
+		newSettings.AppVolumes = make(map[string]AppVolume)
+	}
+
+	//* Settings from before mixer rules hid apps by exact lowercase name; those become
+	//* name rules after the built-in ones
+	var legacy struct {
+		HiddenApps map[string]bool
+		MixerRules []MixerRule
+	}
+	if json.Unmarshal(fileData, &legacy) == nil && legacy.MixerRules == nil {
+		newSettings.MixerRules = defaultMixerRules()
+		for _, name := range slices.Sorted(maps.Keys(legacy.HiddenApps)) {
+			if legacy.HiddenApps[name] {
+				newSettings.MixerRules = append(newSettings.MixerRules, MixerRule{Match: MatchName, Pattern: name, Exclude: true})
+			}
+		}
+	}
+
+	//* Retrieve the list of currently connected audio devices (output and recording)
+	currentDevices, err := backend.GetDevices()
+	if err != nil {
+		fmt.Println("Error getting current devices:", err)
+		general.LogError("Error getting current devices:", err)
+		return
+	}
+	currentDevices = append(currentDevices, getCaptureDevices()...)
+
+	mergeDeviceNames(newSettings.DeviceNames, currentDevices)
+
+	//* Commit the fully built settings atomically
+	settings = newSettings
+}
+
+// . mergeDeviceNames adds the devices in currentDevices that have no entry to deviceNames,
+// carrying over the entry of a disconnected device with the same name when Windows gave
+// it a new ID
+func mergeDeviceNames(deviceNames map[string]DeviceConfig, currentDevices []mmDeviceEnumerator.AudioDevice) {
+	//* Track which saved IDs are currently active so name-based ID migration
+	//* never steals the config of a device that is still connected
+	activeIDs := make(map[string]bool, len(currentDevices))
+	for _, device := range currentDevices {
+		activeIDs[device.Id] = true
+	}
+
+	//* Map normalized original names to saved IDs of devices that are NOT
+	//* currently active — these are migration candidates for when Windows
+	//* regenerates an endpoint GUID (e.g. after a GPU/audio driver reinstall)
+	nameToStaleID := make(map[string]string)
+	for id, config := range deviceNames {
+		if key := normalizeDeviceName(config.OriginalName); key != "" && !activeIDs[id] {
+			nameToStaleID[key] = id
+		}
+	}
+
+	//* Merge current devices into the saved settings. Entries for devices that
+	//* are disconnected right now are deliberately preserved, so a hidden
+	//* device stays hidden when it comes back (monitor sleep, unplug, etc.)
+	for _, device := range currentDevices {
+		if _, exists := deviceNames[device.Id]; exists {
+			continue
+		}
+		nameKey := normalizeDeviceName(device.Name)
+		if oldID, found := nameToStaleID[nameKey]; found {
+			config := deviceNames[oldID]
+			config.OriginalName = device.Name
+			deviceNames[device.Id] = config
+			delete(deviceNames, oldID)
+			delete(nameToStaleID, nameKey) // each stale entry migrates at most once
+			general.LogError(fmt.Sprintf("Migrated device ID for %s from %s to %s", device.Name, oldID, device.Id), nil)
+		} else {
+			deviceNames[device.Id] = DeviceConfig{
+				Name:         device.Name,
+				IsShown:      true,
+				OriginalName: device.Name,
+			}
+		}
+	}
+}
+
+// . reEnumPrefix matches the "N- " prefix Windows inserts into device names on
+// re-enumeration, e.g. "Speakers (2- USB Audio Device)"
+var reEnumPrefix = regexp.MustCompile(`\(\d+- `)
+
+// . normalizeDeviceName canonicalizes a device friendly name for matching:
+// case-insensitive, whitespace-trimmed, with re-enumeration prefixes removed
+func normalizeDeviceName(name string) string {
+	return strings.ToLower(strings.TrimSpace(reEnumPrefix.ReplaceAllString(name, "(")))
+}
+
+// . saveSettings saves the current settings to a JSON file in the user's roaming directory
+func saveSettings() {
+	fileData, _ := json.MarshalIndent(settings, "", "    ")
+
+	//* Ensure the settings directory exists
+	os.MkdirAll(file.RoamingDir()+"/soundshift", os.ModePerm)
+
+	//* Write the settings file to disk
+	os.WriteFile(file.RoamingDir()+"/soundshift/settings.json", fileData, 0644)
+}
+
+// . settingsSaveDelay batches the saves of rapid changes such as a slider drag
+const settingsSaveDelay = time.Second
+
+// . settingsSaveTimer is the pending batched save. Only touched on the Fyne goroutine.
+var settingsSaveTimer *time.Timer
+
+// . scheduleSettingsSave saves the settings once no change has followed for
+// settingsSaveDelay. Must be called on the Fyne goroutine.
+func scheduleSettingsSave() {
+	if settingsSaveTimer != nil {
+		settingsSaveTimer.Stop()
+	}
+	settingsSaveTimer = time.AfterFunc(settingsSaveDelay, func() { fyne.Do(saveSettings) })
+}
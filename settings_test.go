@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"soundshift/file"
+	"soundshift/interfaces/mmDeviceEnumerator"
+	"testing"
+)
+
+// writeSavedSettings persists s as the settings file loadSettings will read.
+func writeSavedSettings(t *testing.T, s AppSettings) {
+	t.Helper()
+	settings = s
+	saveSettings()
+	settings = AppSettings{}
+}
+
+func TestLoadSettingsCreatesDefaultsWhenMissing(t *testing.T) {
+	useFakeBackend(t)
+
+	loadSettings()
+
+	if settings.DeviceNames == nil {
+		t.Fatal("default settings must have initialized maps")
+	}
+	if len(settings.MixerRules) != len(builtinHiddenApps) {
+		t.Errorf("default settings have %d mixer rules, want one per built-in hidden app", len(settings.MixerRules))
+	}
+	if !file.Exists(file.RoamingDir() + "/soundshift/settings.json") {
+		t.Error("default settings were not written to disk")
+	}
+}
+
+func TestLoadSettingsMigratesRegeneratedDeviceID(t *testing.T) {
+	fake := useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{DeviceNames: map[string]DeviceConfig{
+		"old-id": {Name: "Desk speakers", IsShown: false, OriginalName: "Speakers (USB Audio Device)"},
+	}})
+	// Windows re-enumerated the endpoint under a new ID and a "2- " name prefix
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers (2- USB Audio Device)", Id: "new-id", IsDefault: true})
+
+	loadSettings()
+
+	if _, ok := settings.DeviceNames["old-id"]; ok {
+		t.Error("stale ID was not removed after migration")
+	}
+	got, ok := settings.DeviceNames["new-id"]
+	if !ok {
+		t.Fatal("config was not migrated to the new ID")
+	}
+	if got.Name != "Desk speakers" || got.IsShown {
+		t.Errorf("migrated config = %+v, want the custom name and hidden state preserved", got)
+	}
+	if got.OriginalName != "Speakers (2- USB Audio Device)" {
+		t.Errorf("OriginalName = %q, want the current device name", got.OriginalName)
+	}
+}
+
+func TestLoadSettingsDoesNotStealConfigOfActiveDevice(t *testing.T) {
+	fake := useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{DeviceNames: map[string]DeviceConfig{
+		"dock-1": {Name: "Dock A", IsShown: false, OriginalName: "USB Dock"},
+	}})
+	// Two identical docks: the saved one is still connected, the second is new
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "USB Dock", Id: "dock-1", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "USB Dock", Id: "dock-2"},
+	)
+
+	loadSettings()
+
+	if got := settings.DeviceNames["dock-1"]; got.Name != "Dock A" || got.IsShown {
+		t.Errorf("active device config changed to %+v", got)
+	}
+	if got := settings.DeviceNames["dock-2"]; got.Name != "USB Dock" || !got.IsShown {
+		t.Errorf("new device config = %+v, want a fresh default entry", got)
+	}
+}
+
+func TestLoadSettingsMigratesEachStaleEntryOnce(t *testing.T) {
+	fake := useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{DeviceNames: map[string]DeviceConfig{
+		"old-id": {Name: "Renamed", IsShown: true, OriginalName: "Headphones"},
+	}})
+	fake.SetDevices(
+		mmDeviceEnumerator.AudioDevice{Name: "Headphones", Id: "new-a", IsDefault: true},
+		mmDeviceEnumerator.AudioDevice{Name: "Headphones", Id: "new-b"},
+	)
+
+	loadSettings()
+
+	renamed := 0
+	for _, id := range []string{"new-a", "new-b"} {
+		if settings.DeviceNames[id].Name == "Renamed" {
+			renamed++
+		}
+	}
+	if renamed != 1 {
+		t.Errorf("stale config migrated to %d devices, want exactly 1", renamed)
+	}
+}
+
+func TestLoadSettingsKeepsDisconnectedDevices(t *testing.T) {
+	fake := useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{DeviceNames: map[string]DeviceConfig{
+		"tv": {Name: "TV", IsShown: false, OriginalName: "LG TV (NVIDIA High Definition Audio)"},
+	}})
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+
+	loadSettings()
+
+	if got, ok := settings.DeviceNames["tv"]; !ok || got.IsShown {
+		t.Errorf("disconnected device config = %+v (present %v), want it kept hidden", got, ok)
+	}
+	if _, ok := settings.DeviceNames["spk"]; !ok {
+		t.Error("connected device was not added")
+	}
+}
+
+func TestLoadSettingsIncludesRecordingDevices(t *testing.T) {
+	fake := useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{})
+	fake.SetDevices(mmDeviceEnumerator.AudioDevice{Name: "Speakers", Id: "spk", IsDefault: true})
+	fake.SetCaptureDevices(mmDeviceEnumerator.AudioDevice{Name: "Microphone", Id: "mic", IsDefault: true})
+
+	loadSettings()
+
+	if _, ok := settings.DeviceNames["mic"]; !ok {
+		t.Error("recording device was not added to the settings")
+	}
+	if len(settings.MixerRules) != len(builtinHiddenApps) {
+		t.Error("mixer rules must fall back to the defaults when missing from the file")
+	}
+}
+
+func TestNormalizeDeviceName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Speakers (2- USB Audio Device)", "speakers (usb audio device)"},
+		{"  Speakers (USB Audio Device) ", "speakers (usb audio device)"},
+		{"Headphones", "headphones"},
+	}
+	for _, tt := range tests {
+		if got := normalizeDeviceName(tt.in); got != tt.want {
+			t.Errorf("normalizeDeviceName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSettingsMigratesHiddenApps(t *testing.T) {
+	useFakeBackend(t)
+	os.WriteFile(file.RoamingDir()+"/soundshift/settings.json", []byte(`{"HiddenApps": {"discord": true, "firefox": false}}`), 0644)
+
+	loadSettings()
+
+	want := append(defaultMixerRules(), MixerRule{Match: MatchName, Pattern: "discord", Exclude: true})
+	if !slices.Equal(settings.MixerRules, want) {
+		t.Errorf("mixer rules = %+v, want the defaults and a rule hiding discord", settings.MixerRules)
+	}
+}
+
+func TestLoadSettingsKeepsEmptiedMixerRules(t *testing.T) {
+	useFakeBackend(t)
+	writeSavedSettings(t, AppSettings{MixerRules: []MixerRule{}})
+
+	loadSettings()
+
+	if settings.MixerRules == nil || len(settings.MixerRules) != 0 {
+		t.Errorf("mixer rules = %+v, want the emptied list kept", settings.MixerRules)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+	"sync"
+)
+
+var (
+	// soloMu guards the solo state. Solo is started from the mixer and kept up to date by
+	// publishSessions on monitorMixer's thread.
+	soloMu sync.Mutex
+	// soloIDs holds the soloed sessions, nil while nothing is soloed
+	soloIDs map[string]bool
+	// soloExe is the lowercase executable of the soloed row, so sessions the app opens
+	// later join the solo instead of being muted
+	soloExe string
+	// soloSaved holds the mute state every session had before solo changed it
+	soloSaved = make(map[string]bool) // session ID -> muted
+)
+
+// . toggleSolo solos a mixer row, muting every other session, or releases the solo if
+// the row is soloed already. exePath is the row's executable, "" for system sounds. Must
+// be called on the Fyne goroutine.
+func toggleSolo(ids []string, exePath string) {
+	release := soloedRow(ids)
+	go func() {
+		if release {
+			releaseSolo()
+		} else {
+			cachedSessionsMu.Lock()
+			sessions := cachedSessions
+			cachedSessionsMu.Unlock()
+			startSolo(ids, exePath, sessions)
+		}
+		signal(mixerResync) // our own mute changes do not reach the mixer as events
+	}()
+}
+
+// . startSolo releases any solo and solos the sessions ids among sessions
+func startSolo(ids []string, exePath string, sessions []policyConfig.AudioSession) {
+	soloMu.Lock()
+	defer soloMu.Unlock()
+	releaseSoloLocked()
+
+	soloIDs = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		soloIDs[id] = true
+	}
+	soloExe = strings.ToLower(exePath)
+	applySoloLocked(sessions)
+}
+
+// . updateSolo keeps the solo in line with a new snapshot: new sessions are muted, or join
+// the solo if they belong to the soloed app, and the solo is released once the soloed
+// sessions are gone. Returns the snapshot with the mute states applied. Must run on
+// monitorMixer's thread.
+func updateSolo(sessions []policyConfig.AudioSession) []policyConfig.AudioSession {
+	soloMu.Lock()
+	defer soloMu.Unlock()
+	if soloIDs == nil {
+		return sessions
+	}
+	for _, s := range sessions {
+		if inSoloLocked(s) {
+			return applySoloLocked(sessions)
+		}
+	}
+
+	//* The soloed app went away; every other session gets its mute state back
+	releaseSoloLocked()
+	return sessions
+}
+
+// . inSoloLocked reports whether a session is one of the soloed ones. Must hold soloMu.
+func inSoloLocked(s policyConfig.AudioSession) bool {
+	return soloIDs[s.ID] || (soloExe != "" && !s.IsSystem && strings.ToLower(s.ExePath) == soloExe)
+}
+
+// . applySoloLocked unmutes the soloed sessions and mutes the others, recording the state
+// of each session the first time it is seen. Returns the snapshot with the mute states
+// applied. Must hold soloMu.
+func applySoloLocked(sessions []policyConfig.AudioSession) []policyConfig.AudioSession {
+	applied := make([]policyConfig.AudioSession, len(sessions))
+	copy(applied, sessions)
+
+	live := make(map[string]bool, len(sessions))
+	for i, s := range applied {
+		live[s.ID] = true
+		if _, seen := soloSaved[s.ID]; seen {
+			continue
+		}
+		soloed := inSoloLocked(s)
+		if soloed {
+			soloIDs[s.ID] = true
+		}
+		soloSaved[s.ID] = s.Muted
+		if s.Muted == !soloed {
+			continue
+		}
+		if err := backend.SetSessionMute(s.ID, !soloed); err != nil {
+			general.LogError("Error setting solo mute of "+s.Name, err)
+			delete(soloSaved, s.ID)
+			continue
+		}
+		applied[i].Muted = !soloed
+	}
+
+	//* Sessions that ended need no restoring
+	for id := range soloSaved {
+		if !live[id] {
+			delete(soloSaved, id)
+		}
+	}
+	return applied
+}
+
+// . releaseSolo ends the solo, giving every session the mute state it had before
+func releaseSolo() {
+	soloMu.Lock()
+	defer soloMu.Unlock()
+	releaseSoloLocked()
+}
+
+// . releaseSoloLocked ends the solo. Must hold soloMu.
+func releaseSoloLocked() {
+	for id, muted := range soloSaved {
+		if err := backend.SetSessionMute(id, muted); err != nil {
+			general.LogError("Error restoring mute after solo", err)
+		}
+	}
+	soloIDs, soloExe = nil, ""
+	soloSaved = make(map[string]bool)
+}
+
+// . soloedRow reports whether the sessions of a mixer row are all soloed
+func soloedRow(ids []string) bool {
+	soloMu.Lock()
+	defer soloMu.Unlock()
+	if soloIDs == nil || len(ids) == 0 {
+		return false
+	}
+	for _, id := range ids {
+		if !soloIDs[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// . soloOriginal returns the mute state a session under the solo will be given back
+func soloOriginal(id string) (bool, bool) {
+	soloMu.Lock()
+	defer soloMu.Unlock()
+	muted, held := soloSaved[id]
+	return muted, held
+}
+
+// . soloHolds reports whether a session is under the solo, so other volume restoring
+// leaves its mute alone until the solo is released
+func soloHolds(id string) bool {
+	_, held := soloOriginal(id)
+	return held
+}
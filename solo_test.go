@@ -0,0 +1,73 @@
+package main
+
+import (
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+func TestSoloMutesOthersAndRestoresThem(t *testing.T) {
+	fake := useFakeBackend(t)
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 1, Muted: true, ExePath: gameExe},
+		policyConfig.AudioSession{ID: "b1", Name: "Browser", PID: 40, Volume: 1, ExePath: `C:\Browser\browser.exe`},
+		policyConfig.AudioSession{ID: "m1", Name: "Spotify", PID: 50, Volume: 1, Muted: true, ExePath: `C:\Spotify\Spotify.exe`},
+	)
+	muted := func() map[string]bool {
+		sessions, _ := fake.GetSessions()
+		got := make(map[string]bool)
+		for _, s := range sessions {
+			got[s.ID] = s.Muted
+		}
+		return got
+	}
+
+	sessions, _ := fake.GetSessions()
+	startSolo([]string{"g1"}, gameExe, sessions)
+	if got := muted(); got["g1"] || !got["b1"] || !got["m1"] {
+		t.Fatalf("muted while the game is soloed = %v, want everything but the game", got)
+	}
+	if !soloedRow([]string{"g1"}) || soloedRow([]string{"b1"}) {
+		t.Error("soloedRow does not match the soloed row")
+	}
+
+	releaseSolo()
+	if got := muted(); !got["g1"] || got["b1"] || !got["m1"] {
+		t.Errorf("muted after the solo = %v, want the states from before it", got)
+	}
+}
+
+func TestSoloFollowsSessions(t *testing.T) {
+	fake := useFakeBackend(t)
+	game := policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 1, ExePath: gameExe}
+	browser := policyConfig.AudioSession{ID: "b1", Name: "Browser", PID: 40, Volume: 1, ExePath: `C:\Browser\browser.exe`}
+	fake.SetSessions(game, browser)
+	sessions, _ := fake.GetSessions()
+	startSolo([]string{"g1"}, gameExe, sessions)
+
+	// A new session of another app is muted, one of the soloed app joins the solo
+	lobby := policyConfig.AudioSession{ID: "g2", Name: "Game", PID: 31, Volume: 1, Muted: true, ExePath: gameExe}
+	chat := policyConfig.AudioSession{ID: "c1", Name: "Chat", PID: 60, Volume: 1, ExePath: `C:\Chat\chat.exe`}
+	browser.Muted = true // as the solo left it
+	fake.SetSessions(game, browser, lobby, chat)
+	publishSessions()
+	sessions, _ = fake.GetSessions()
+	for _, s := range sessions {
+		if want := s.ID == "b1" || s.ID == "c1"; s.Muted != want {
+			t.Errorf("%s muted = %v, want %v", s.ID, s.Muted, want)
+		}
+	}
+
+	// The soloed app closing releases the solo
+	fake.SetSessions(policyConfig.AudioSession{ID: "b1", Name: "Browser", PID: 40, Volume: 1, Muted: true, ExePath: `C:\Browser\browser.exe`},
+		policyConfig.AudioSession{ID: "c1", Name: "Chat", PID: 60, Volume: 1, Muted: true, ExePath: `C:\Chat\chat.exe`})
+	publishSessions()
+	sessions, _ = fake.GetSessions()
+	for _, s := range sessions {
+		if s.Muted {
+			t.Errorf("%s still muted after the soloed app closed", s.ID)
+		}
+	}
+	if soloIDs != nil {
+		t.Error("solo still active after the soloed app closed")
+	}
+}
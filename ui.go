@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"soundshift/fyneCustom"
+	"soundshift/general"
+	"soundshift/interfaces/audioBackend"
+	"soundshift/interfaces/mmDeviceEnumerator"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+var deviceVboxPlaceholder = container.New(&fyneCustom.CustomVBoxLayout{FixedWidth: 150})
+var inputSection = container.NewVBox() // populated when shown recording devices exist
+
+// * Top section: device selector + master volume
+var topSection = container.NewCenter(
+	container.NewVBox(
+		deviceVboxPlaceholder,
+		&canvas.Line{StrokeColor: color.NRGBA{R: 0x30, G: 0x30, B: 0x30, A: 0xCC}, StrokeWidth: 1},
+		configButton,
+		profileSection,
+		container.NewPadded(container.NewBorder(nil, nil, nil, masterMuteButton, container.NewVBox(volumeSlider, masterMeter))),
+		inputSection,
+	),
+)
+
+// * Mixer section: per-app volume sliders
+var mixerVbox = container.NewVBox()
+var mixerSection = container.NewVBox() // populated when sessions exist
+
+// * Inner content: everything that can be scrolled
+var mainViewInner = container.NewPadded(
+	container.NewVBox(
+		topSection,
+		mixerSection,
+	),
+)
+
+// * Main view: scrollable wrapper
+var mainView = container.NewVScroll(mainViewInner)
+
+// * Configure button to open settings window
+var configButton = &widget.Button{Text: "Configure"}
+
+// * Scrollable volume slider control
+var volumeSlider = fyneCustom.NewScrollableSlider(0, 100)
+
+// * Mute toggle for the current device; the slider keeps showing the real level while muted
+var masterMuteButton = fyneCustom.NewIconButton(theme.VolumeMuteIcon(), nil)
+var masterMuted bool
+
+// . Initialization function for setting up UI interactions
+func init() {
+	//* Set up volume slider callback to adjust volume when changed
+	volumeSlider.OnChanged = func(f float64) {
+		volumeScalar := float32(f / 100.0)
+
+		mu.Lock()
+		devID := currentDeviceID
+		devices := make([]mmDeviceEnumerator.AudioDevice, len(audioDevices))
+		copy(devices, audioDevices)
+		mu.Unlock()
+
+		if devID == "" {
+			return
+		}
+
+		// Skip setting volume for disabled slider (inaccessible Remote Audio)
+		if volumeSlider.Disabled {
+			return
+		}
+
+		// Check if this is Remote Audio and test accessibility before setting volume
+		for _, device := range devices {
+			if device.Id == devID && device.Name == "Remote Audio" {
+				_, err := backend.GetVolume(devID)
+				if err != nil {
+					return
+				}
+				break
+			}
+		}
+
+		// Ramp from the current level when fades are on; a fade still running continues
+		// from wherever it has got to instead.
+		from := volumeScalar
+		if fadeDuration() > 0 {
+			if level, err := backend.GetVolume(devID); err == nil {
+				from = level
+			}
+		}
+		fader.Fade(audioBackend.Endpoint(devID), from, volumeScalar, fadeDuration(), func(err error) {
+			if err != nil {
+				fmt.Println("Error setting volume:", err)
+				general.LogError("Error setting volume:", err)
+			}
+		})
+	}
+
+	//* Set up the mute button to toggle the current device's mute state
+	masterMuteButton.OnTapped = func() {
+		mu.Lock()
+		devID := currentDeviceID
+		mu.Unlock()
+
+		// Nothing to mute, or no volume control (inaccessible Remote Audio)
+		if devID == "" || volumeSlider.Disabled {
+			return
+		}
+
+		newMuted := !masterMuted
+		setMasterMuted(newMuted)
+		level, d := float32(volumeSlider.Value/100), fadeDuration()
+		go func() {
+			fadeMute(audioBackend.Endpoint(devID), newMuted, level, d, func(muted bool) error {
+				return backend.SetMute(devID, muted)
+			}, func(err error) {
+				general.LogError("Error setting mute:", err)
+				fyne.Do(func() { setMasterMuted(!newMuted) })
+			})
+		}()
+	}
+}
+
+// . setMasterMuted updates the master mute button. Must be called on the Fyne goroutine.
+func setMasterMuted(muted bool) {
+	masterMuted = muted
+	masterMuteButton.SetActive(muted)
+}
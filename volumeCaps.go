@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"soundshift/general"
+	"soundshift/interfaces/policyConfig"
+	"strings"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// . VolumeCap is the highest volume the sessions of an app may play at, for apps that
+// reset their own volume to 100% on every launch
+type VolumeCap struct {
+	Pattern string // name or glob of the app, as in the foreground allowlist
+	Max     int    // percent
+}
+
+// . volumeCapChoices are the choices of the cap editor's dropdown
+var volumeCapChoices = []int{90, 80, 70, 60, 50, 40, 30, 20, 10}
+
+// . volumeCapLabel returns the dropdown choice for a cap
+func volumeCapLabel(percent int) string { return fmt.Sprintf("Max %d%%", percent) }
+
+// . volumeCaps is settings.VolumeCaps, copied by applyVolumeCaps so the mixer monitor
+// and the session event thread can read it off the Fyne goroutine
+var volumeCaps atomic.Pointer[[]VolumeCap]
+
+// . applyVolumeCaps hands the caps in the settings to their enforcement and pulls sessions
+// above a new cap down right away. Must be called on the Fyne goroutine after the settings
+// change.
+func applyVolumeCaps() {
+	caps := append([]VolumeCap(nil), settings.VolumeCaps...)
+	volumeCaps.Store(&caps)
+	signal(mixerResync)
+}
+
+// . volumeCap returns the cap of a session: the lowest of the caps matching its app
+func volumeCap(caps []VolumeCap, s policyConfig.AudioSession) (float32, bool) {
+	limit, found := float32(1), false
+	for _, c := range caps {
+		if (MixerRule{Match: MatchGlob, Pattern: c.Pattern}).matches(s) {
+			limit, found = min(limit, float32(min(max(c.Max, 0), 100))/100), true
+		}
+	}
+	return limit, found
+}
+
+// . sessionVolumeCap returns the cap of a session under the applied caps
+func sessionVolumeCap(s policyConfig.AudioSession) (float32, bool) {
+	caps := volumeCaps.Load()
+	if caps == nil || s.IsSystem {
+		return 1, false
+	}
+	return volumeCap(*caps, s)
+}
+
+// . cappedVolume returns volume, lowered to the session's cap if it is above it
+func cappedVolume(s policyConfig.AudioSession, volume float32) float32 {
+	if limit, ok := sessionVolumeCap(s); ok {
+		return min(volume, limit)
+	}
+	return volume
+}
+
+// . aboveVolumeCap reports whether a session plays louder than its cap allows
+func aboveVolumeCap(s policyConfig.AudioSession) bool {
+	limit, ok := sessionVolumeCap(s)
+	return ok && s.Volume > limit && volumesDiffer(s.Volume, limit)
+}
+
+// . enforceVolumeCaps lowers the sessions of a snapshot that are above their cap. Returns
+// the snapshot with the caps applied. Must run on monitorMixer's thread.
+func enforceVolumeCaps(sessions []policyConfig.AudioSession) []policyConfig.AudioSession {
+	capped := make([]policyConfig.AudioSession, len(sessions))
+	copy(capped, sessions)
+	for i, s := range capped {
+		if !aboveVolumeCap(s) {
+			continue
+		}
+		limit, _ := sessionVolumeCap(s)
+		if err := backend.SetSessionVolume(s.ID, limit); err != nil {
+			general.LogError("Error capping volume of "+s.Name, err)
+			continue
+		}
+		capped[i].Volume = limit
+	}
+	return capped
+}
+
+// . volumeCapsEditor is the cap list of the config window: one row per app and a button
+// to add one
+type volumeCapsEditor struct {
+	Container *fyne.Container
+	list      *fyne.Container
+	rows      []*volumeCapRow
+	appNames  []string // names of the current sessions, offered as patterns
+}
+
+// . volumeCapRow holds the widgets of one cap
+type volumeCapRow struct {
+	pattern *widget.SelectEntry
+	limit   *widget.Select
+	object  fyne.CanvasObject
+}
+
+// . newVolumeCapsEditor creates an editor showing caps. appNames are offered in each
+// cap's pattern dropdown.
+func newVolumeCapsEditor(caps []VolumeCap, appNames []string) *volumeCapsEditor {
+	e := &volumeCapsEditor{list: container.NewVBox(), appNames: appNames}
+	for _, c := range caps {
+		e.add(c)
+	}
+
+	add := widget.NewButtonWithIcon("Add cap", theme.ContentAddIcon(), func() {
+		e.add(VolumeCap{Max: 50})
+	})
+	e.Container = container.NewVBox(e.list, container.NewHBox(add))
+	return e
+}
+
+// . add appends a row for c
+func (e *volumeCapsEditor) add(c VolumeCap) {
+	r := &volumeCapRow{}
+
+	labels := make([]string, len(volumeCapChoices))
+	for i, percent := range volumeCapChoices {
+		labels[i] = volumeCapLabel(percent)
+	}
+	r.limit = widget.NewSelect(labels, nil)
+	r.limit.SetSelected(volumeCapLabel(c.Max))
+	if r.limit.Selected == "" { // not one of the choices, e.g. edited in the settings file
+		r.limit.SetSelected(volumeCapLabel(50))
+	}
+
+	r.pattern = widget.NewSelectEntry(e.appNames)
+	r.pattern.SetText(c.Pattern)
+	r.pattern.SetPlaceHolder("App or *glob*")
+
+	remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() { e.remove(r) })
+	r.object = container.NewBorder(nil, nil, nil, container.NewHBox(r.limit, remove), r.pattern)
+
+	e.rows = append(e.rows, r)
+	e.list.Add(r.object)
+}
+
+// . remove drops the row r
+func (e *volumeCapsEditor) remove(r *volumeCapRow) {
+	for i, row := range e.rows {
+		if row == r {
+			e.rows = append(e.rows[:i], e.rows[i+1:]...)
+			break
+		}
+	}
+	e.list.Remove(r.object)
+}
+
+// . caps returns the edited caps, skipping rows without a pattern
+func (e *volumeCapsEditor) caps() []VolumeCap {
+	var caps []VolumeCap
+	for _, r := range e.rows {
+		pattern := strings.TrimSpace(r.pattern.Text)
+		if pattern == "" {
+			continue
+		}
+		c := VolumeCap{Pattern: pattern, Max: 50}
+		for _, percent := range volumeCapChoices {
+			if volumeCapLabel(percent) == r.limit.Selected {
+				c.Max = percent
+			}
+		}
+		caps = append(caps, c)
+	}
+	return caps
+}
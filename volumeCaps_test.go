@@ -0,0 +1,58 @@
+package main
+
+import (
+	"soundshift/interfaces/policyConfig"
+	"testing"
+)
+
+func TestVolumeCapLowestMatchWins(t *testing.T) {
+	game := policyConfig.AudioSession{Name: "Game", ExePath: gameExe}
+	caps := []VolumeCap{{Pattern: "game", Max: 80}, {Pattern: `c:\games\*\game.exe`, Max: 40}, {Pattern: "other", Max: 10}}
+	if limit, ok := volumeCap(caps, game); !ok || limit != 0.4 {
+		t.Errorf("volumeCap = %v, %v; want 0.4, true", limit, ok)
+	}
+	if _, ok := volumeCap(caps, policyConfig.AudioSession{Name: "Spotify"}); ok {
+		t.Error("an app without a cap was capped")
+	}
+}
+
+func TestPublishSessionsEnforcesVolumeCaps(t *testing.T) {
+	fake := useFakeBackend(t)
+	settings.VolumeCaps = []VolumeCap{{Pattern: "game", Max: 60}}
+	applyVolumeCaps()
+	fake.SetSessions(
+		policyConfig.AudioSession{ID: "g1", Name: "Game", PID: 30, Volume: 1, ExePath: gameExe},
+		policyConfig.AudioSession{ID: "m1", Name: "Spotify", PID: 40, Volume: 1},
+	)
+
+	publishSessions()
+	sessions, _ := fake.GetSessions()
+	for _, s := range sessions {
+		if want := map[string]float32{"g1": 0.6, "m1": 1}[s.ID]; s.Volume != want {
+			t.Errorf("%s volume = %v, want %v", s.ID, s.Volume, want)
+		}
+	}
+
+	// A remembered volume above the cap is restored only up to the cap
+	settings.AppVolumes = map[string]AppVolume{`c:\games\game\game.exe`: {Volume: 0.9, Locked: true}}
+	fake.SetSessionVolume("g1", 0.2)
+	publishSessions()
+	sessions, _ = fake.GetSessions()
+	if sessions[0].Volume != 0.6 {
+		t.Errorf("locked game volume = %v, want the cap 0.6", sessions[0].Volume)
+	}
+}
+
+func TestMixerSliderStopsAtVolumeCap(t *testing.T) {
+	useFakeBackend(t)
+	settings.VolumeCaps = []VolumeCap{{Pattern: "game", Max: 50}}
+	refreshMixerWithSessions([]policyConfig.AudioSession{{ID: "g1", Name: "Game", PID: 30, Volume: 0.3, ExePath: gameExe}})
+
+	mixerSliders[0].SetValue(90)
+	if got := mixerSliders[0].Value; got != 50 {
+		t.Errorf("slider value = %v, want it stopped at the cap 50", got)
+	}
+	if got := settings.AppVolumes[`c:\games\game\game.exe`].Volume; got != 0.5 {
+		t.Errorf("remembered volume = %v, want 0.5", got)
+	}
+}